@@ -3,11 +3,18 @@ package postgres
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/Abhinav7903/split/factory"
 )
 
-func (p *Postgres) CreateBalance(balance *factory.Balance) (int, error) {
+// CreateBalance inserts a balance row by hand. It is an admin adjustment and is
+// recorded in balance_adjustments together with the reason.
+func (p *Postgres) CreateBalance(balance *factory.Balance, adjustedBy int, reason string) (int, error) {
+	if adjustedBy <= 0 || reason == "" {
+		return 0, errors.New("adjusted_by and reason are required")
+	}
+
 	// Validate that user exists
 	userExists, err := p.CheckUserExists(balance.UserID)
 	if err != nil || !userExists {
@@ -22,28 +29,55 @@ func (p *Postgres) CreateBalance(balance *factory.Balance) (int, error) {
 		}
 	}
 
+	// Balances default to the group's currency
+	balance.Currency, err = resolveCurrency(p.dbConn, balance.Currency, balance.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Insert balance into the database
-	query := `INSERT INTO balances (user_id, group_id, owed_amount, lent_amount)
-	          VALUES ($1, $2, $3, $4) RETURNING balance_id`
+	query := `INSERT INTO balances (user_id, group_id, currency, owed_amount, lent_amount)
+	          VALUES ($1, $2, $3, $4, $5) RETURNING balance_id`
 
 	var balanceID int
-	err = p.dbConn.QueryRow(query, balance.UserID, balance.GroupID, balance.OwedAmount, balance.LentAmount).Scan(&balanceID)
+	err = tx.QueryRow(query, balance.UserID, balance.GroupID, balance.Currency, balance.OwedAmount, balance.LentAmount).Scan(&balanceID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = recordBalanceAdjustment(tx, &factory.BalanceAdjustment{
+		BalanceID:  balanceID,
+		OwedAmount: balance.OwedAmount,
+		LentAmount: balance.LentAmount,
+		Reason:     reason,
+		AdjustedBy: adjustedBy,
+	})
 	if err != nil {
 		return 0, err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return balanceID, nil
 }
 
 func (p *Postgres) GetBalanceByID(balanceID int) (*factory.Balance, error) {
-	query := `SELECT balance_id, user_id, group_id, owed_amount, lent_amount 
+	query := `SELECT balance_id, user_id, group_id, currency, owed_amount, lent_amount 
 	          FROM balances WHERE balance_id = $1`
 
 	var balance factory.Balance
 	row := p.dbConn.QueryRow(query, balanceID)
 
 	// Scan the result into the balance struct
-	err := row.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.OwedAmount, &balance.LentAmount)
+	err := row.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.Currency, &balance.OwedAmount, &balance.LentAmount)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("balance not found")
@@ -61,7 +95,7 @@ func (p *Postgres) GetBalancesByUserID(userID int) ([]factory.Balance, error) {
 		return nil, errors.New("user not found")
 	}
 
-	query := `SELECT balance_id, user_id, group_id, owed_amount, lent_amount 
+	query := `SELECT balance_id, user_id, group_id, currency, owed_amount, lent_amount 
 	          FROM balances WHERE user_id = $1`
 
 	rows, err := p.dbConn.Query(query, userID)
@@ -73,7 +107,7 @@ func (p *Postgres) GetBalancesByUserID(userID int) ([]factory.Balance, error) {
 	var balances []factory.Balance
 	for rows.Next() {
 		var balance factory.Balance
-		err = rows.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.OwedAmount, &balance.LentAmount)
+		err = rows.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.Currency, &balance.OwedAmount, &balance.LentAmount)
 		if err != nil {
 			return nil, err
 		}
@@ -90,7 +124,7 @@ func (p *Postgres) GetBalancesByGroupID(groupID int) ([]factory.Balance, error)
 		return nil, errors.New("group not found")
 	}
 
-	query := `SELECT balance_id, user_id, group_id, owed_amount, lent_amount 
+	query := `SELECT balance_id, user_id, group_id, currency, owed_amount, lent_amount 
 	          FROM balances WHERE group_id = $1`
 
 	rows, err := p.dbConn.Query(query, groupID)
@@ -102,7 +136,7 @@ func (p *Postgres) GetBalancesByGroupID(groupID int) ([]factory.Balance, error)
 	var balances []factory.Balance
 	for rows.Next() {
 		var balance factory.Balance
-		err = rows.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.OwedAmount, &balance.LentAmount)
+		err = rows.Scan(&balance.BalanceID, &balance.UserID, &balance.GroupID, &balance.Currency, &balance.OwedAmount, &balance.LentAmount)
 		if err != nil {
 			return nil, err
 		}
@@ -112,43 +146,150 @@ func (p *Postgres) GetBalancesByGroupID(groupID int) ([]factory.Balance, error)
 	return balances, nil
 }
 
-func (p *Postgres) UpdateBalanceAmounts(balanceID int, owedAmount, lentAmount *float64) error {
-	// Ensure the balance exists
-	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM balances WHERE balance_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, balanceID).Scan(&exists)
-	if err != nil || !exists {
-		return errors.New("balance not found")
+// AdjustBalanceAmounts overwrites a balance row by hand. It is an admin
+// adjustment and is recorded in balance_adjustments with the previous amounts.
+func (p *Postgres) AdjustBalanceAmounts(balanceID int, owedAmount, lentAmount *factory.Money, adjustedBy int, reason string) error {
+	if adjustedBy <= 0 || reason == "" {
+		return errors.New("adjusted_by and reason are required")
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the balance so the audit record matches what was overwritten
+	adjustment := factory.BalanceAdjustment{
+		BalanceID:  balanceID,
+		Reason:     reason,
+		AdjustedBy: adjustedBy,
+	}
+	lockQuery := `SELECT owed_amount, lent_amount FROM balances WHERE balance_id = $1 FOR UPDATE`
+	err = tx.QueryRow(lockQuery, balanceID).Scan(&adjustment.PreviousOwedAmount, &adjustment.PreviousLentAmount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("balance not found")
+		}
+		return err
 	}
 
 	query := `UPDATE balances 
 	          SET owed_amount = COALESCE($1, owed_amount), 
 	              lent_amount = COALESCE($2, lent_amount)
-	          WHERE balance_id = $3`
+	          WHERE balance_id = $3
+	          RETURNING owed_amount, lent_amount`
 
-	_, err = p.dbConn.Exec(query, owedAmount, lentAmount, balanceID)
+	err = tx.QueryRow(query, owedAmount, lentAmount, balanceID).Scan(&adjustment.OwedAmount, &adjustment.LentAmount)
 	if err != nil {
 		return err
 	}
 
+	if err := recordBalanceAdjustment(tx, &adjustment); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
-func (p *Postgres) DeleteBalance(balanceID int) error {
-	// Ensure the balance exists
-	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM balances WHERE balance_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, balanceID).Scan(&exists)
-	if err != nil || !exists {
-		return errors.New("balance not found")
+// DeleteBalance removes a balance row by hand. It is an admin adjustment and
+// the amounts it held are recorded in balance_adjustments.
+func (p *Postgres) DeleteBalance(balanceID int, adjustedBy int, reason string) error {
+	if adjustedBy <= 0 || reason == "" {
+		return errors.New("adjusted_by and reason are required")
 	}
 
-	query := `DELETE FROM balances WHERE balance_id = $1`
-	_, err = p.dbConn.Exec(query, balanceID)
+	tx, err := p.dbConn.Begin()
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	adjustment := factory.BalanceAdjustment{
+		BalanceID:  balanceID,
+		Reason:     reason,
+		AdjustedBy: adjustedBy,
+	}
+	query := `DELETE FROM balances WHERE balance_id = $1 RETURNING owed_amount, lent_amount`
+	err = tx.QueryRow(query, balanceID).Scan(&adjustment.PreviousOwedAmount, &adjustment.PreviousLentAmount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("balance not found")
+		}
+		return err
+	}
+
+	if err := recordBalanceAdjustment(tx, &adjustment); err != nil {
 		return err
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetBalanceAdjustments returns the manual adjustments made to a balance, newest first
+func (p *Postgres) GetBalanceAdjustments(balanceID int) ([]factory.BalanceAdjustment, error) {
+	query := `SELECT adjustment_id, balance_id, previous_owed_amount, previous_lent_amount,
+	                 owed_amount, lent_amount, reason, adjusted_by, created_at
+	          FROM balance_adjustments WHERE balance_id = $1
+	          ORDER BY created_at DESC, adjustment_id DESC`
+
+	rows, err := p.dbConn.Query(query, balanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := []factory.BalanceAdjustment{}
+	for rows.Next() {
+		var adjustment factory.BalanceAdjustment
+		err = rows.Scan(
+			&adjustment.AdjustmentID,
+			&adjustment.BalanceID,
+			&adjustment.PreviousOwedAmount,
+			&adjustment.PreviousLentAmount,
+			&adjustment.OwedAmount,
+			&adjustment.LentAmount,
+			&adjustment.Reason,
+			&adjustment.AdjustedBy,
+			&adjustment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+
+	return adjustments, nil
+}
+
+// recordBalanceAdjustment writes the audit row for a manual balance change
+func recordBalanceAdjustment(tx *sql.Tx, adjustment *factory.BalanceAdjustment) error {
+	query := `INSERT INTO balance_adjustments
+	              (balance_id, previous_owed_amount, previous_lent_amount, owed_amount, lent_amount, reason, adjusted_by)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          RETURNING adjustment_id, created_at`
+
+	err := tx.QueryRow(
+		query,
+		adjustment.BalanceID,
+		adjustment.PreviousOwedAmount,
+		adjustment.PreviousLentAmount,
+		adjustment.OwedAmount,
+		adjustment.LentAmount,
+		adjustment.Reason,
+		adjustment.AdjustedBy,
+	).Scan(&adjustment.AdjustmentID, &adjustment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record balance adjustment: %w", err)
+	}
 	return nil
 }
 
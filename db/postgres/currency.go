@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// resolveCurrency normalises code, or falls back to the group's default
+// currency (DefaultCurrency outside a group) when no code is given.
+func resolveCurrency(q queryRower, code string, groupID *int) (string, error) {
+	if code != "" {
+		return factory.NormalizeCurrency(code)
+	}
+	if groupID == nil {
+		return factory.DefaultCurrency, nil
+	}
+
+	var currency string
+	err := q.QueryRow(`SELECT default_currency FROM groups WHERE group_id = $1`, *groupID).Scan(&currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errors.New("group does not exist")
+		}
+		return "", fmt.Errorf("failed to get group currency: %w", err)
+	}
+	return currency, nil
+}
@@ -0,0 +1,250 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// CreateExpense records an expense as a single transaction with one split per
+// participant and moves every participant's balance in the group. All rows are
+// written in one SQL transaction so a failure leaves nothing behind.
+func (p *Postgres) CreateExpense(expense *factory.Expense) (int, error) {
+	if err := expense.Validate(); err != nil {
+		return 0, err
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	transactionID, err := insertExpense(tx, expense)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return transactionID, nil
+}
+
+// insertExpense writes a validated expense, its splits and the balance changes
+// inside tx and returns the new transaction's ID.
+func insertExpense(tx *sql.Tx, expense *factory.Expense) (int, error) {
+	// Validate that the group, payer and every participant exist
+	var groupExists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL)`, expense.GroupID).Scan(&groupExists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check group: %w", err)
+	}
+	if !groupExists {
+		return 0, errors.New("group does not exist")
+	}
+
+	userIDs := []int{expense.PayerID}
+	for _, participant := range expense.Participants {
+		userIDs = append(userIDs, participant.UserID)
+	}
+	for _, userID := range userIDs {
+		var userExists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`, userID).Scan(&userExists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check user %d: %w", userID, err)
+		}
+		if !userExists {
+			return 0, fmt.Errorf("user %d does not exist", userID)
+		}
+	}
+
+	// Money is only recorded between current members of the group
+	if err = requireActiveMembers(tx, expense.GroupID, userIDs...); err != nil {
+		return 0, err
+	}
+
+	if expense.PaymentMethodID != nil {
+		var paymentMethodExists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM payment_methods WHERE payment_id = $1)`, *expense.PaymentMethodID).Scan(&paymentMethodExists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check payment method: %w", err)
+		}
+		if !paymentMethodExists {
+			return 0, errors.New("payment method does not exist")
+		}
+	}
+
+	// Expenses default to the group's currency
+	groupID := expense.GroupID
+	expense.Currency, err = resolveCurrency(tx, expense.Currency, &groupID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The splits carry who owes what; borrower_id points at the first other
+	// participant so two-person expenses still read naturally.
+	borrowerID := expense.PayerID
+	for _, participant := range expense.Participants {
+		if participant.UserID != expense.PayerID {
+			borrowerID = participant.UserID
+			break
+		}
+	}
+
+	const insertTransactionQuery = `
+		INSERT INTO transactions
+			(lender_id, borrower_id, group_id, amount, currency, status, purpose, category, payment_method_id, retry_count, is_expense)
+		VALUES ($1, $2, $3, $4, $5, 'successful', $6, $7, $8, 0, TRUE)
+		RETURNING transaction_id
+	`
+	var transactionID int
+	err = tx.QueryRow(
+		insertTransactionQuery,
+		expense.PayerID,
+		borrowerID,
+		expense.GroupID,
+		expense.Amount,
+		expense.Currency,
+		expense.Purpose,
+		expense.Category,
+		expense.PaymentMethodID,
+	).Scan(&transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert transaction: %w", err)
+	}
+
+	status := "successful"
+	err = insertTransactionLog(tx, factory.TransactionLog{
+		TransactionID: transactionID,
+		Action:        factory.TransactionCreated,
+		Status:        &status,
+		PerformedBy:   &expense.PayerID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	const insertSplitQuery = `
+		INSERT INTO transaction_splits (transaction_id, user_id, amount)
+		VALUES ($1, $2, $3)
+	`
+	var lent factory.Money
+	for _, participant := range expense.Participants {
+		if _, err = tx.Exec(insertSplitQuery, transactionID, participant.UserID, participant.Amount); err != nil {
+			return 0, fmt.Errorf("failed to insert transaction split: %w", err)
+		}
+
+		// The payer's own share is not a debt to anyone
+		if participant.UserID == expense.PayerID {
+			continue
+		}
+		if err = adjustBalance(tx, participant.UserID, &groupID, expense.Currency, participant.Amount, 0); err != nil {
+			return 0, err
+		}
+		lent += participant.Amount
+	}
+
+	if lent > 0 {
+		if err = adjustBalance(tx, expense.PayerID, &groupID, expense.Currency, 0, lent); err != nil {
+			return 0, err
+		}
+	}
+
+	return transactionID, nil
+}
+
+// applyTransactionBalances moves the stored balances for an existing
+// transaction the way the ledger counts it when sign is 1, or undoes that when
+// sign is -1: each split owes the lender its share, and a transaction without
+// splits is owed entirely by its borrower.
+func applyTransactionBalances(tx *sql.Tx, transactionID int, sign factory.Money) error {
+	var lenderID, borrowerID int
+	var groupID *int
+	var currency string
+	var amount factory.Money
+	err := tx.QueryRow(`SELECT lender_id, borrower_id, group_id, currency, amount FROM transactions WHERE transaction_id = $1`, transactionID).
+		Scan(&lenderID, &borrowerID, &groupID, &currency, &amount)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	rows, err := tx.Query(`SELECT user_id, amount FROM transaction_splits WHERE transaction_id = $1`, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to get transaction splits: %w", err)
+	}
+	type share struct {
+		userID int
+		amount factory.Money
+	}
+	var shares []share
+	hasSplits := false
+	for rows.Next() {
+		var sh share
+		if err := rows.Scan(&sh.userID, &sh.amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan transaction split: %w", err)
+		}
+		hasSplits = true
+		// The lender's own share is not a debt to anyone
+		if sh.userID != lenderID {
+			shares = append(shares, sh)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read transaction splits: %w", err)
+	}
+	if !hasSplits && borrowerID != lenderID {
+		shares = append(shares, share{userID: borrowerID, amount: amount})
+	}
+
+	var lent factory.Money
+	for _, sh := range shares {
+		if err := adjustBalance(tx, sh.userID, groupID, currency, sign*sh.amount, 0); err != nil {
+			return err
+		}
+		lent += sh.amount
+	}
+	if lent > 0 {
+		if err := adjustBalance(tx, lenderID, groupID, currency, 0, sign*lent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adjustBalance adds the given deltas to the user's balance row for the group
+// and currency, creating the row if the user has no balance there yet.
+func adjustBalance(tx *sql.Tx, userID int, groupID *int, currency string, owedDelta, lentDelta factory.Money) error {
+	const updateQuery = `
+		UPDATE balances
+		SET owed_amount = owed_amount + $1,
+		    lent_amount = lent_amount + $2
+		WHERE user_id = $3 AND group_id IS NOT DISTINCT FROM $4 AND currency = $5
+	`
+	result, err := tx.Exec(updateQuery, owedDelta, lentDelta, userID, groupID, currency)
+	if err != nil {
+		return fmt.Errorf("failed to update balance for user %d: %w", userID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	const insertQuery = `
+		INSERT INTO balances (user_id, group_id, currency, owed_amount, lent_amount)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(insertQuery, userID, groupID, currency, owedDelta, lentDelta); err != nil {
+		return fmt.Errorf("failed to create balance for user %d: %w", userID, err)
+	}
+	return nil
+}
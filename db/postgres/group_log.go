@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// insertGroupLog records a lifecycle step of a group inside tx, so the history
+// only changes when the group does. It fills in the log's ID and timestamp.
+func insertGroupLog(tx *sql.Tx, log *factory.GroupLog) error {
+	err := tx.QueryRow(`
+		INSERT INTO group_logs (group_id, action, details, performed_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING log_id, timestamp`,
+		log.GroupID, log.Action, log.Details, log.PerformedBy,
+	).Scan(&log.LogID, &log.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to log group %s: %w", log.Action, err)
+	}
+	return nil
+}
+
+// GetGroupLogs returns the lifecycle history of a group, oldest first. It
+// works for purged groups too.
+func (p *Postgres) GetGroupLogs(groupID int) ([]factory.GroupLog, error) {
+	rows, err := p.dbConn.Query(`
+		SELECT log_id, group_id, action, details, performed_by, timestamp
+		FROM group_logs
+		WHERE group_id = $1
+		ORDER BY timestamp, log_id`,
+		groupID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group history: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []factory.GroupLog{}
+	for rows.Next() {
+		var log factory.GroupLog
+		err := rows.Scan(
+			&log.LogID,
+			&log.GroupID,
+			&log.Action,
+			&log.Details,
+			&log.PerformedBy,
+			&log.Timestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
@@ -7,6 +7,8 @@ import (
 	"log/slog"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/lib/pq"
 )
 
 func (p *Postgres) AddGroupMember(groupMember factory.GroupMember) (int, error) {
@@ -34,8 +36,8 @@ func (p *Postgres) AddGroupMember(groupMember factory.GroupMember) (int, error)
 	// Check if group and user exist
 	const checkExistsQuery = `
         SELECT 
-            EXISTS (SELECT 1 FROM groups WHERE group_id = $1) AS group_exists,
-            EXISTS (SELECT 1 FROM users WHERE user_id = $2) AS user_exists
+            EXISTS (SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL) AS group_exists,
+            EXISTS (SELECT 1 FROM users WHERE user_id = $2 AND deleted_at IS NULL) AS user_exists
     `
 	var groupExists, userExists bool
 	err = tx.QueryRow(checkExistsQuery, groupMember.GroupID, groupMember.UserID).Scan(&groupExists, &userExists)
@@ -52,16 +54,11 @@ func (p *Postgres) AddGroupMember(groupMember factory.GroupMember) (int, error)
 		return 0, errors.New("user does not exist")
 	}
 
-	// Insert group member
-	const insertGroupMemberQuery = `
-        INSERT INTO group_members (group_id, user_id)
-        VALUES ($1, $2)
-        RETURNING group_member_id
-    `
+	// Insert group member; a repeat add reports ErrAlreadyMember
 	var groupMemberID int
-	err = tx.QueryRow(insertGroupMemberQuery, groupMember.GroupID, groupMember.UserID).Scan(&groupMemberID)
+	groupMemberID, err = insertGroupMember(tx, groupMember.GroupID, groupMember.UserID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert group member: %w", err)
+		return 0, err
 	}
 
 	return groupMemberID, nil
@@ -76,13 +73,13 @@ func (p *Postgres) GetGroupMemberByID(groupMemberID int) (*factory.GroupMember,
 
 	// Query group member
 	const query = `
-        SELECT group_id, user_id, joined_date
+        SELECT group_id, user_id, role, joined_date, left_at, removed_by
         FROM group_members
         WHERE group_member_id = $1
     `
 	groupMember := &factory.GroupMember{}
 
-	err := p.dbConn.QueryRow(query, groupMemberID).Scan(&groupMember.GroupID, &groupMember.UserID, &groupMember.JoinedDate)
+	err := p.dbConn.QueryRow(query, groupMemberID).Scan(&groupMember.GroupID, &groupMember.UserID, &groupMember.Role, &groupMember.JoinedDate, &groupMember.LeftAt, &groupMember.RemovedBy)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.New("group member not found")
@@ -92,11 +89,14 @@ func (p *Postgres) GetGroupMemberByID(groupMemberID int) (*factory.GroupMember,
 
 	// Set the group member ID explicitly
 	groupMember.GroupMemberID = groupMemberID
+	groupMember.Active = groupMember.LeftAt == nil
 
 	return groupMember, nil
 }
 
-// GetGroupMembersByGroupID returns all the group members in the group with the given ID
+// GetGroupMembersByGroupID returns all the group members in the group with the
+// given ID, current members first. Former members are kept, inactive, so
+// older transactions can still be attributed.
 func (p *Postgres) GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember, error) {
 	// Validate input
 	if groupID <= 0 {
@@ -105,9 +105,10 @@ func (p *Postgres) GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember,
 
 	// Query group members
 	const query = `
-		SELECT group_member_id, user_id,joined_date
+		SELECT group_member_id, user_id, role, joined_date, left_at, removed_by
 		FROM group_members
 		WHERE group_id = $1
+		ORDER BY left_at NULLS FIRST, joined_date, group_member_id
 	`
 	rows, err := p.dbConn.Query(query, groupID)
 	if err != nil {
@@ -118,113 +119,584 @@ func (p *Postgres) GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember,
 	groupMembers := []factory.GroupMember{}
 	for rows.Next() {
 		groupMember := factory.GroupMember{GroupID: groupID}
-		err := rows.Scan(&groupMember.GroupMemberID, &groupMember.UserID, &groupMember.JoinedDate)
+		err := rows.Scan(&groupMember.GroupMemberID, &groupMember.UserID, &groupMember.Role, &groupMember.JoinedDate, &groupMember.LeftAt, &groupMember.RemovedBy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan group member: %w", err)
 		}
+		groupMember.Active = groupMember.LeftAt == nil
 		groupMembers = append(groupMembers, groupMember)
 	}
 
 	return groupMembers, nil
 }
 
-func (p *Postgres) RemoveUserFromGroupByCreator(groupID, userID, creatorID int) error {
+// RemoveUserFromGroup removes another member from the group. Whether the
+// caller may do so is decided by their role; the owner can never be removed.
+func (p *Postgres) RemoveUserFromGroup(removal factory.MemberRemoval) error {
+	return p.deactivateMember(removal, groupmember.ErrOwnerRole)
+}
+
+// RemoveUserSelf removes the user from the group they belong to
+func (p *Postgres) RemoveUserSelf(removal factory.MemberRemoval) error {
+	return p.deactivateMember(removal, groupmember.ErrOwnerCannotLeave)
+}
+
+// deactivateMember marks the member as having left, keeping the row so their
+// transactions still show who they were. Outstanding balances in the group
+// block this unless removal says how to settle them, in which case the
+// settling entries are recorded in the same DB transaction.
+func (p *Postgres) deactivateMember(removal factory.MemberRemoval, ownerErr error) error {
 	// Validate input
-	if groupID <= 0 || userID <= 0 || creatorID <= 0 {
-		return errors.New("invalid input: groupID, userID, and creatorID must be greater than zero")
+	if removal.GroupID <= 0 || removal.UserID <= 0 || removal.RemovedBy <= 0 {
+		return errors.New("invalid input: groupID, userID and removedBy must be greater than zero")
+	}
+	switch removal.Settle {
+	case factory.SettleNone, factory.SettleWriteOff:
+	case factory.SettleTransfer:
+		if removal.TransferTo == nil || *removal.TransferTo == removal.UserID {
+			return errors.New("a transfer needs another member to take over the balances")
+		}
+	default:
+		return fmt.Errorf("invalid settle option %q", removal.Settle)
 	}
 
-	// Check if the user is part of the group
-	var isMember bool
-	const checkUserInGroupQuery = `
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deactivateMemberTx(tx, removal, ownerErr); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deactivateMemberTx does the work of deactivateMember inside tx
+func deactivateMemberTx(tx *sql.Tx, removal factory.MemberRemoval, ownerErr error) error {
+	// Lock the member's row so the balances cannot be settled twice
+	var role string
+	err := tx.QueryRow(`
+		SELECT m.role
+		FROM group_members m
+		JOIN groups g ON g.group_id = m.group_id
+		WHERE m.group_id = $1 AND m.user_id = $2 AND m.left_at IS NULL AND g.deleted_at IS NULL
+		FOR UPDATE OF m`,
+		removal.GroupID, removal.UserID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return groupmember.ErrNotMember
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get member: %w", err)
+	}
+	if role == factory.RoleOwner {
+		return ownerErr
+	}
+
+	balances, err := memberBalances(tx, removal.GroupID, removal.UserID)
+	if err != nil {
+		return err
+	}
+	if len(balances) > 0 {
+		if removal.Settle == factory.SettleNone {
+			return &groupmember.OutstandingBalanceError{Balances: balances}
+		}
+		if removal.Settle == factory.SettleWriteOff && removal.RemovedBy == removal.UserID {
+			// Leaving members may forgive what they are owed, not what they owe
+			for _, balance := range balances {
+				if balance.Net < 0 {
+					return groupmember.ErrSelfWriteOff
+				}
+			}
+		}
+		if err := settleMemberBalances(tx, removal, balances); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE group_members
+		SET left_at = NOW(), removed_by = $3
+		WHERE group_id = $1 AND user_id = $2`,
+		removal.GroupID, removal.UserID, removal.RemovedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove user from group: %w", err)
+	}
+	return nil
+}
+
+// memberBalances works out from the ledger what the member and each other
+// person in the group owe each other, leaving out pairs that are square
+func memberBalances(tx *sql.Tx, groupID, userID int) ([]factory.PairwiseBalance, error) {
+	query := `WITH ` + ledgerDebts + `
+		SELECT other_id, currency, SUM(owed), SUM(lent), SUM(lent) - SUM(owed)
+		FROM (
+			SELECT creditor_id AS other_id, currency, amount AS owed, 0 AS lent
+			FROM ledger_debts
+			WHERE group_id = $1 AND debtor_id = $2 AND creditor_id <> $2
+			UNION ALL
+			SELECT debtor_id, currency, 0, amount
+			FROM ledger_debts
+			WHERE group_id = $1 AND creditor_id = $2 AND debtor_id <> $2
+		) pairs
+		GROUP BY other_id, currency
+		HAVING SUM(lent) - SUM(owed) <> 0
+		ORDER BY currency, other_id
+	`
+	rows, err := tx.Query(query, groupID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query member balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []factory.PairwiseBalance{}
+	for rows.Next() {
+		balance := factory.PairwiseBalance{UserID: userID, GroupID: &groupID}
+		err := rows.Scan(&balance.OtherUserID, &balance.Currency, &balance.OwedAmount, &balance.LentAmount, &balance.Net)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan member balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate member balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// settleMemberBalances squares the departing member with everyone through
+// settlements. A write-off stops there; a transfer then puts the same debts
+// and credits between the other person and the member taking over.
+func settleMemberBalances(tx *sql.Tx, removal factory.MemberRemoval, balances []factory.PairwiseBalance) error {
+	kind := factory.SettlementWriteOff
+	if removal.Settle == factory.SettleTransfer {
+		kind = factory.SettlementTransfer
+
+		var isActive bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2 AND left_at IS NULL)`,
+			removal.GroupID, *removal.TransferTo,
+		).Scan(&isActive)
+		if err != nil {
+			return fmt.Errorf("failed to check transfer member: %w", err)
+		}
+		if !isActive {
+			return errors.New("balances can only be transferred to a current member of the group")
+		}
+	}
+
+	for _, balance := range balances {
+		// A settlement from payer to counterparty lowers what the payer owes
+		// the counterparty, so paying "the wrong way" creates a debt
+		payer, counterparty, amount := balance.UserID, balance.OtherUserID, -balance.Net
+		if balance.Net > 0 {
+			payer, counterparty, amount = balance.OtherUserID, balance.UserID, balance.Net
+		}
+		entries := []factory.Settlement{{UserID: payer, CounterpartyID: counterparty, Amount: amount}}
+
+		if kind == factory.SettlementTransfer && balance.OtherUserID != *removal.TransferTo {
+			if balance.Net > 0 {
+				// The other person now owes the new member instead
+				entries = append(entries, factory.Settlement{UserID: *removal.TransferTo, CounterpartyID: balance.OtherUserID, Amount: amount})
+			} else {
+				// The new member now owes the other person instead
+				entries = append(entries, factory.Settlement{UserID: balance.OtherUserID, CounterpartyID: *removal.TransferTo, Amount: amount})
+			}
+		}
+
+		for _, entry := range entries {
+			entry.GroupID = &removal.GroupID
+			entry.Currency = balance.Currency
+			entry.Kind = kind
+			if err := insertSettlement(tx, &entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IsGroupMember reports whether the user currently belongs to the group,
+// whatever their role. Nobody is a member of a deleted group.
+func (p *Postgres) IsGroupMember(groupID, userID int) (bool, error) {
+	if groupID <= 0 || userID <= 0 {
+		return false, nil
+	}
+
+	const query = `
 		SELECT EXISTS (
-			SELECT 1 FROM group_members
-			WHERE group_id = $1 AND user_id = $2
+			SELECT 1 FROM groups g
+			JOIN group_members m ON m.group_id = g.group_id
+			WHERE g.group_id = $1 AND g.deleted_at IS NULL AND m.user_id = $2 AND m.left_at IS NULL
 		)
 	`
-	err := p.dbConn.QueryRow(checkUserInGroupQuery, groupID, userID).Scan(&isMember)
+	var isMember bool
+	err := p.dbConn.QueryRow(query, groupID, userID).Scan(&isMember)
 	if err != nil {
-		return fmt.Errorf("failed to check if user is part of the group: %w", err)
+		return false, fmt.Errorf("failed to check group membership: %w", err)
 	}
-	if !isMember {
-		return errors.New("user is not a member of the group")
+
+	return isMember, nil
+}
+
+// ListGroupsForUser returns a page of the groups the user is a member of
+func (p *Postgres) ListGroupsForUser(userID int, page factory.PageRequest) (factory.Page[factory.Group], error) {
+	if userID <= 0 {
+		return factory.Page[factory.Group]{}, errors.New("invalid user ID: must be greater than zero")
 	}
 
-	// Check if the user is the creator of the group
-	var createdBy int
-	const checkCreatorQuery = `
-        SELECT created_by 
-        FROM groups
-        WHERE group_id = $1
-    `
-	err = p.dbConn.QueryRow(checkCreatorQuery, groupID).Scan(&createdBy)
+	const query = `
+		SELECT g.group_id, COALESCE(g.group_name, ''), g.default_currency, g.created_by, g.created_at, g.deleted_at, g.deleted_by, g.archived_at, g.archived_by
+		FROM groups g
+		WHERE g.deleted_at IS NULL
+		  AND EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = g.group_id AND m.user_id = $1 AND m.left_at IS NULL)`
+	groups, err := groupKeyset.list(p.dbConn, query, []interface{}{userID}, page, scanGroupRow)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("group not found")
-		}
-		return fmt.Errorf("failed to check group creator: %w", err)
+		return groups, fmt.Errorf("failed to query groups for user: %w", err)
 	}
 
-	// Ensure the creator is the one making the request
-	if createdBy != creatorID {
-		return errors.New("only the group creator can remove users from the group")
+	return groups, nil
+}
+
+// GetMemberRole returns the user's role in the group. Users outside the group,
+// former members and everyone in a deleted group get ErrNotMember.
+func (p *Postgres) GetMemberRole(groupID, userID int) (string, error) {
+	const query = `
+		SELECT m.role
+		FROM group_members m
+		JOIN groups g ON g.group_id = m.group_id
+		WHERE m.group_id = $1 AND m.user_id = $2 AND m.left_at IS NULL AND g.deleted_at IS NULL
+	`
+	var role string
+	err := p.dbConn.QueryRow(query, groupID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", groupmember.ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member role: %w", err)
 	}
 
-	// Remove the user from the group
-	const removeUserQuery = `
-        DELETE FROM group_members
-        WHERE group_id = $1 AND user_id = $2
-    `
-	result, err := p.dbConn.Exec(removeUserQuery, groupID, userID)
+	return role, nil
+}
+
+// SetMemberRole promotes or demotes a member. Ownership only moves through
+// TransferOwnership, so the owner's row is never touched here.
+func (p *Postgres) SetMemberRole(groupID, userID int, role string) error {
+	if !factory.ValidRole(role) {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	if role == factory.RoleOwner {
+		return groupmember.ErrOwnerRole
+	}
+
+	current, err := p.GetMemberRole(groupID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to remove user from group: %w", err)
+		return err
+	}
+	if current == factory.RoleOwner {
+		return groupmember.ErrOwnerRole
 	}
 
-	// Check if a row was actually deleted
+	const query = `
+		UPDATE group_members
+		SET role = $3
+		WHERE group_id = $1 AND user_id = $2 AND role <> 'owner' AND left_at IS NULL
+	`
+	result, err := p.dbConn.Exec(query, groupID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to set member role: %w", err)
+	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to check affected rows: %w", err)
 	}
 	if rowsAffected == 0 {
-		return errors.New("user was not removed, possibly not a member of the group")
+		return groupmember.ErrNotMember
 	}
 
 	return nil
 }
 
-// RemoveUserSelf removes the user from the group they belong to
-func (p *Postgres) RemoveUserSelf(groupID, userID int) error {
-	// Validate input
-	if groupID <= 0 || userID <= 0 {
-		return errors.New("invalid input")
+// TransferOwnership hands the group to another member. The previous owner
+// stays on as an admin.
+func (p *Postgres) TransferOwnership(groupID, fromUserID, toUserID int) error {
+	if fromUserID == toUserID {
+		return errors.New("the new owner must be a different member")
 	}
 
-	// Check if the user is part of the group
-	var exists bool
-	const checkUserInGroupQuery = `
-        SELECT EXISTS (
-            SELECT 1 FROM group_members
-            WHERE group_id = $1 AND user_id = $2
-        )
-    `
-	err := p.dbConn.QueryRow(checkUserInGroupQuery, groupID, userID).Scan(&exists)
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both rows so concurrent transfers cannot interleave
+	rows, err := tx.Query(`
+		SELECT user_id, role FROM group_members
+		WHERE group_id = $1 AND user_id IN ($2, $3) AND left_at IS NULL
+		FOR UPDATE`,
+		groupID, fromUserID, toUserID,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to check if user is part of the group: %w", err)
+		return fmt.Errorf("failed to get members: %w", err)
+	}
+	roles := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var role string
+		if err := rows.Scan(&userID, &role); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan member: %w", err)
+		}
+		roles[userID] = role
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get members: %w", err)
 	}
 
-	if !exists {
-		return errors.New("user is not a member of the group")
+	if roles[fromUserID] != factory.RoleOwner {
+		return errors.New("only the owner can transfer ownership")
+	}
+	if _, ok := roles[toUserID]; !ok {
+		return groupmember.ErrNotMember
 	}
 
-	// Remove the user from the group
-	const removeUserQuery = `
-        DELETE FROM group_members
-        WHERE group_id = $1 AND user_id = $2
-    `
-	_, err = p.dbConn.Exec(removeUserQuery, groupID, userID)
+	// Demote first: only one owner may exist at a time
+	if _, err := tx.Exec(`UPDATE group_members SET role = 'admin' WHERE group_id = $1 AND user_id = $2`, groupID, fromUserID); err != nil {
+		return fmt.Errorf("failed to demote owner: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_members SET role = 'owner' WHERE group_id = $1 AND user_id = $2`, groupID, toUserID); err != nil {
+		return fmt.Errorf("failed to promote new owner: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+const selectLeaveRequest = `
+	SELECT leave_request_id, group_id, user_id, transfer_to, status, decided_by, decided_at, created_at
+	FROM group_leave_requests `
+
+func scanLeaveRequest(row interface{ Scan(...interface{}) error }) (factory.LeaveRequest, error) {
+	var r factory.LeaveRequest
+	err := row.Scan(
+		&r.LeaveRequestID,
+		&r.GroupID,
+		&r.UserID,
+		&r.TransferTo,
+		&r.Status,
+		&r.DecidedBy,
+		&r.DecidedAt,
+		&r.CreatedAt,
+	)
+	return r, err
+}
+
+// RequestLeave leaves a pending request for the member taking over the
+// balances, or the owner, to approve, and lets that member know. The leaving
+// member stays in the group until then.
+func (p *Postgres) RequestLeave(removal factory.MemberRemoval) (factory.LeaveRequest, error) {
+	if removal.TransferTo == nil || *removal.TransferTo == removal.UserID {
+		return factory.LeaveRequest{}, errors.New("a transfer needs another member to take over the balances")
+	}
+
+	tx, err := p.dbConn.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to remove user from group: %w", err)
+		return factory.LeaveRequest{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	role, err := memberRole(tx, removal.GroupID, removal.UserID)
+	if err != nil {
+		return factory.LeaveRequest{}, err
+	}
+	if role == factory.RoleOwner {
+		return factory.LeaveRequest{}, groupmember.ErrOwnerCannotLeave
+	}
+	if err := requireActiveMembers(tx, removal.GroupID, *removal.TransferTo); err != nil {
+		return factory.LeaveRequest{}, err
+	}
+
+	request, err := scanLeaveRequest(tx.QueryRow(`
+		INSERT INTO group_leave_requests (group_id, user_id, transfer_to)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING leave_request_id, group_id, user_id, transfer_to, status, decided_by, decided_at, created_at`,
+		removal.GroupID, removal.UserID, *removal.TransferTo,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return request, groupmember.ErrLeaveRequestPending
+	}
+	if err != nil {
+		return request, fmt.Errorf("failed to create leave request: %w", err)
+	}
+
+	name, err := userName(tx, removal.UserID)
+	if err != nil {
+		return request, err
+	}
+	group, err := groupName(tx, removal.GroupID)
+	if err != nil {
+		return request, err
+	}
+	err = insertNotification(tx, factory.Notification{
+		UserID:           *removal.TransferTo,
+		NotificationType: factory.NotificationLeaveRequest,
+		Message:          fmt.Sprintf("%s wants to leave %s and hand their balances over to you", name, group),
+	})
+	if err != nil {
+		return request, err
+	}
+
+	return request, tx.Commit()
+}
+
+func (p *Postgres) GetLeaveRequest(leaveRequestID int) (factory.LeaveRequest, error) {
+	r, err := scanLeaveRequest(p.dbConn.QueryRow(selectLeaveRequest+`WHERE leave_request_id = $1`, leaveRequestID))
+	if err == sql.ErrNoRows {
+		return r, groupmember.ErrLeaveRequestNotFound
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to get leave request: %w", err)
 	}
+	return r, nil
+}
 
+func (p *Postgres) ListLeaveRequests(groupID int) ([]factory.LeaveRequest, error) {
+	rows, err := p.dbConn.Query(selectLeaveRequest+`WHERE group_id = $1 AND status = 'pending' ORDER BY created_at, leave_request_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leave requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []factory.LeaveRequest{}
+	for rows.Next() {
+		r, err := scanLeaveRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan leave request: %w", err)
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// DecideLeaveRequest approves or rejects a pending leave request. Approving
+// removes the member and transfers their balances in the same transaction.
+// The member is told the outcome either way.
+func (p *Postgres) DecideLeaveRequest(leaveRequestID int, approve bool, decidedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := scanLeaveRequest(tx.QueryRow(selectLeaveRequest+`WHERE leave_request_id = $1 FOR UPDATE`, leaveRequestID))
+	if err == sql.ErrNoRows {
+		return groupmember.ErrLeaveRequestNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get leave request: %w", err)
+	}
+	if r.Status != factory.LeaveRequestPending {
+		return groupmember.ErrLeaveRequestClosed
+	}
+
+	status, outcome := factory.LeaveRequestRejected, "declined"
+	if approve {
+		status, outcome = factory.LeaveRequestApproved, "approved"
+		err := deactivateMemberTx(tx, factory.MemberRemoval{
+			GroupID:    r.GroupID,
+			UserID:     r.UserID,
+			RemovedBy:  r.UserID,
+			Settle:     factory.SettleTransfer,
+			TransferTo: &r.TransferTo,
+		}, groupmember.ErrOwnerCannotLeave)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE group_leave_requests
+		SET status = $2, decided_by = $3, decided_at = NOW()
+		WHERE leave_request_id = $1`,
+		leaveRequestID, status, decidedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update leave request: %w", err)
+	}
+
+	group, err := groupName(tx, r.GroupID)
+	if err != nil {
+		return err
+	}
+	err = insertNotification(tx, factory.Notification{
+		UserID:           r.UserID,
+		NotificationType: factory.NotificationLeaveRequest,
+		Message:          fmt.Sprintf("Your request to leave %s was %s", group, outcome),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// memberRole returns the role of a current member of a group that has not
+// been deleted, or groupmember.ErrNotMember
+func memberRole(tx *sql.Tx, groupID, userID int) (string, error) {
+	var role string
+	err := tx.QueryRow(`
+		SELECT m.role
+		FROM group_members m
+		JOIN groups g ON g.group_id = m.group_id
+		WHERE m.group_id = $1 AND m.user_id = $2 AND m.left_at IS NULL AND g.deleted_at IS NULL`,
+		groupID, userID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", groupmember.ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member: %w", err)
+	}
+	return role, nil
+}
+
+// requireActiveMembers fails with groupmember.ErrNotMember unless every user is
+// a current member of the group. The membership rows are locked until tx ends
+// so nobody can leave while money is being recorded against them.
+func requireActiveMembers(tx *sql.Tx, groupID int, userIDs ...int) error {
+	rows, err := tx.Query(`
+		SELECT user_id FROM group_members
+		WHERE group_id = $1 AND user_id = ANY($2) AND left_at IS NULL
+		FOR SHARE`,
+		groupID, pq.Array(userIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check group members: %w", err)
+	}
+	defer rows.Close()
+
+	active := make(map[int]bool, len(userIDs))
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return fmt.Errorf("failed to scan group member: %w", err)
+		}
+		active[userID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check group members: %w", err)
+	}
+
+	for _, userID := range userIDs {
+		if !active[userID] {
+			return fmt.Errorf("user %d: %w", userID, groupmember.ErrNotMember)
+		}
+	}
 	return nil
 }
@@ -2,9 +2,15 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groups"
+	"github.com/Abhinav7903/split/pkg/settleup"
 )
 
 // AddGroup adds a new group to the database.
@@ -13,13 +19,29 @@ func (p *Postgres) AddGroup(group factory.Group) (int, error) {
 		return 0, errors.New("invalid group data")
 	}
 
+	// Groups default to rupees unless another currency is given
+	currency := factory.DefaultCurrency
+	if group.DefaultCurrency != "" {
+		code, err := factory.NormalizeCurrency(group.DefaultCurrency)
+		if err != nil {
+			return 0, err
+		}
+		currency = code
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	var exists bool
 	checkUserQuery := `
 		SELECT EXISTS (
-			SELECT 1 FROM users WHERE user_id = $1
+			SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL
 		)
 	`
-	err := p.dbConn.QueryRow(checkUserQuery, group.CreatedBy).Scan(&exists)
+	err = tx.QueryRow(checkUserQuery, group.CreatedBy).Scan(&exists)
 	if err != nil {
 		return 0, err
 	}
@@ -28,36 +50,52 @@ func (p *Postgres) AddGroup(group factory.Group) (int, error) {
 	}
 
 	insertGroupQuery := `
-		INSERT INTO groups (group_name, created_by)
-		VALUES ($1, $2)
+		INSERT INTO groups (group_name, created_by, default_currency)
+		VALUES ($1, $2, $3)
 		RETURNING group_id
 	`
 	var groupID int
-	err = p.dbConn.QueryRow(insertGroupQuery, group.GroupName, group.CreatedBy).Scan(&groupID)
+	err = tx.QueryRow(insertGroupQuery, group.GroupName, group.CreatedBy, currency).Scan(&groupID)
 	if err != nil {
 		return 0, err
 	}
 
+	// The creator is the group's first member and its owner
+	_, err = tx.Exec(`INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, 'owner')`, groupID, group.CreatedBy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add creator to group: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return groupID, nil
 }
 
-// GetGroup retrieves a group by its ID.
-func (p *Postgres) GetGroup(groupID int) (factory.Group, error) {
+// GetGroup retrieves a group by its ID. Deleted groups are not found unless
+// includeDeleted is set.
+func (p *Postgres) GetGroup(groupID int, includeDeleted bool) (factory.Group, error) {
 	var group factory.Group
 	query := `
-		SELECT group_id, group_name, created_by, created_at
+		SELECT group_id, group_name, default_currency, created_by, created_at, deleted_at, deleted_by, archived_at, archived_by
 		FROM groups
-		WHERE group_id = $1
+		WHERE group_id = $1 AND ($2 OR deleted_at IS NULL)
 	`
-	err := p.dbConn.QueryRow(query, groupID).Scan(
+	err := p.dbConn.QueryRow(query, groupID, includeDeleted).Scan(
 		&group.GroupID,
 		&group.GroupName,
+		&group.DefaultCurrency,
 		&group.CreatedBy,
 		&group.CreatedAt,
+		&group.DeletedAt,
+		&group.DeletedBy,
+		&group.ArchivedAt,
+		&group.ArchivedBy,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return factory.Group{}, errors.New("group not found")
+			return factory.Group{}, groups.ErrNotFound
 		}
 		return factory.Group{}, err
 	}
@@ -65,29 +103,35 @@ func (p *Postgres) GetGroup(groupID int) (factory.Group, error) {
 	return group, nil
 }
 
-// GetAllGroups retrieves all groups from the database.
-func (p *Postgres) GetAllGroups() ([]factory.Group, error) {
-	query := `
-		SELECT group_id, group_name, created_by, created_at
-		FROM groups
-	`
-	rows, err := p.dbConn.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// groupKeyset pages group lists by creation time or name
+var groupKeyset = keyset[factory.Group]{
+	keys: map[string]sortKey[factory.Group]{
+		factory.SortCreatedAt: createdAtKey("created_at", func(g factory.Group) time.Time { return g.CreatedAt }),
+		"group_name": {
+			column: "COALESCE(group_name, '')",
+			cast:   "text",
+			value:  func(g factory.Group) string { return g.GroupName },
+		},
+	},
+	id:      "group_id",
+	idOf:    func(g factory.Group) int { return g.GroupID },
+	created: "created_at",
+}
 
-	var groups []factory.Group
-	for rows.Next() {
-		var group factory.Group
-		err := rows.Scan(&group.GroupID, &group.GroupName, &group.CreatedBy, &group.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		groups = append(groups, group)
-	}
+func scanGroupRow(rows *sql.Rows) (factory.Group, error) {
+	var group factory.Group
+	err := rows.Scan(&group.GroupID, &group.GroupName, &group.DefaultCurrency, &group.CreatedBy, &group.CreatedAt, &group.DeletedAt, &group.DeletedBy, &group.ArchivedAt, &group.ArchivedBy)
+	return group, err
+}
 
-	return groups, nil
+// GetAllGroups retrieves a page of all groups, leaving out deleted ones unless
+// includeDeleted is set.
+func (p *Postgres) GetAllGroups(includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Group], error) {
+	query := `
+		SELECT group_id, COALESCE(group_name, ''), default_currency, created_by, created_at, deleted_at, deleted_by, archived_at, archived_by
+		FROM groups
+		WHERE ($1 OR deleted_at IS NULL)`
+	return groupKeyset.list(p.dbConn, query, []interface{}{includeDeleted}, page, scanGroupRow)
 }
 
 // UpdateGroup updates an existing group's details.
@@ -96,12 +140,23 @@ func (p *Postgres) UpdateGroup(group factory.Group) error {
 		return errors.New("invalid group data")
 	}
 
+	// Keep the current currency unless a new one is given
+	var currency *string
+	if group.DefaultCurrency != "" {
+		code, err := factory.NormalizeCurrency(group.DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		currency = &code
+	}
+
 	query := `
 		UPDATE groups
-		SET group_name = $1
-		WHERE group_id = $2
+		SET group_name = $1,
+		    default_currency = COALESCE($2, default_currency)
+		WHERE group_id = $3 AND deleted_at IS NULL
 	`
-	result, err := p.dbConn.Exec(query, group.GroupName, group.GroupID)
+	result, err := p.dbConn.Exec(query, group.GroupName, currency, group.GroupID)
 	if err != nil {
 		return err
 	}
@@ -117,17 +172,25 @@ func (p *Postgres) UpdateGroup(group factory.Group) error {
 	return nil
 }
 
-// DeleteGroup deletes a group by its ID.
-func (p *Postgres) DeleteGroup(groupID int) error {
+// DeleteGroup soft deletes a group by its ID. Its members, transactions and
+// balances are kept so the group can be restored.
+func (p *Postgres) DeleteGroup(groupID int, deletedBy int) error {
 	if groupID <= 0 {
 		return errors.New("invalid group ID")
 	}
 
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		DELETE FROM groups
-		WHERE group_id = $1
+		UPDATE groups
+		SET deleted_at = NOW(), deleted_by = $2
+		WHERE group_id = $1 AND deleted_at IS NULL
 	`
-	result, err := p.dbConn.Exec(query, groupID)
+	result, err := tx.Exec(query, groupID, deletedBy)
 	if err != nil {
 		return err
 	}
@@ -137,13 +200,56 @@ func (p *Postgres) DeleteGroup(groupID int) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return errors.New("group not found")
+		return groups.ErrNotFound
 	}
 
-	return nil
+	err = insertGroupLog(tx, &factory.GroupLog{GroupID: groupID, Action: factory.GroupDeleted, PerformedBy: &deletedBy})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// GroupExists checks if a group with the given ID exists.
+// RestoreGroup brings back a soft deleted group.
+func (p *Postgres) RestoreGroup(groupID int, restoredBy int) error {
+	if groupID <= 0 {
+		return errors.New("invalid group ID")
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE groups
+		SET deleted_at = NULL, deleted_by = NULL
+		WHERE group_id = $1 AND deleted_at IS NOT NULL
+	`
+	result, err := tx.Exec(query, groupID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("deleted group not found")
+	}
+
+	err = insertGroupLog(tx, &factory.GroupLog{GroupID: groupID, Action: factory.GroupRestored, PerformedBy: &restoredBy})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GroupExists checks if a group with the given ID exists and is not deleted.
 func (p *Postgres) GroupExists(groupID int) (bool, error) {
 	if groupID <= 0 {
 		return false, errors.New("invalid group ID")
@@ -151,7 +257,7 @@ func (p *Postgres) GroupExists(groupID int) (bool, error) {
 
 	query := `
 		SELECT EXISTS (
-			SELECT 1 FROM groups WHERE group_id = $1
+			SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL
 		)
 	`
 	var exists bool
@@ -162,3 +268,245 @@ func (p *Postgres) GroupExists(groupID int) (bool, error) {
 
 	return exists, nil
 }
+
+// lockGroup locks a group that has not been deleted for the rest of tx and
+// reports whether it is archived.
+func lockGroup(tx *sql.Tx, groupID int) (archived bool, err error) {
+	err = tx.QueryRow(`
+		SELECT archived_at IS NOT NULL
+		FROM groups
+		WHERE group_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`,
+		groupID,
+	).Scan(&archived)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, groups.ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock group: %w", err)
+	}
+	return archived, nil
+}
+
+// archiveGroup marks a locked group archived inside tx and logs it
+func archiveGroup(tx *sql.Tx, groupID int, archivedBy int) error {
+	_, err := tx.Exec(`UPDATE groups SET archived_at = NOW(), archived_by = $2 WHERE group_id = $1`, groupID, archivedBy)
+	if err != nil {
+		return fmt.Errorf("failed to archive group: %w", err)
+	}
+	return insertGroupLog(tx, &factory.GroupLog{GroupID: groupID, Action: factory.GroupArchived, PerformedBy: &archivedBy})
+}
+
+// ArchiveGroup makes a group read-only. Everything in it stays visible and
+// members can still settle up, but nothing new can be added or changed until
+// it is unarchived.
+func (p *Postgres) ArchiveGroup(groupID int, archivedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archived, err := lockGroup(tx, groupID)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return groups.ErrArchived
+	}
+
+	if err := archiveGroup(tx, groupID, archivedBy); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnarchiveGroup makes an archived group writable again.
+func (p *Postgres) UnarchiveGroup(groupID int, unarchivedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archived, err := lockGroup(tx, groupID)
+	if err != nil {
+		return err
+	}
+	if !archived {
+		return groups.ErrNotArchived
+	}
+
+	_, err = tx.Exec(`UPDATE groups SET archived_at = NULL, archived_by = NULL WHERE group_id = $1`, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to unarchive group: %w", err)
+	}
+
+	err = insertGroupLog(tx, &factory.GroupLog{GroupID: groupID, Action: factory.GroupUnarchived, PerformedBy: &unarchivedBy})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CloseOutGroup archives a group and works out its final settle-up plan from
+// the ledger. The plan is stored in the group's history so members can pay it
+// off later. Closing out an archived group again records a fresh plan, e.g.
+// after some of the transfers have been paid.
+func (p *Postgres) CloseOutGroup(groupID int, closedBy int) (groups.CloseOut, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return groups.CloseOut{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archived, err := lockGroup(tx, groupID)
+	if err != nil {
+		return groups.CloseOut{}, err
+	}
+
+	balances, err := queryNetBalances(tx, groupNetBalancesQuery, groupID)
+	if err != nil {
+		return groups.CloseOut{}, err
+	}
+	transfers, err := settleup.Plan(balances)
+	if err != nil {
+		return groups.CloseOut{}, fmt.Errorf("%w: %v", groups.ErrUnbalancedGroup, err)
+	}
+	closeOut := groups.CloseOut{GroupID: groupID, Balances: balances, Transfers: transfers}
+
+	if !archived {
+		if err := archiveGroup(tx, groupID, closedBy); err != nil {
+			return groups.CloseOut{}, err
+		}
+	}
+
+	plan, err := json.Marshal(closeOut)
+	if err != nil {
+		return groups.CloseOut{}, fmt.Errorf("failed to encode close-out plan: %w", err)
+	}
+	details := string(plan)
+	err = insertGroupLog(tx, &factory.GroupLog{GroupID: groupID, Action: factory.GroupClosedOut, Details: &details, PerformedBy: &closedBy})
+	if err != nil {
+		return groups.CloseOut{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return groups.CloseOut{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return closeOut, nil
+}
+
+// purgeSteps empties everything that belongs to group $1, children before
+// parents so no foreign key is ever violated. The group's own row goes last.
+var purgeSteps = []struct {
+	table string
+	query string
+}{
+	{"payment_notifications", `
+		DELETE FROM payment_notifications
+		WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE group_id = $1)
+		   OR request_id IN (SELECT request_id FROM requests WHERE group_id = $1)
+		   OR settlement_id IN (SELECT settlement_id FROM settlements WHERE group_id = $1)
+		   OR invitation_id IN (SELECT invitation_id FROM group_invitations WHERE group_id = $1)`},
+	{"recurring_expense_occurrences", `DELETE FROM recurring_expense_occurrences WHERE recurring_expense_id IN (SELECT recurring_expense_id FROM recurring_expenses WHERE group_id = $1)`},
+	{"recurring_expense_splits", `DELETE FROM recurring_expense_splits WHERE recurring_expense_id IN (SELECT recurring_expense_id FROM recurring_expenses WHERE group_id = $1)`},
+	{"recurring_expenses", `DELETE FROM recurring_expenses WHERE group_id = $1`},
+	{"transaction_splits", `DELETE FROM transaction_splits WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE group_id = $1)`},
+	{"transaction_logs", `DELETE FROM transaction_logs WHERE transaction_id IN (SELECT transaction_id FROM transactions WHERE group_id = $1)`},
+	{"transactions", `DELETE FROM transactions WHERE group_id = $1`},
+	{"settlements", `DELETE FROM settlements WHERE group_id = $1`},
+	{"requests", `DELETE FROM requests WHERE group_id = $1`},
+	{"balance_adjustments", `DELETE FROM balance_adjustments WHERE balance_id IN (SELECT balance_id FROM balances WHERE group_id = $1)`},
+	{"balances", `DELETE FROM balances WHERE group_id = $1`},
+	{"group_leave_requests", `DELETE FROM group_leave_requests WHERE group_id = $1`},
+	{"group_join_requests", `DELETE FROM group_join_requests WHERE group_id = $1`},
+	{"group_join_codes", `DELETE FROM group_join_codes WHERE group_id = $1`},
+	{"group_invitations", `DELETE FROM group_invitations WHERE group_id = $1`},
+	{"group_members", `DELETE FROM group_members WHERE group_id = $1`},
+	{"groups", `DELETE FROM groups WHERE group_id = $1`},
+}
+
+// PurgeGroup permanently deletes a group, soft deleted or not, and everything
+// recorded in it. The group must be closed out and archived with every net
+// balance at zero, unless force is set, in which case what was outstanding is
+// logged first. The steps run in purgeSteps order inside one transaction and
+// each one is logged with the number of rows it removed, so either the whole
+// group goes or nothing does. The group's history is kept.
+func (p *Postgres) PurgeGroup(groupID int, purgedBy int, force bool) ([]factory.GroupLog, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var archived, closedOut bool
+	err = tx.QueryRow(`
+		SELECT archived_at IS NOT NULL,
+		       EXISTS (SELECT 1 FROM group_logs WHERE group_id = $1 AND action = $2)
+		FROM groups WHERE group_id = $1 FOR UPDATE`,
+		groupID, factory.GroupClosedOut,
+	).Scan(&archived, &closedOut)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, groups.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock group: %w", err)
+	}
+
+	balances, err := queryNetBalances(tx, groupNetBalancesQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+	var outstanding []string
+	for _, balance := range balances {
+		if balance.Net != 0 {
+			outstanding = append(outstanding, fmt.Sprintf("user %d %s %s", balance.UserID, balance.Net, balance.Currency))
+		}
+	}
+
+	logs := make([]factory.GroupLog, 0, len(purgeSteps)+1)
+	switch {
+	case force:
+		left := "none"
+		if len(outstanding) > 0 {
+			left = strings.Join(outstanding, ", ")
+		}
+		details := fmt.Sprintf("closed out: %t, archived: %t, outstanding: %s", closedOut, archived, left)
+		log := factory.GroupLog{GroupID: groupID, Action: factory.GroupPurgeForced, Details: &details, PerformedBy: &purgedBy}
+		if err := insertGroupLog(tx, &log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	case !closedOut || !archived:
+		return nil, groups.ErrNotClosedOut
+	case len(outstanding) > 0:
+		return nil, groups.ErrOutstandingBalances
+	}
+	for _, step := range purgeSteps {
+		result, err := tx.Exec(step.query, groupID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge %s: %w", step.table, err)
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		details := fmt.Sprintf("deleted %d rows from %s", removed, step.table)
+		log := factory.GroupLog{GroupID: groupID, Action: factory.GroupPurged, Details: &details, PerformedBy: &purgedBy}
+		if err := insertGroupLog(tx, &log); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return logs, nil
+}
@@ -0,0 +1,637 @@
+package postgres
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/invitation"
+)
+
+// insertGroupMember adds the user to the group inside tx. A former member
+// comes back as a fresh member on their old row; joining while still active
+// is ErrAlreadyMember.
+func insertGroupMember(tx *sql.Tx, groupID, userID int) (int, error) {
+	var groupMemberID int
+	err := tx.QueryRow(`
+		INSERT INTO group_members (group_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (group_id, user_id) DO UPDATE
+		SET role = 'member', joined_date = NOW(), left_at = NULL, removed_by = NULL
+		WHERE group_members.left_at IS NOT NULL
+		RETURNING group_member_id`,
+		groupID, userID,
+	).Scan(&groupMemberID)
+	if err == sql.ErrNoRows {
+		return 0, invitation.ErrAlreadyMember
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert group member: %w", err)
+	}
+	return groupMemberID, nil
+}
+
+// groupName returns the group's name inside tx, for notification text
+func groupName(tx *sql.Tx, groupID int) (string, error) {
+	var name sql.NullString
+	if err := tx.QueryRow(`SELECT group_name FROM groups WHERE group_id = $1`, groupID).Scan(&name); err != nil {
+		return "", fmt.Errorf("failed to get group %d: %w", groupID, err)
+	}
+	return name.String, nil
+}
+
+// Pending invitations past their expiry are reported as expired
+const selectInvitation = `
+	SELECT invitation_id, group_id, invited_by, invitee_id, invitee_email,
+	       CASE WHEN status = 'pending' AND expires_at <= NOW() THEN 'expired' ELSE status END,
+	       expires_at, responded_at, created_at
+	FROM group_invitations `
+
+func scanInvitation(row interface{ Scan(...interface{}) error }) (factory.Invitation, error) {
+	var i factory.Invitation
+	err := row.Scan(
+		&i.InvitationID,
+		&i.GroupID,
+		&i.InvitedBy,
+		&i.InviteeID,
+		&i.InviteeEmail,
+		&i.Status,
+		&i.ExpiresAt,
+		&i.RespondedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+func (p *Postgres) queryInvitations(query string, args ...interface{}) ([]factory.Invitation, error) {
+	rows, err := p.dbConn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []factory.Invitation{}
+	for rows.Next() {
+		i, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// CreateInvitation checks that the group exists, that the invitee is not
+// already in it and has no open invitation, then stores the invitation with
+// an in-app notification and the given emails in one transaction.
+func (p *Postgres) CreateInvitation(i factory.Invitation, messages ...factory.OutboxMessage) (factory.Invitation, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return i, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var groupExists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL)`, i.GroupID).Scan(&groupExists)
+	if err != nil {
+		return i, fmt.Errorf("failed to check group: %w", err)
+	}
+	if !groupExists {
+		return i, errors.New("group does not exist")
+	}
+
+	// Invitations by email reach existing users by ID as well
+	if i.InviteeEmail != nil {
+		email := strings.TrimSpace(*i.InviteeEmail)
+		i.InviteeEmail = &email
+		if i.InviteeID == nil {
+			var userID int
+			err = tx.QueryRow(`SELECT user_id FROM users WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL`, email).Scan(&userID)
+			if err == nil {
+				i.InviteeID = &userID
+			} else if err != sql.ErrNoRows {
+				return i, fmt.Errorf("failed to look up invitee: %w", err)
+			}
+		}
+	}
+	if i.InviteeID != nil {
+		var userExists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`, *i.InviteeID).Scan(&userExists)
+		if err != nil {
+			return i, fmt.Errorf("failed to check invitee: %w", err)
+		}
+		if !userExists {
+			return i, errors.New("user does not exist")
+		}
+	}
+
+	var isMember, isInvited bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2 AND left_at IS NULL),
+			EXISTS (
+				SELECT 1 FROM group_invitations
+				WHERE group_id = $1 AND status = 'pending' AND expires_at > NOW()
+				  AND (invitee_id = $2 OR LOWER(invitee_email) = LOWER($3))
+			)`,
+		i.GroupID, i.InviteeID, i.InviteeEmail,
+	).Scan(&isMember, &isInvited)
+	if err != nil {
+		return i, fmt.Errorf("failed to check membership: %w", err)
+	}
+	if isMember {
+		return i, invitation.ErrAlreadyMember
+	}
+	if isInvited {
+		return i, invitation.ErrAlreadyInvited
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO group_invitations (group_id, invited_by, invitee_id, invitee_email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING invitation_id, status, created_at`,
+		i.GroupID, i.InvitedBy, i.InviteeID, i.InviteeEmail, i.ExpiresAt,
+	).Scan(&i.InvitationID, &i.Status, &i.CreatedAt)
+	if err != nil {
+		return i, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	if i.InviteeID != nil {
+		inviter, err := userName(tx, i.InvitedBy)
+		if err != nil {
+			return i, err
+		}
+		group, err := groupName(tx, i.GroupID)
+		if err != nil {
+			return i, err
+		}
+		err = insertNotification(tx, factory.Notification{
+			UserID:           *i.InviteeID,
+			InvitationID:     &i.InvitationID,
+			NotificationType: factory.NotificationInvitation,
+			Message:          fmt.Sprintf("%s invited you to join %s", inviter, group),
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+
+	if err := insertOutbox(tx, messages); err != nil {
+		return i, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return i, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return i, nil
+}
+
+func (p *Postgres) GetInvitation(invitationID int) (factory.Invitation, error) {
+	i, err := scanInvitation(p.dbConn.QueryRow(selectInvitation+`WHERE invitation_id = $1`, invitationID))
+	if err == sql.ErrNoRows {
+		return i, invitation.ErrInvitationNotFound
+	}
+	if err != nil {
+		return i, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return i, nil
+}
+
+func (p *Postgres) ListInvitationsForUser(userID int, email string) ([]factory.Invitation, error) {
+	return p.queryInvitations(selectInvitation+`
+		WHERE status = 'pending' AND expires_at > NOW()
+		  AND (invitee_id = $1 OR LOWER(invitee_email) = LOWER($2))
+		  AND group_id IN (SELECT group_id FROM groups WHERE deleted_at IS NULL)
+		ORDER BY created_at DESC, invitation_id DESC`,
+		userID, email,
+	)
+}
+
+func (p *Postgres) ListInvitationsForGroup(groupID int) ([]factory.Invitation, error) {
+	return p.queryInvitations(selectInvitation+`
+		WHERE group_id = $1
+		ORDER BY created_at DESC, invitation_id DESC`,
+		groupID,
+	)
+}
+
+// respondToInvitation locks a pending invitation addressed to the user and
+// records their answer. Invitations addressed to someone else are reported as
+// not found so their existence is not given away.
+func respondToInvitation(tx *sql.Tx, invitationID, userID int, email, status string) (factory.Invitation, error) {
+	i, err := scanInvitation(tx.QueryRow(selectInvitation+`WHERE invitation_id = $1 FOR UPDATE`, invitationID))
+	if err == sql.ErrNoRows {
+		return i, invitation.ErrInvitationNotFound
+	}
+	if err != nil {
+		return i, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	addressed := i.InviteeID != nil && *i.InviteeID == userID
+	if i.InviteeEmail != nil && email != "" && strings.EqualFold(*i.InviteeEmail, email) {
+		addressed = true
+	}
+	if !addressed {
+		return i, invitation.ErrInvitationNotFound
+	}
+	if i.Status != factory.InvitationPending {
+		return i, invitation.ErrInvitationClosed
+	}
+
+	err = tx.QueryRow(`
+		UPDATE group_invitations
+		SET status = $2, invitee_id = $3, responded_at = NOW()
+		WHERE invitation_id = $1
+		RETURNING status, invitee_id, responded_at`,
+		invitationID, status, userID,
+	).Scan(&i.Status, &i.InviteeID, &i.RespondedAt)
+	if err != nil {
+		return i, fmt.Errorf("failed to update invitation: %w", err)
+	}
+	return i, nil
+}
+
+// AcceptInvitation adds the invitee to the group and closes the invitation in
+// one transaction
+func (p *Postgres) AcceptInvitation(invitationID, userID int, email string) (int, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	i, err := respondToInvitation(tx, invitationID, userID, email, factory.InvitationAccepted)
+	if err != nil {
+		return 0, err
+	}
+
+	// Archived groups take no new members
+	var groupExists bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL AND archived_at IS NULL)`, i.GroupID).Scan(&groupExists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check group: %w", err)
+	}
+	if !groupExists {
+		return 0, invitation.ErrInvitationClosed
+	}
+
+	groupMemberID, err := insertGroupMember(tx, i.GroupID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return groupMemberID, nil
+}
+
+func (p *Postgres) DeclineInvitation(invitationID, userID int, email string) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := respondToInvitation(tx, invitationID, userID, email, factory.InvitationDeclined); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) RevokeInvitation(invitationID int) error {
+	result, err := p.dbConn.Exec(`
+		UPDATE group_invitations
+		SET status = 'revoked', responded_at = NOW()
+		WHERE invitation_id = $1 AND status = 'pending'`,
+		invitationID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	if rows == 0 {
+		return invitation.ErrInvitationClosed
+	}
+	return nil
+}
+
+// joinCodeAlphabet leaves out characters that are easy to misread
+const joinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newJoinCode returns a random eight character join code
+func newJoinCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate join code: %w", err)
+	}
+	for i := range b {
+		b[i] = joinCodeAlphabet[int(b[i])%len(joinCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+const selectJoinCode = `
+	SELECT join_code_id, group_id, code, requires_approval, max_uses, uses,
+	       expires_at, created_by, revoked_at, created_at
+	FROM group_join_codes `
+
+func scanJoinCode(row interface{ Scan(...interface{}) error }) (factory.JoinCode, error) {
+	var c factory.JoinCode
+	err := row.Scan(
+		&c.JoinCodeID,
+		&c.GroupID,
+		&c.Code,
+		&c.RequiresApproval,
+		&c.MaxUses,
+		&c.Uses,
+		&c.ExpiresAt,
+		&c.CreatedBy,
+		&c.RevokedAt,
+		&c.CreatedAt,
+	)
+	return c, err
+}
+
+// CreateJoinCode stores a new join code, drawing another code in the unlikely
+// case the first is taken
+func (p *Postgres) CreateJoinCode(c factory.JoinCode) (factory.JoinCode, error) {
+	groupExists, err := p.CheckGroupExists(c.GroupID)
+	if err != nil {
+		return c, fmt.Errorf("failed to check group: %w", err)
+	}
+	if !groupExists {
+		return c, errors.New("group does not exist")
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		code, err := newJoinCode()
+		if err != nil {
+			return c, err
+		}
+		created, err := scanJoinCode(p.dbConn.QueryRow(`
+			INSERT INTO group_join_codes (group_id, code, requires_approval, max_uses, expires_at, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (code) DO NOTHING
+			RETURNING join_code_id, group_id, code, requires_approval, max_uses, uses,
+			          expires_at, created_by, revoked_at, created_at`,
+			c.GroupID, code, c.RequiresApproval, c.MaxUses, c.ExpiresAt, c.CreatedBy,
+		))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return c, fmt.Errorf("failed to create join code: %w", err)
+		}
+		return created, nil
+	}
+	return c, errors.New("failed to create join code: no free code found")
+}
+
+func (p *Postgres) GetJoinCode(code string) (factory.JoinCode, error) {
+	c, err := scanJoinCode(p.dbConn.QueryRow(selectJoinCode+`WHERE code = $1`, strings.ToUpper(code)))
+	if err == sql.ErrNoRows {
+		return c, invitation.ErrJoinCodeInvalid
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to get join code: %w", err)
+	}
+	return c, nil
+}
+
+func (p *Postgres) ListJoinCodes(groupID int) ([]factory.JoinCode, error) {
+	rows, err := p.dbConn.Query(selectJoinCode+`WHERE group_id = $1 ORDER BY created_at DESC, join_code_id DESC`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join codes: %w", err)
+	}
+	defer rows.Close()
+
+	codes := []factory.JoinCode{}
+	for rows.Next() {
+		c, err := scanJoinCode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan join code: %w", err)
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+func (p *Postgres) RevokeJoinCode(code string) error {
+	result, err := p.dbConn.Exec(`UPDATE group_join_codes SET revoked_at = NOW() WHERE code = $1 AND revoked_at IS NULL`, strings.ToUpper(code))
+	if err != nil {
+		return fmt.Errorf("failed to revoke join code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke join code: %w", err)
+	}
+	if rows == 0 {
+		return invitation.ErrJoinCodeInvalid
+	}
+	return nil
+}
+
+const selectJoinRequest = `
+	SELECT join_request_id, group_id, user_id, join_code_id, status, decided_by, decided_at, created_at
+	FROM group_join_requests `
+
+func scanJoinRequest(row interface{ Scan(...interface{}) error }) (factory.JoinRequest, error) {
+	var r factory.JoinRequest
+	err := row.Scan(
+		&r.JoinRequestID,
+		&r.GroupID,
+		&r.UserID,
+		&r.JoinCodeID,
+		&r.Status,
+		&r.DecidedBy,
+		&r.DecidedAt,
+		&r.CreatedAt,
+	)
+	return r, err
+}
+
+// JoinWithCode uses up one use of the code. Without approval the user joins
+// right away; otherwise a pending request is left for the group's admins, or
+// the user's existing pending request is returned.
+func (p *Postgres) JoinWithCode(code string, userID int) (factory.JoinRequest, error) {
+	var request factory.JoinRequest
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return request, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	c, err := scanJoinCode(tx.QueryRow(selectJoinCode+`
+		WHERE code = $1 AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > NOW())
+		  AND (max_uses IS NULL OR uses < max_uses)
+		  AND group_id IN (SELECT group_id FROM groups WHERE deleted_at IS NULL AND archived_at IS NULL)
+		FOR UPDATE`,
+		strings.ToUpper(code),
+	))
+	if err == sql.ErrNoRows {
+		return request, invitation.ErrJoinCodeInvalid
+	}
+	if err != nil {
+		return request, fmt.Errorf("failed to get join code: %w", err)
+	}
+
+	var isMember bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2 AND left_at IS NULL)`, c.GroupID, userID).Scan(&isMember)
+	if err != nil {
+		return request, fmt.Errorf("failed to check membership: %w", err)
+	}
+	if isMember {
+		return request, invitation.ErrAlreadyMember
+	}
+
+	if c.RequiresApproval {
+		request, err = scanJoinRequest(tx.QueryRow(selectJoinRequest+`WHERE group_id = $1 AND user_id = $2 AND status = 'pending'`, c.GroupID, userID))
+		if err == nil {
+			return request, nil
+		}
+		if err != sql.ErrNoRows {
+			return request, fmt.Errorf("failed to get join request: %w", err)
+		}
+	}
+
+	status := factory.JoinRequestApproved
+	if c.RequiresApproval {
+		status = factory.JoinRequestPending
+	}
+	request, err = scanJoinRequest(tx.QueryRow(`
+		INSERT INTO group_join_requests (group_id, user_id, join_code_id, status, decided_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 = 'approved' THEN NOW() END)
+		RETURNING join_request_id, group_id, user_id, join_code_id, status, decided_by, decided_at, created_at`,
+		c.GroupID, userID, c.JoinCodeID, status,
+	))
+	if err != nil {
+		return request, fmt.Errorf("failed to create join request: %w", err)
+	}
+
+	if _, err = tx.Exec(`UPDATE group_join_codes SET uses = uses + 1 WHERE join_code_id = $1`, c.JoinCodeID); err != nil {
+		return request, fmt.Errorf("failed to use join code: %w", err)
+	}
+
+	if c.RequiresApproval {
+		// Let the group's owner know someone is waiting
+		var ownerID int
+		if err = tx.QueryRow(`SELECT user_id FROM group_members WHERE group_id = $1 AND role = 'owner'`, c.GroupID).Scan(&ownerID); err != nil {
+			return request, fmt.Errorf("failed to get group owner: %w", err)
+		}
+		name, err := userName(tx, userID)
+		if err != nil {
+			return request, err
+		}
+		group, err := groupName(tx, c.GroupID)
+		if err != nil {
+			return request, err
+		}
+		err = insertNotification(tx, factory.Notification{
+			UserID:           ownerID,
+			NotificationType: factory.NotificationJoinRequest,
+			Message:          fmt.Sprintf("%s asked to join %s", name, group),
+		})
+		if err != nil {
+			return request, err
+		}
+	} else if _, err = insertGroupMember(tx, c.GroupID, userID); err != nil {
+		return request, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return request, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
+}
+
+func (p *Postgres) GetJoinRequest(joinRequestID int) (factory.JoinRequest, error) {
+	r, err := scanJoinRequest(p.dbConn.QueryRow(selectJoinRequest+`WHERE join_request_id = $1`, joinRequestID))
+	if err == sql.ErrNoRows {
+		return r, invitation.ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return r, fmt.Errorf("failed to get join request: %w", err)
+	}
+	return r, nil
+}
+
+func (p *Postgres) ListJoinRequests(groupID int) ([]factory.JoinRequest, error) {
+	rows, err := p.dbConn.Query(selectJoinRequest+`WHERE group_id = $1 AND status = 'pending' ORDER BY created_at, join_request_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []factory.JoinRequest{}
+	for rows.Next() {
+		r, err := scanJoinRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan join request: %w", err)
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// DecideJoinRequest approves or rejects a pending request, adding the member
+// on approval, and tells the requester the outcome
+func (p *Postgres) DecideJoinRequest(joinRequestID int, approve bool, decidedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := scanJoinRequest(tx.QueryRow(selectJoinRequest+`WHERE join_request_id = $1 FOR UPDATE`, joinRequestID))
+	if err == sql.ErrNoRows {
+		return invitation.ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get join request: %w", err)
+	}
+	if r.Status != factory.JoinRequestPending {
+		return invitation.ErrJoinRequestClosed
+	}
+
+	status, outcome := factory.JoinRequestRejected, "declined"
+	if approve {
+		status, outcome = factory.JoinRequestApproved, "approved"
+		if _, err := insertGroupMember(tx, r.GroupID, r.UserID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE group_join_requests
+		SET status = $2, decided_by = $3, decided_at = NOW()
+		WHERE join_request_id = $1`,
+		joinRequestID, status, decidedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %w", err)
+	}
+
+	group, err := groupName(tx, r.GroupID)
+	if err != nil {
+		return err
+	}
+	err = insertNotification(tx, factory.Notification{
+		UserID:           r.UserID,
+		NotificationType: factory.NotificationJoinRequest,
+		Message:          fmt.Sprintf("Your request to join %s was %s", group, outcome),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// ledgerDebts turns transactions, their splits and settlements into one row per
+// debt (debtor_id owes creditor_id amount of currency in group_id):
+//   - each split owes the transaction's lender its share (the lender's own
+//     split is not a debt)
+//   - a transaction without splits is owed entirely by its borrower
+//   - a settlement reduces what its payer owes the counterparty
+//
+// Failed and deleted transactions are ignored and amounts in different currencies are never
+// added together. These are the same rules CreateTransaction, CreateExpense,
+// SplitTransaction and RecordSettlement apply to the stored balances rows, and
+// that status changes, deletes and restores undo or reapply.
+const ledgerDebts = `
+	ledger_debts AS (
+		SELECT s.user_id AS debtor_id, t.lender_id AS creditor_id, t.group_id, t.currency, s.amount
+		FROM transaction_splits s
+		JOIN transactions t ON t.transaction_id = s.transaction_id
+		WHERE s.user_id <> t.lender_id AND t.status IS DISTINCT FROM 'failed' AND t.deleted_at IS NULL
+		UNION ALL
+		SELECT t.borrower_id, t.lender_id, t.group_id, t.currency, t.amount
+		FROM transactions t
+		WHERE t.borrower_id <> t.lender_id AND t.status IS DISTINCT FROM 'failed' AND t.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = t.transaction_id)
+		UNION ALL
+		SELECT user_id, counterparty_id, group_id, currency, -amount
+		FROM settlements
+	),
+	ledger_balances AS (
+		SELECT user_id, group_id, currency, SUM(owed) AS owed_amount, SUM(lent) AS lent_amount
+		FROM (
+			SELECT debtor_id AS user_id, group_id, currency, amount AS owed, 0 AS lent FROM ledger_debts
+			UNION ALL
+			SELECT creditor_id, group_id, currency, 0, amount FROM ledger_debts
+		) entries
+		GROUP BY user_id, group_id, currency
+	)
+`
+
+// GetGroupNetBalances works out every user's net position in a group from the
+// ledger, one row per currency. Positive means the rest of the group owes the
+// user money.
+func (p *Postgres) GetGroupNetBalances(groupID int) ([]factory.NetBalance, error) {
+	// Ensure the group exists
+	groupExists, err := p.CheckGroupExists(groupID)
+	if err != nil || !groupExists {
+		return nil, errors.New("group not found")
+	}
+
+	return queryNetBalances(p.dbConn, groupNetBalancesQuery, groupID)
+}
+
+// groupNetBalancesQuery lists every user's net position in group $1
+var groupNetBalancesQuery = `WITH ` + ledgerDebts + `
+	SELECT user_id, group_id, currency, owed_amount, lent_amount, lent_amount - owed_amount
+	FROM ledger_balances
+	WHERE group_id = $1
+	ORDER BY currency, user_id
+`
+
+// GetUserNetBalances works out the user's net position in every group and
+// currency they have ledger entries in. Debts outside any group have a nil
+// group ID.
+func (p *Postgres) GetUserNetBalances(userID int) ([]factory.NetBalance, error) {
+	// Ensure the user exists
+	userExists, err := p.CheckUserExists(userID)
+	if err != nil || !userExists {
+		return nil, errors.New("user not found")
+	}
+
+	query := `WITH ` + ledgerDebts + `
+		SELECT user_id, group_id, currency, owed_amount, lent_amount, lent_amount - owed_amount
+		FROM ledger_balances
+		WHERE user_id = $1
+		ORDER BY group_id NULLS FIRST, currency
+	`
+	return queryNetBalances(p.dbConn, query, userID)
+}
+
+// GetPairwiseBalance works out what two users owe each other in each currency,
+// across all groups or within one group when groupID is given.
+func (p *Postgres) GetPairwiseBalance(userID, otherUserID int, groupID *int) ([]factory.PairwiseBalance, error) {
+	if userID <= 0 || otherUserID <= 0 || userID == otherUserID {
+		return nil, errors.New("invalid input: two different user IDs are required")
+	}
+
+	query := `WITH ` + ledgerDebts + `
+		SELECT currency, lent_amount, owed_amount, lent_amount - owed_amount
+		FROM (
+			SELECT
+				currency,
+				COALESCE(SUM(amount) FILTER (WHERE debtor_id = $2 AND creditor_id = $1), 0) AS lent_amount,
+				COALESCE(SUM(amount) FILTER (WHERE debtor_id = $1 AND creditor_id = $2), 0) AS owed_amount
+			FROM ledger_debts
+			WHERE ((debtor_id = $1 AND creditor_id = $2) OR (debtor_id = $2 AND creditor_id = $1))
+			  AND ($3::int IS NULL OR group_id = $3)
+			GROUP BY currency
+		) pair
+		ORDER BY currency
+	`
+	rows, err := p.dbConn.Query(query, userID, otherUserID, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pairwise balance: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []factory.PairwiseBalance{}
+	for rows.Next() {
+		balance := factory.PairwiseBalance{
+			UserID:      userID,
+			OtherUserID: otherUserID,
+			GroupID:     groupID,
+		}
+		err := rows.Scan(&balance.Currency, &balance.LentAmount, &balance.OwedAmount, &balance.Net)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pairwise balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate pairwise balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// ReconcileBalances compares the stored balances rows with the balances
+// recomputed from the ledger and returns every user and group where they differ.
+func (p *Postgres) ReconcileBalances() ([]factory.BalanceDiscrepancy, error) {
+	query := `WITH ` + ledgerDebts + `,
+		stored_balances AS (
+			SELECT user_id, group_id, currency,
+			       SUM(COALESCE(owed_amount, 0)) AS owed_amount,
+			       SUM(COALESCE(lent_amount, 0)) AS lent_amount
+			FROM balances
+			GROUP BY user_id, group_id, currency
+		)
+		SELECT
+			COALESCE(s.user_id, l.user_id),
+			COALESCE(s.group_id, l.group_id),
+			COALESCE(s.currency, l.currency),
+			COALESCE(s.owed_amount, 0), COALESCE(s.lent_amount, 0),
+			COALESCE(l.owed_amount, 0), COALESCE(l.lent_amount, 0)
+		FROM stored_balances s
+		FULL OUTER JOIN ledger_balances l
+			ON l.user_id = s.user_id AND l.group_id IS NOT DISTINCT FROM s.group_id AND l.currency = s.currency
+		WHERE COALESCE(s.owed_amount, 0) <> COALESCE(l.owed_amount, 0)
+		   OR COALESCE(s.lent_amount, 0) <> COALESCE(l.lent_amount, 0)
+		ORDER BY 1, 2 NULLS FIRST, 3
+	`
+	rows, err := p.dbConn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile balances: %w", err)
+	}
+	defer rows.Close()
+
+	discrepancies := []factory.BalanceDiscrepancy{}
+	for rows.Next() {
+		var discrepancy factory.BalanceDiscrepancy
+		err := rows.Scan(
+			&discrepancy.UserID,
+			&discrepancy.GroupID,
+			&discrepancy.Currency,
+			&discrepancy.StoredOwedAmount,
+			&discrepancy.StoredLentAmount,
+			&discrepancy.LedgerOwedAmount,
+			&discrepancy.LedgerLentAmount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan balance discrepancy: %w", err)
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate balance discrepancies: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// querier runs read queries on either the connection pool or a transaction
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryNetBalances(db querier, query string, args ...interface{}) ([]factory.NetBalance, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query net balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := []factory.NetBalance{}
+	for rows.Next() {
+		var balance factory.NetBalance
+		err := rows.Scan(&balance.UserID, &balance.GroupID, &balance.Currency, &balance.OwedAmount, &balance.LentAmount, &balance.Net)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan net balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate net balances: %w", err)
+	}
+
+	return balances, nil
+}
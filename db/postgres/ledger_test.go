@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/transaction"
+)
+
+// requireReconciled fails the test when the stored balances differ from the ledger
+func requireReconciled(t *testing.T, p *Postgres) {
+	t.Helper()
+	discrepancies, err := p.ReconcileBalances()
+	if err != nil {
+		t.Fatalf("ReconcileBalances() error = %v", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("ReconcileBalances() = %+v, want no discrepancies", discrepancies)
+	}
+}
+
+func TestReconcilePlainTransactions(t *testing.T) {
+	p := newTestPostgres(t)
+	groupID := seedGroup(t, p, 3)
+	machine := transaction.StateMachine{MaxRetries: 3}
+
+	create := func(status string, amount factory.Money) int {
+		t.Helper()
+		id, err := p.CreateTransaction(&factory.Transaction{
+			LenderID:   1,
+			BorrowerID: 2,
+			GroupID:    groupID,
+			Amount:     amount,
+			Status:     status,
+		})
+		if err != nil {
+			t.Fatalf("CreateTransaction() error = %v", err)
+		}
+		return id
+	}
+	setStatus := func(id int, status string) error {
+		update := factory.StatusUpdate{Status: status, FailureReason: "declined"}
+		_, err := p.UpdateTransactionStatus(id, update, machine, 1)
+		return err
+	}
+
+	pending := create(transaction.StatusPending, 1000)
+	successful := create(transaction.StatusSuccessful, 250)
+	requireReconciled(t, p)
+
+	balances, err := p.GetGroupNetBalances(groupID)
+	if err != nil {
+		t.Fatalf("GetGroupNetBalances() error = %v", err)
+	}
+	for _, balance := range balances {
+		if balance.UserID == 2 && balance.Net != -1250 {
+			t.Errorf("borrower's net = %s, want -12.50", balance.Net)
+		}
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"fail", func() error { return setStatus(pending, transaction.StatusFailed) }},
+		{"retry", func() error { return setStatus(pending, transaction.StatusRetrying) }},
+		{"split", func() error {
+			return p.SplitTransaction(pending, []factory.TransactionSplit{
+				{UserID: 1, Amount: 400},
+				{UserID: 2, Amount: 300},
+				{UserID: 3, Amount: 300},
+			})
+		}},
+		{"fail after split", func() error { return setStatus(pending, transaction.StatusFailed) }},
+		{"delete", func() error { return p.DeleteTransaction(successful, 1) }},
+		{"restore", func() error { return p.RestoreTransaction(successful, 1) }},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := step.run(); err != nil {
+				t.Fatalf("%s error = %v", step.name, err)
+			}
+			requireReconciled(t, p)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/notification"
+)
+
+// insertNotification adds a notification inside tx, so it only appears if the
+// change it describes is committed.
+func insertNotification(tx *sql.Tx, n factory.Notification) error {
+	_, err := tx.Exec(`
+		INSERT INTO payment_notifications (user_id, transaction_id, request_id, settlement_id, invitation_id, notification_type, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		n.UserID, n.TransactionID, n.RequestID, n.SettlementID, n.InvitationID, n.NotificationType, n.Message,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add notification: %w", err)
+	}
+	return nil
+}
+
+// userName returns the user's display name inside tx, for notification text
+func userName(tx *sql.Tx, userID int) (string, error) {
+	var name string
+	if err := tx.QueryRow(`SELECT name FROM users WHERE user_id = $1`, userID).Scan(&name); err != nil {
+		return "", fmt.Errorf("failed to get user %d: %w", userID, err)
+	}
+	return name, nil
+}
+
+func (p *Postgres) GetNotifications(userID, limit, offset int) ([]factory.Notification, error) {
+	query := `
+		SELECT notification_id, user_id, transaction_id, request_id, settlement_id, invitation_id,
+			notification_type, message, is_read, read_at, created_at
+		FROM payment_notifications
+		WHERE user_id = $1
+		ORDER BY created_at DESC, notification_id DESC
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := p.dbConn.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []factory.Notification{}
+	for rows.Next() {
+		var n factory.Notification
+		err := rows.Scan(
+			&n.NotificationID,
+			&n.UserID,
+			&n.TransactionID,
+			&n.RequestID,
+			&n.SettlementID,
+			&n.InvitationID,
+			&n.NotificationType,
+			&n.Message,
+			&n.IsRead,
+			&n.ReadAt,
+			&n.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationRead keeps the original read_at when the notification was
+// already read
+func (p *Postgres) MarkNotificationRead(userID, notificationID int) error {
+	result, err := p.dbConn.Exec(`
+		UPDATE payment_notifications
+		SET is_read = TRUE, read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE notification_id = $1 AND user_id = $2`,
+		notificationID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	if affected == 0 {
+		return notification.ErrNotificationNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) MarkAllNotificationsRead(userID int) (int64, error) {
+	result, err := p.dbConn.Exec(`
+		UPDATE payment_notifications
+		SET is_read = TRUE, read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND is_read = FALSE`,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (p *Postgres) GetUnreadNotificationCount(userID int) (int, error) {
+	var count int
+	err := p.dbConn.QueryRow(
+		`SELECT COUNT(*) FROM payment_notifications WHERE user_id = $1 AND is_read = FALSE`,
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// insertOutbox queues messages inside tx so they are only sent if the change
+// they describe is committed.
+func insertOutbox(tx *sql.Tx, messages []factory.OutboxMessage) error {
+	for _, message := range messages {
+		_, err := tx.Exec(
+			`INSERT INTO outbox (recipient, subject, body, html_body) VALUES ($1, $2, $3, $4)`,
+			message.Recipient, message.Subject, message.Body, message.HTMLBody,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to queue email: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) Enqueue(messages ...factory.OutboxMessage) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertOutbox(tx, messages); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClaimDue uses SKIP LOCKED so several workers can drain the outbox without
+// picking up the same message.
+func (p *Postgres) ClaimDue(limit, maxAttempts int, lease time.Duration) ([]factory.OutboxMessage, error) {
+	query := `
+		UPDATE outbox
+		SET attempts = attempts + 1,
+			next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+		WHERE outbox_id IN (
+			SELECT outbox_id FROM outbox
+			WHERE sent_at IS NULL AND attempts < $2 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY outbox_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING outbox_id, recipient, subject, body, html_body, attempts, next_attempt_at, last_error, created_at
+	`
+	rows, err := p.dbConn.Query(query, limit, maxAttempts, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []factory.OutboxMessage
+	for rows.Next() {
+		var message factory.OutboxMessage
+		err := rows.Scan(
+			&message.OutboxID,
+			&message.Recipient,
+			&message.Subject,
+			&message.Body,
+			&message.HTMLBody,
+			&message.Attempts,
+			&message.NextAttemptAt,
+			&message.LastError,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (p *Postgres) MarkSent(outboxID int) error {
+	_, err := p.dbConn.Exec(
+		`UPDATE outbox SET sent_at = CURRENT_TIMESTAMP, last_error = NULL WHERE outbox_id = $1`,
+		outboxID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message %d as sent: %w", outboxID, err)
+	}
+	return nil
+}
+
+func (p *Postgres) MarkFailed(outboxID int, reason string, nextAttemptAt time.Time) error {
+	_, err := p.dbConn.Exec(
+		`UPDATE outbox SET last_error = $2, next_attempt_at = $3 WHERE outbox_id = $1`,
+		outboxID, reason, nextAttemptAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox failure for %d: %w", outboxID, err)
+	}
+	return nil
+}
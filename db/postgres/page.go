@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// sortKey is a column a list can be sorted on. cast is the Postgres type the
+// cursor value is read back as, and value renders a row's key for its cursor.
+type sortKey[T any] struct {
+	column string
+	cast   string
+	value  func(T) string
+}
+
+// keyset describes how a list is paged: the keys it can be sorted on, the
+// unique column that breaks ties between equal keys and the creation time
+// column date ranges apply to.
+type keyset[T any] struct {
+	keys    map[string]sortKey[T]
+	id      string
+	idOf    func(T) int
+	created string
+}
+
+// createdAtKey sorts on a creation timestamp column
+func createdAtKey[T any](column string, createdAt func(T) time.Time) sortKey[T] {
+	return sortKey[T]{
+		column: column,
+		cast:   "timestamp",
+		value:  func(item T) string { return createdAt(item).Format(time.RFC3339Nano) },
+	}
+}
+
+// list runs query for the page req selects and scans each row with scan. The
+// query must end in a WHERE clause whose placeholders are filled by args; the
+// date range, cursor, order and limit are added after it. One row more than
+// the limit is fetched to tell whether another page follows.
+func (k keyset[T]) list(db *sql.DB, query string, args []interface{}, req factory.PageRequest, scan func(*sql.Rows) (T, error)) (factory.Page[T], error) {
+	req = req.WithDefaults()
+	page := factory.Page[T]{Items: []T{}}
+
+	key, ok := k.keys[req.SortBy]
+	if !ok {
+		return page, fmt.Errorf("%w: cannot sort by %q", factory.ErrInvalidPage, req.SortBy)
+	}
+	direction, compare := "ASC", ">"
+	switch req.Order {
+	case factory.SortAsc:
+	case factory.SortDesc:
+		direction, compare = "DESC", "<"
+	default:
+		return page, fmt.Errorf("%w: order must be %s or %s", factory.ErrInvalidPage, factory.SortAsc, factory.SortDesc)
+	}
+
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if req.CreatedFrom != nil {
+		query += fmt.Sprintf(" AND %s >= %s", k.created, arg(*req.CreatedFrom))
+	}
+	if req.CreatedTo != nil {
+		query += fmt.Sprintf(" AND %s < %s", k.created, arg(*req.CreatedTo))
+	}
+	if req.Cursor != "" {
+		cursor, err := factory.DecodeCursor(req.Cursor)
+		if err != nil {
+			return page, err
+		}
+		if cursor.SortBy != req.SortBy || cursor.Order != req.Order {
+			return page, fmt.Errorf("%w: cursor was made for a different sort", factory.ErrInvalidPage)
+		}
+		query += fmt.Sprintf(" AND (%s, %s) %s (%s::%s, %s)", key.column, k.id, compare, arg(cursor.Value), key.cast, arg(cursor.ID))
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %s", key.column, direction, k.id, direction, arg(req.Limit+1))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	more := false
+	for rows.Next() {
+		if len(page.Items) == req.Limit {
+			more = true
+			break
+		}
+		item, err := scan(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	if more {
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = factory.Cursor{
+			SortBy: req.SortBy,
+			Order:  req.Order,
+			Value:  key.value(last),
+			ID:     k.idOf(last),
+		}.Encode()
+	}
+	return page, nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestPostgres loads docs/newlatest.sql into a new schema of the database
+// in SPLIT_TEST_POSTGRES_URL and drops the schema when the test ends. Tests
+// using it are skipped when the variable is not set.
+func newTestPostgres(t *testing.T) *Postgres {
+	t.Helper()
+	dsn := os.Getenv("SPLIT_TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("SPLIT_TEST_POSTGRES_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	schema := fmt.Sprintf("split_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	// Every pooled connection has to use the test schema
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("SPLIT_TEST_POSTGRES_URL must be a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ddl, err := os.ReadFile("../../docs/newlatest.sql")
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+	if _, err := db.Exec(string(ddl)); err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+	return &Postgres{dbConn: db}
+}
+
+// mustExec runs a fixture statement
+func mustExec(t *testing.T, p *Postgres, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := p.dbConn.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+// seedGroup creates users 1 to n and a group they are all members of, owned
+// by user 1, and returns the group's ID
+func seedGroup(t *testing.T, p *Postgres, n int) int {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		mustExec(t, p, `INSERT INTO users (user_id, email, name, verified) VALUES ($1, $2, $3, TRUE)`,
+			i, fmt.Sprintf("user%d@example.com", i), fmt.Sprintf("User %d", i))
+	}
+
+	var groupID int
+	err := p.dbConn.QueryRow(`INSERT INTO groups (group_name, created_by) VALUES ('Trip', 1) RETURNING group_id`).Scan(&groupID)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	for i := 1; i <= n; i++ {
+		role := "member"
+		if i == 1 {
+			role = "owner"
+		}
+		mustExec(t, p, `INSERT INTO group_members (user_id, group_id, role) VALUES ($1, $2, $3)`, i, groupID, role)
+	}
+	return groupID
+}
@@ -0,0 +1,418 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/Abhinav7903/split/pkg/recurring"
+)
+
+const selectRecurringExpense = `
+	SELECT recurring_expense_id, group_id, payer_id, amount, currency, purpose, category, payment_method_id,
+	       COALESCE(split_mode, ''), frequency, cron, start_at, end_at, next_run_at, paused, last_error, created_by, created_at
+	FROM recurring_expenses`
+
+func scanRecurringExpense(row interface{ Scan(...interface{}) error }) (factory.RecurringExpense, error) {
+	var r factory.RecurringExpense
+	err := row.Scan(
+		&r.RecurringExpenseID,
+		&r.GroupID,
+		&r.PayerID,
+		&r.Amount,
+		&r.Currency,
+		&r.Purpose,
+		&r.Category,
+		&r.PaymentMethodID,
+		&r.SplitMode,
+		&r.Frequency,
+		&r.Cron,
+		&r.StartAt,
+		&r.EndAt,
+		&r.NextRunAt,
+		&r.Paused,
+		&r.LastError,
+		&r.CreatedBy,
+		&r.CreatedAt,
+	)
+	return r, err
+}
+
+// recurringParticipants loads the shares of a recurring expense
+func recurringParticipants(db querier, recurringExpenseID int) ([]factory.ExpenseParticipant, error) {
+	rows, err := db.Query(`
+		SELECT user_id, amount, value
+		FROM recurring_expense_splits
+		WHERE recurring_expense_id = $1
+		ORDER BY user_id`,
+		recurringExpenseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expense shares: %w", err)
+	}
+	defer rows.Close()
+
+	participants := []factory.ExpenseParticipant{}
+	for rows.Next() {
+		var participant factory.ExpenseParticipant
+		if err := rows.Scan(&participant.UserID, &participant.Amount, &participant.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense share: %w", err)
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
+
+// queryRecurringExpenses runs a template query and loads each template's shares
+func (p *Postgres) queryRecurringExpenses(query string, args ...interface{}) ([]factory.RecurringExpense, error) {
+	rows, err := p.dbConn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expenses: %w", err)
+	}
+
+	templates := []factory.RecurringExpense{}
+	for rows.Next() {
+		r, err := scanRecurringExpense(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan recurring expense: %w", err)
+		}
+		templates = append(templates, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recurring expenses: %w", err)
+	}
+
+	for i := range templates {
+		templates[i].Participants, err = recurringParticipants(p.dbConn, templates[i].RecurringExpenseID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// CreateRecurringExpense stores a recurring expense and its shares. The shares
+// are fixed here, so every posting splits the amount the same way.
+func (p *Postgres) CreateRecurringExpense(r *factory.RecurringExpense) (int, error) {
+	if err := r.Validate(); err != nil {
+		return 0, err
+	}
+	if r.NextRunAt == nil {
+		return 0, errors.New("the schedule has no occurrences")
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var archived bool
+	err = tx.QueryRow(`SELECT archived_at IS NOT NULL FROM groups WHERE group_id = $1 AND deleted_at IS NULL`, r.GroupID).Scan(&archived)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors.New("group does not exist")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to check group: %w", err)
+	}
+	if archived {
+		return 0, errors.New("group is archived")
+	}
+
+	userIDs := []int{r.PayerID}
+	for _, participant := range r.Participants {
+		userIDs = append(userIDs, participant.UserID)
+	}
+	for _, userID := range userIDs {
+		var userExists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`, userID).Scan(&userExists)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check user %d: %w", userID, err)
+		}
+		if !userExists {
+			return 0, fmt.Errorf("user %d does not exist", userID)
+		}
+	}
+	if err = requireActiveMembers(tx, r.GroupID, userIDs...); err != nil {
+		return 0, err
+	}
+
+	// Like expenses, recurring expenses default to the group's currency
+	groupID := r.GroupID
+	r.Currency, err = resolveCurrency(tx, r.Currency, &groupID)
+	if err != nil {
+		return 0, err
+	}
+
+	var splitMode *string
+	if r.SplitMode != "" {
+		splitMode = &r.SplitMode
+	}
+	err = tx.QueryRow(`
+		INSERT INTO recurring_expenses
+			(group_id, payer_id, amount, currency, purpose, category, payment_method_id, split_mode,
+			 frequency, cron, start_at, end_at, next_run_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING recurring_expense_id, created_at`,
+		r.GroupID, r.PayerID, r.Amount, r.Currency, r.Purpose, r.Category, r.PaymentMethodID, splitMode,
+		r.Frequency, r.Cron, r.StartAt.UTC(), utcOrNil(r.EndAt), r.NextRunAt.UTC(), r.CreatedBy,
+	).Scan(&r.RecurringExpenseID, &r.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert recurring expense: %w", err)
+	}
+
+	for _, participant := range r.Participants {
+		_, err = tx.Exec(`
+			INSERT INTO recurring_expense_splits (recurring_expense_id, user_id, amount, value)
+			VALUES ($1, $2, $3, $4)`,
+			r.RecurringExpenseID, participant.UserID, participant.Amount, participant.Value,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert recurring expense share: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return r.RecurringExpenseID, nil
+}
+
+// utcOrNil passes an optional time to a TIMESTAMP column in UTC
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+func (p *Postgres) GetRecurringExpense(recurringExpenseID int) (*factory.RecurringExpense, error) {
+	r, err := scanRecurringExpense(p.dbConn.QueryRow(selectRecurringExpense+`
+		WHERE recurring_expense_id = $1 AND deleted_at IS NULL`,
+		recurringExpenseID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, recurring.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expense: %w", err)
+	}
+
+	r.Participants, err = recurringParticipants(p.dbConn, recurringExpenseID)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *Postgres) ListRecurringExpenses(groupID int) ([]factory.RecurringExpense, error) {
+	return p.queryRecurringExpenses(selectRecurringExpense+`
+		WHERE group_id = $1 AND deleted_at IS NULL
+		ORDER BY next_run_at NULLS LAST, recurring_expense_id`,
+		groupID,
+	)
+}
+
+// SetRecurringExpensePaused pauses a recurring expense, or resumes it with the
+// given next run so the occurrences missed while it was paused are skipped.
+func (p *Postgres) SetRecurringExpensePaused(recurringExpenseID int, paused bool, nextRunAt *time.Time) error {
+	var result sql.Result
+	var err error
+	if paused {
+		result, err = p.dbConn.Exec(`
+			UPDATE recurring_expenses SET paused = TRUE
+			WHERE recurring_expense_id = $1 AND deleted_at IS NULL`,
+			recurringExpenseID,
+		)
+	} else {
+		result, err = p.dbConn.Exec(`
+			UPDATE recurring_expenses SET paused = FALSE, next_run_at = $2, last_error = NULL
+			WHERE recurring_expense_id = $1 AND deleted_at IS NULL`,
+			recurringExpenseID, utcOrNil(nextRunAt),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update recurring expense: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return recurring.ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteRecurringExpense(recurringExpenseID int) error {
+	result, err := p.dbConn.Exec(`
+		UPDATE recurring_expenses SET deleted_at = NOW(), next_run_at = NULL
+		WHERE recurring_expense_id = $1 AND deleted_at IS NULL`,
+		recurringExpenseID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring expense: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return recurring.ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) GetOccurrences(recurringExpenseID int) ([]factory.RecurringOccurrence, error) {
+	rows, err := p.dbConn.Query(`
+		SELECT occurrence_id, recurring_expense_id, occurrence_at, transaction_id, created_at
+		FROM recurring_expense_occurrences
+		WHERE recurring_expense_id = $1
+		ORDER BY occurrence_at DESC`,
+		recurringExpenseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expense occurrences: %w", err)
+	}
+	defer rows.Close()
+
+	occurrences := []factory.RecurringOccurrence{}
+	for rows.Next() {
+		var o factory.RecurringOccurrence
+		err := rows.Scan(&o.OccurrenceID, &o.RecurringExpenseID, &o.OccurrenceAt, &o.TransactionID, &o.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense occurrence: %w", err)
+		}
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, rows.Err()
+}
+
+// ListDue returns running templates that are due, oldest first. Templates
+// whose last posting failed come after the rest so they cannot hold them up.
+func (p *Postgres) ListDue(now time.Time, limit int) ([]factory.RecurringExpense, error) {
+	return p.queryRecurringExpenses(selectRecurringExpense+`
+		WHERE deleted_at IS NULL AND NOT paused AND next_run_at <= $1
+		  AND group_id IN (SELECT group_id FROM groups WHERE deleted_at IS NULL AND archived_at IS NULL)
+		ORDER BY last_error IS NOT NULL, next_run_at, recurring_expense_id
+		LIMIT $2`,
+		now.UTC(), limit,
+	)
+}
+
+// PostOccurrence posts one occurrence of a recurring expense. The template row
+// is locked and its next run checked first, and the occurrence is recorded
+// under a unique key in the same transaction as the expense, so an occurrence
+// is posted exactly once however many schedulers run and however often they
+// restart.
+func (p *Postgres) PostOccurrence(recurringExpenseID int, occurrenceAt time.Time, nextRunAt *time.Time) (int, bool, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	r, err := scanRecurringExpense(tx.QueryRow(selectRecurringExpense+`
+		WHERE recurring_expense_id = $1 AND deleted_at IS NULL AND NOT paused
+		FOR UPDATE`,
+		recurringExpenseID,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted or paused since it was listed
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to lock recurring expense: %w", err)
+	}
+	if r.NextRunAt == nil || !r.NextRunAt.Equal(occurrenceAt.UTC()) {
+		return 0, false, nil
+	}
+
+	// Nobody is charged after leaving the group; the template waits, paused,
+	// for someone to fix it up or delete it
+	r.Participants, err = recurringParticipants(tx, recurringExpenseID)
+	if err != nil {
+		return 0, false, err
+	}
+	userIDs := []int{r.PayerID}
+	for _, participant := range r.Participants {
+		userIDs = append(userIDs, participant.UserID)
+	}
+	if err = requireActiveMembers(tx, r.GroupID, userIDs...); errors.Is(err, groupmember.ErrNotMember) {
+		_, err = tx.Exec(`
+			UPDATE recurring_expenses SET paused = TRUE, next_run_at = NULL, last_error = $2
+			WHERE recurring_expense_id = $1`,
+			recurringExpenseID, err.Error(),
+		)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to pause recurring expense: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return 0, false, recurring.ErrMemberLeft
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	var occurrenceID int
+	err = tx.QueryRow(`
+		INSERT INTO recurring_expense_occurrences (recurring_expense_id, occurrence_at)
+		VALUES ($1, $2)
+		ON CONFLICT (recurring_expense_id, occurrence_at) DO NOTHING
+		RETURNING occurrence_id`,
+		recurringExpenseID, occurrenceAt.UTC(),
+	).Scan(&occurrenceID)
+	posted := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("failed to record occurrence: %w", err)
+	}
+
+	var transactionID int
+	if posted {
+		expense := r.Expense()
+		transactionID, err = insertExpense(tx, &expense)
+		if err != nil {
+			return 0, false, err
+		}
+
+		_, err = tx.Exec(`UPDATE recurring_expense_occurrences SET transaction_id = $1 WHERE occurrence_id = $2`, transactionID, occurrenceID)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to link occurrence: %w", err)
+		}
+	}
+
+	// Move on even when the occurrence was already posted
+	_, err = tx.Exec(`
+		UPDATE recurring_expenses SET next_run_at = $2, last_error = NULL
+		WHERE recurring_expense_id = $1`,
+		recurringExpenseID, utcOrNil(nextRunAt),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to schedule next run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return transactionID, posted, nil
+}
+
+func (p *Postgres) RecordFailure(recurringExpenseID int, reason string) error {
+	_, err := p.dbConn.Exec(`UPDATE recurring_expenses SET last_error = $2 WHERE recurring_expense_id = $1`, recurringExpenseID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record recurring expense failure: %w", err)
+	}
+	return nil
+}
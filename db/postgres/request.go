@@ -1,21 +1,58 @@
 package postgres
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/Abhinav7903/split/factory"
 )
 
-// AddRequest inserts a new request into the "requests" table
-func (p *Postgres) AddRequest(data factory.Request) error {
+// AddRequest inserts a new request into the "requests" table, queueing the
+// given emails in the same transaction
+func (p *Postgres) AddRequest(data factory.Request, messages ...factory.OutboxMessage) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return errors.New("failed to begin transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	// Requests within a group are only between its current members
+	if data.GroupID != nil {
+		if err := requireActiveMembers(tx, *data.GroupID, data.SenderID, data.ReceiverID); err != nil {
+			return err
+		}
+	}
+
 	query := `INSERT INTO requests (sender_id, receiver_id, group_id, amount, status, created_at) 
-	          VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`
+	          VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP) RETURNING request_id`
 
-	_, err := p.dbConn.Exec(query, data.SenderID, data.ReceiverID, data.GroupID, data.Amount, data.Status)
+	var requestID int
+	err = tx.QueryRow(query, data.SenderID, data.ReceiverID, data.GroupID, data.Amount, data.Status).Scan(&requestID)
 	if err != nil {
 		return errors.New("failed to add request: " + err.Error())
 	}
-	return nil
+
+	// Let the receiver know in the app as well
+	senderName, err := userName(tx, data.SenderID)
+	if err != nil {
+		return err
+	}
+	err = insertNotification(tx, factory.Notification{
+		UserID:           data.ReceiverID,
+		RequestID:        &requestID,
+		NotificationType: factory.NotificationRequest,
+		Message:          senderName + " requested " + data.Amount.String() + " from you",
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := insertOutbox(tx, messages); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetRequestByID fetches a request by its ID
@@ -31,14 +68,25 @@ func (p *Postgres) GetRequestByID(requestID int) (factory.Request, error) {
 	return data, nil
 }
 
-// UpdateRequestStatus updates the status of a request
-func (p *Postgres) UpdateRequestStatus(requestID int, status string) error {
+// UpdateRequestStatus updates the status of a request, queueing the given
+// emails in the same transaction
+func (p *Postgres) UpdateRequestStatus(requestID int, status string, messages ...factory.OutboxMessage) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return errors.New("failed to begin transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
 	query := `UPDATE requests SET status = $1 WHERE request_id = $2`
-	_, err := p.dbConn.Exec(query, status, requestID)
+	_, err = tx.Exec(query, status, requestID)
 	if err != nil {
 		return errors.New("failed to update request status: " + err.Error())
 	}
-	return nil
+
+	if err := insertOutbox(tx, messages); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // DeleteRequest deletes a request by its ID
@@ -51,67 +99,54 @@ func (p *Postgres) DeleteRequest(requestID int) error {
 	return nil
 }
 
-// GetRequestsByReceiverID fetches all requests received by a user
-func (p *Postgres) GetRequestsByReceiverID(receiverID int) ([]factory.Request, error) {
-	query := `SELECT request_id, sender_id, group_id, amount, status FROM requests WHERE receiver_id = $1`
-	rows, err := p.dbConn.Query(query, receiverID)
-	if err != nil {
-		return nil, errors.New("failed to get requests: " + err.Error())
-	}
-	defer rows.Close()
-
-	var requests []factory.Request
-	for rows.Next() {
-		var data factory.Request
-		err := rows.Scan(&data.RequestID, &data.SenderID, &data.GroupID, &data.Amount, &data.Status)
-		if err != nil {
-			return nil, errors.New("failed to get requests: " + err.Error())
-		}
-		requests = append(requests, data)
-	}
-	return requests, nil
+// requestKeyset pages request lists by creation time or amount
+var requestKeyset = keyset[factory.Request]{
+	keys: map[string]sortKey[factory.Request]{
+		factory.SortCreatedAt: createdAtKey("created_at", func(r factory.Request) time.Time { return r.CreatedAt }),
+		"amount": {
+			column: "amount",
+			cast:   "numeric",
+			value:  func(r factory.Request) string { return r.Amount.String() },
+		},
+	},
+	id:      "request_id",
+	idOf:    func(r factory.Request) int { return r.RequestID },
+	created: "created_at",
 }
 
-// GetRequestsBySenderID fetches all requests sent by a user
-func (p *Postgres) GetRequestsBySenderID(senderID int) ([]factory.Request, error) {
-	query := `SELECT request_id, receiver_id, group_id, amount, status FROM requests WHERE sender_id = $1`
-	rows, err := p.dbConn.Query(query, senderID)
+const listRequestsQuery = `SELECT request_id, sender_id, receiver_id, group_id, amount, status, created_at FROM requests `
+
+func scanRequestRow(rows *sql.Rows) (factory.Request, error) {
+	var data factory.Request
+	err := rows.Scan(&data.RequestID, &data.SenderID, &data.ReceiverID, &data.GroupID, &data.Amount, &data.Status, &data.CreatedAt)
 	if err != nil {
-		return nil, errors.New("failed to get requests: " + err.Error())
+		return data, errors.New("failed to get requests: " + err.Error())
 	}
-	defer rows.Close()
-
-	var requests []factory.Request
-	for rows.Next() {
-		var data factory.Request
-		err := rows.Scan(&data.RequestID, &data.ReceiverID, &data.GroupID, &data.Amount, &data.Status)
-		if err != nil {
-			return nil, errors.New("failed to get requests: " + err.Error())
-		}
-		requests = append(requests, data)
-	}
-	return requests, nil
+	return data, nil
 }
 
-// GetRequestsByGroupID fetches all requests sent to a group
-func (p *Postgres) GetRequestsByGroupID(groupID int) ([]factory.Request, error) {
-	query := `SELECT request_id, sender_id, receiver_id, amount, status FROM requests WHERE group_id = $1`
-	rows, err := p.dbConn.Query(query, groupID)
+// listRequests fetches one page of the requests matching where
+func (p *Postgres) listRequests(where string, id int, page factory.PageRequest) (factory.Page[factory.Request], error) {
+	requests, err := requestKeyset.list(p.dbConn, listRequestsQuery+where, []interface{}{id}, page, scanRequestRow)
 	if err != nil {
-		return nil, errors.New("failed to get requests: " + err.Error())
-	}
-	defer rows.Close()
-
-	var requests []factory.Request
-	for rows.Next() {
-		var data factory.Request
-		err := rows.Scan(&data.RequestID, &data.SenderID, &data.ReceiverID, &data.Amount, &data.Status)
-		if err != nil {
-			return nil, errors.New("failed to get requests: " + err.Error())
-		}
-		requests = append(requests, data)
+		return requests, fmt.Errorf("failed to get requests: %w", err)
 	}
 	return requests, nil
 }
 
+// GetRequestsByReceiverID fetches a page of the requests received by a user
+func (p *Postgres) GetRequestsByReceiverID(receiverID int, page factory.PageRequest) (factory.Page[factory.Request], error) {
+	return p.listRequests(`WHERE receiver_id = $1`, receiverID, page)
+}
+
+// GetRequestsBySenderID fetches a page of the requests sent by a user
+func (p *Postgres) GetRequestsBySenderID(senderID int, page factory.PageRequest) (factory.Page[factory.Request], error) {
+	return p.listRequests(`WHERE sender_id = $1`, senderID, page)
+}
+
+// GetRequestsByGroupID fetches a page of the requests sent to a group
+func (p *Postgres) GetRequestsByGroupID(groupID int, page factory.PageRequest) (factory.Page[factory.Request], error) {
+	return p.listRequests(`WHERE group_id = $1`, groupID, page)
+}
+
 
@@ -1 +1,191 @@
 package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// RecordSettlement stores a payment from user_id to counterparty_id and moves
+// both parties' balances in the same DB transaction: the payer owes less and
+// the counterparty is owed less.
+func (p *Postgres) RecordSettlement(settlement *factory.Settlement) (int, error) {
+	// Validate input
+	if settlement.UserID <= 0 || settlement.CounterpartyID <= 0 {
+		return 0, errors.New("invalid settlement data: user_id and counterparty_id must be greater than zero")
+	}
+	if settlement.UserID == settlement.CounterpartyID {
+		return 0, errors.New("invalid settlement data: a user cannot settle with themselves")
+	}
+	if settlement.Amount <= 0 {
+		return 0, errors.New("invalid settlement data: amount must be greater than zero")
+	}
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Check that both users (and the group, if given) exist and are not deleted
+	const checkExistsQuery = `
+		SELECT
+			EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL) AS payer_exists,
+			EXISTS (SELECT 1 FROM users WHERE user_id = $2 AND deleted_at IS NULL) AS counterparty_exists,
+			($3::int IS NULL OR EXISTS (SELECT 1 FROM groups WHERE group_id = $3 AND deleted_at IS NULL)) AS group_exists
+	`
+	var payerExists, counterpartyExists, groupExists bool
+	err = tx.QueryRow(checkExistsQuery, settlement.UserID, settlement.CounterpartyID, settlement.GroupID).
+		Scan(&payerExists, &counterpartyExists, &groupExists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check existence of users and group: %w", err)
+	}
+	if !payerExists {
+		return 0, errors.New("user does not exist")
+	}
+	if !counterpartyExists {
+		return 0, errors.New("counterparty does not exist")
+	}
+	if !groupExists {
+		return 0, errors.New("group does not exist")
+	}
+
+	// Money is only recorded between current members of the group
+	if settlement.GroupID != nil {
+		if err = requireActiveMembers(tx, *settlement.GroupID, settlement.UserID, settlement.CounterpartyID); err != nil {
+			return 0, err
+		}
+	}
+
+	// Settlements default to the group's currency
+	settlement.Currency, err = resolveCurrency(tx, settlement.Currency, settlement.GroupID)
+	if err != nil {
+		return 0, err
+	}
+
+	settlement.Kind = factory.SettlementPayment
+	if err = insertSettlement(tx, settlement); err != nil {
+		return 0, err
+	}
+
+	// Let the counterparty know they were paid
+	payerName, err := userName(tx, settlement.UserID)
+	if err != nil {
+		return 0, err
+	}
+	err = insertNotification(tx, factory.Notification{
+		UserID:           settlement.CounterpartyID,
+		SettlementID:     &settlement.SettlementID,
+		NotificationType: factory.NotificationSettlement,
+		Message:          fmt.Sprintf("%s recorded a payment of %s %s to you", payerName, settlement.Amount, settlement.Currency),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return settlement.SettlementID, nil
+}
+
+// insertSettlement stores the settlement and moves both parties' balances
+// inside tx: the payer owes less and the counterparty is owed less.
+func insertSettlement(tx *sql.Tx, settlement *factory.Settlement) error {
+	const insertQuery = `
+		INSERT INTO settlements (user_id, counterparty_id, group_id, amount, currency, kind)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING settlement_id, settlement_date
+	`
+	err := tx.QueryRow(insertQuery, settlement.UserID, settlement.CounterpartyID, settlement.GroupID, settlement.Amount, settlement.Currency, settlement.Kind).
+		Scan(&settlement.SettlementID, &settlement.SettlementDate)
+	if err != nil {
+		return fmt.Errorf("failed to insert settlement: %w", err)
+	}
+
+	if err := adjustBalance(tx, settlement.UserID, settlement.GroupID, settlement.Currency, -settlement.Amount, 0); err != nil {
+		return err
+	}
+	return adjustBalance(tx, settlement.CounterpartyID, settlement.GroupID, settlement.Currency, 0, -settlement.Amount)
+}
+
+// GetSettlementsByUserID returns every settlement the user paid or received
+func (p *Postgres) GetSettlementsByUserID(userID int) ([]factory.Settlement, error) {
+	if userID <= 0 {
+		return nil, errors.New("invalid user ID: must be greater than zero")
+	}
+
+	const query = `
+		SELECT settlement_id, user_id, counterparty_id, group_id, amount, currency, settlement_date, kind
+		FROM settlements
+		WHERE user_id = $1 OR counterparty_id = $1
+		ORDER BY settlement_date DESC, settlement_id DESC
+	`
+	return p.querySettlements(query, userID)
+}
+
+// GetSettlementsByGroupID returns every settlement made within the group
+func (p *Postgres) GetSettlementsByGroupID(groupID int) ([]factory.Settlement, error) {
+	if groupID <= 0 {
+		return nil, errors.New("invalid group ID: must be greater than zero")
+	}
+
+	const query = `
+		SELECT settlement_id, user_id, counterparty_id, group_id, amount, currency, settlement_date, kind
+		FROM settlements
+		WHERE group_id = $1
+		ORDER BY settlement_date DESC, settlement_id DESC
+	`
+	return p.querySettlements(query, groupID)
+}
+
+// GetSettlementsBetweenUsers returns settlements in either direction between two users
+func (p *Postgres) GetSettlementsBetweenUsers(userID, counterpartyID int) ([]factory.Settlement, error) {
+	if userID <= 0 || counterpartyID <= 0 {
+		return nil, errors.New("invalid input: user IDs must be greater than zero")
+	}
+
+	const query = `
+		SELECT settlement_id, user_id, counterparty_id, group_id, amount, currency, settlement_date, kind
+		FROM settlements
+		WHERE (user_id = $1 AND counterparty_id = $2)
+		   OR (user_id = $2 AND counterparty_id = $1)
+		ORDER BY settlement_date DESC, settlement_id DESC
+	`
+	return p.querySettlements(query, userID, counterpartyID)
+}
+
+func (p *Postgres) querySettlements(query string, args ...interface{}) ([]factory.Settlement, error) {
+	rows, err := p.dbConn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settlements: %w", err)
+	}
+	defer rows.Close()
+
+	settlements := []factory.Settlement{}
+	for rows.Next() {
+		var settlement factory.Settlement
+		err := rows.Scan(
+			&settlement.SettlementID,
+			&settlement.UserID,
+			&settlement.CounterpartyID,
+			&settlement.GroupID,
+			&settlement.Amount,
+			&settlement.Currency,
+			&settlement.SettlementDate,
+			&settlement.Kind,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan settlement: %w", err)
+		}
+		settlements = append(settlements, settlement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate settlements: %w", err)
+	}
+
+	return settlements, nil
+}
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+)
+
+func TestRecordSettlementParties(t *testing.T) {
+	p := newTestPostgres(t)
+	groupID := seedGroup(t, p, 4)
+	deletedGroupID := seedDeletedGroup(t, p)
+
+	// User 3 has left the group and user 4's account was deleted
+	mustExec(t, p, `UPDATE group_members SET left_at = NOW(), removed_by = 3 WHERE group_id = $1 AND user_id = 3`, groupID)
+	mustExec(t, p, `UPDATE users SET deleted_at = NOW(), deleted_by = 4 WHERE user_id = 4`)
+	mustExec(t, p, `INSERT INTO users (user_id, email, name, verified) VALUES (5, 'user5@example.com', 'User 5', TRUE)`)
+
+	tests := []struct {
+		name           string
+		userID         int
+		counterpartyID int
+		groupID        *int
+		wantErr        bool
+		wantNotMember  bool
+	}{
+		{"members", 1, 2, &groupID, false, false},
+		{"outside any group", 1, 5, nil, false, false},
+		{"counterparty left", 1, 3, &groupID, true, true},
+		{"payer left", 3, 1, &groupID, true, true},
+		{"counterparty never joined", 1, 5, &groupID, true, true},
+		{"deleted counterparty", 1, 4, &groupID, true, false},
+		{"deleted group", 1, 2, &deletedGroupID, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.RecordSettlement(&factory.Settlement{
+				UserID:         tt.userID,
+				CounterpartyID: tt.counterpartyID,
+				GroupID:        tt.groupID,
+				Amount:         500,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RecordSettlement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, groupmember.ErrNotMember) != tt.wantNotMember {
+				t.Errorf("RecordSettlement() error = %v, want ErrNotMember: %v", err, tt.wantNotMember)
+			}
+		})
+	}
+	requireReconciled(t, p)
+}
+
+// seedDeletedGroup creates a soft deleted group owned by user 1 with users 1
+// and 2 as members, and returns its ID
+func seedDeletedGroup(t *testing.T, p *Postgres) int {
+	t.Helper()
+	var groupID int
+	err := p.dbConn.QueryRow(`INSERT INTO groups (group_name, created_by, deleted_at, deleted_by) VALUES ('Old trip', 1, NOW(), 1) RETURNING group_id`).Scan(&groupID)
+	if err != nil {
+		t.Fatalf("failed to create group: %v", err)
+	}
+	mustExec(t, p, `INSERT INTO group_members (user_id, group_id, role) VALUES (1, $1, 'owner'), (2, $1, 'member')`, groupID)
+	return groupID
+}
@@ -3,8 +3,13 @@ package postgres
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/transaction"
+	"github.com/lib/pq"
 )
 
 func (p *Postgres) CreateTransaction(transaction *factory.Transaction) (int, error) {
@@ -26,29 +31,51 @@ func (p *Postgres) CreateTransaction(transaction *factory.Transaction) (int, err
 		return 0, errors.New("group does not exist")
 	}
 
-	// Validate that payment method exists
-	paymentMethodExists, err := p.CheckPaymentMethodExists(transaction.PaymentMethodID)
-	if err != nil || !paymentMethodExists {
-		return 0, errors.New("payment method does not exist")
+	// Validate that payment method exists (if payment_method_id is provided)
+	if transaction.PaymentMethodID != nil {
+		paymentMethodExists, err := p.CheckPaymentMethodExists(*transaction.PaymentMethodID)
+		if err != nil || !paymentMethodExists {
+			return 0, errors.New("payment method does not exist")
+		}
+	}
+
+	// Default to the group's currency when none is given
+	currency, err := resolveCurrency(p.dbConn, transaction.Currency, &transaction.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	transaction.Currency = currency
+
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Both sides must be current members of the group
+	if err = requireActiveMembers(tx, transaction.GroupID, transaction.LenderID, transaction.BorrowerID); err != nil {
+		return 0, err
 	}
 
 	// Proceed with inserting the transaction if all foreign key checks pass
 	query := `INSERT INTO transactions 
-              (lender_id, borrower_id, group_id, amount, status, purpose, payment_method_id, retry_count, failure_reason)
-              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING transaction_id`
+              (lender_id, borrower_id, group_id, amount, currency, status, purpose, payment_method_id, retry_count, failure_reason, category)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING transaction_id`
 
 	// Use QueryRow to execute the query
-	row := p.dbConn.QueryRow(
+	row := tx.QueryRow(
 		query,
 		transaction.LenderID,
 		transaction.BorrowerID,
 		transaction.GroupID, // Allow for nullable fields
 		transaction.Amount,
+		transaction.Currency,
 		transaction.Status,
 		transaction.Purpose,         // Allow for nullable fields
 		transaction.PaymentMethodID, // Allow for nullable fields
 		transaction.RetryCount,
 		transaction.FailureReason, // Allow for nullable fields
+		transaction.Category,      // Allow for nullable fields
 	)
 
 	var transactionID int
@@ -57,261 +84,522 @@ func (p *Postgres) CreateTransaction(transaction *factory.Transaction) (int, err
 		return 0, err // Return an error if the operation fails
 	}
 
+	// The lender is the one recording the transaction
+	err = insertTransactionLog(tx, factory.TransactionLog{
+		TransactionID: transactionID,
+		Action:        factory.TransactionCreated,
+		Status:        &transaction.Status,
+		PerformedBy:   &transaction.LenderID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The borrower owes the lender the whole amount unless it has failed
+	if inLedger(&transaction.Status) {
+		if err = applyTransactionBalances(tx, transactionID, 1); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return transactionID, nil
 }
 
-func (p *Postgres) GetTransactionByID(transactionID int) (*factory.Transaction, error) {
+// GetTransactionByID treats deleted transactions as missing unless
+// includeDeleted is set
+func (p *Postgres) GetTransactionByID(transactionID int, includeDeleted bool) (*factory.Transaction, error) {
 	// Check if the transaction exists in the database before fetching it
 	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, transactionID).Scan(&exists)
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1 AND ($2 OR deleted_at IS NULL))`
+	err := p.dbConn.QueryRow(checkQuery, transactionID, includeDeleted).Scan(&exists)
 	if err != nil {
 		return nil, err
 	}
 	if !exists {
-		return nil, errors.New("transaction not found") // Return a more descriptive error
+		return nil, transaction.ErrNotFound
 	}
 
 	query := `SELECT 
-				 transaction_id, lender_id, borrower_id, group_id, amount, 
-				 status, purpose, payment_method_id, retry_count, failure_reason
+				 transaction_id, lender_id, borrower_id, group_id, amount, currency,
+				 status, purpose, category, payment_method_id, retry_count, failure_reason,
+				 deleted_at, deleted_by, created_at
 			  FROM transactions 
 			  WHERE transaction_id = $1`
 
 	row := p.dbConn.QueryRow(query, transactionID)
 
 	// Define a variable to hold the transaction
-	var transaction factory.Transaction
+	var t factory.Transaction
 
 	// Scan the result into the transaction struct
 	err = row.Scan(
+		&t.TransactionID,
+		&t.LenderID,
+		&t.BorrowerID,
+		&t.GroupID, // Nullable field
+		&t.Amount,
+		&t.Currency,
+		&t.Status,
+		&t.Purpose,         // Nullable field
+		&t.Category,        // Nullable field
+		&t.PaymentMethodID, // Nullable field
+		&t.RetryCount,
+		&t.FailureReason, // Nullable field
+		&t.DeletedAt,
+		&t.DeletedBy,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, transaction.ErrNotFound
+		}
+		return nil, err // Return the error for other cases
+	}
+
+	return &t, nil
+}
+
+// transactionKeyset pages transaction lists by creation time or amount
+var transactionKeyset = keyset[factory.Transaction]{
+	keys: map[string]sortKey[factory.Transaction]{
+		factory.SortCreatedAt: createdAtKey("created_at", func(t factory.Transaction) time.Time { return t.CreatedAt }),
+		"amount": {
+			column: "amount",
+			cast:   "numeric",
+			value:  func(t factory.Transaction) string { return t.Amount.String() },
+		},
+	},
+	id:      "transaction_id",
+	idOf:    func(t factory.Transaction) int { return t.TransactionID },
+	created: "created_at",
+}
+
+// scanTransactionRow reads a row selected with listTransactionsQuery
+func scanTransactionRow(rows *sql.Rows) (factory.Transaction, error) {
+	var transaction factory.Transaction
+	err := rows.Scan(
 		&transaction.TransactionID,
 		&transaction.LenderID,
 		&transaction.BorrowerID,
 		&transaction.GroupID, // Nullable field
 		&transaction.Amount,
+		&transaction.Currency,
 		&transaction.Status,
 		&transaction.Purpose,         // Nullable field
+		&transaction.Category,        // Nullable field
 		&transaction.PaymentMethodID, // Nullable field
 		&transaction.RetryCount,
 		&transaction.FailureReason, // Nullable field
+		&transaction.DeletedAt,
+		&transaction.DeletedBy,
+		&transaction.CreatedAt,
 	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // Return nil if no transaction is found
-		}
-		return nil, err // Return the error for other cases
-	}
-
-	return &transaction, nil
+	return transaction, err
 }
 
-func (p *Postgres) GetTransactionsByLenderID(lenderID int) ([]factory.Transaction, error) {
+const listTransactionsQuery = `SELECT 
+				 transaction_id, lender_id, borrower_id, group_id, amount, currency,
+				 status, purpose, category, payment_method_id, retry_count, failure_reason,
+				 deleted_at, deleted_by, created_at
+			  FROM transactions `
+
+func (p *Postgres) GetTransactionsByLenderID(lenderID int, includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Transaction], error) {
 	// Ensure the lender exists before fetching transactions
 	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`
 	err := p.dbConn.QueryRow(checkQuery, lenderID).Scan(&exists)
 	if err != nil {
-		return nil, err
+		return factory.Page[factory.Transaction]{}, err
 	}
 	if !exists {
-		return nil, errors.New("lender not found")
+		return factory.Page[factory.Transaction]{}, errors.New("lender not found")
 	}
 
-	query := `SELECT 
-				 transaction_id, lender_id, borrower_id, group_id, amount, 
-				 status, purpose, payment_method_id, retry_count, failure_reason
-			  FROM transactions 
-			  WHERE lender_id = $1`
+	query := listTransactionsQuery + `WHERE lender_id = $1 AND ($2 OR deleted_at IS NULL)`
+	return transactionKeyset.list(p.dbConn, query, []interface{}{lenderID, includeDeleted}, page, scanTransactionRow)
+}
 
-	rows, err := p.dbConn.Query(query, lenderID)
+func (p *Postgres) GetTransactionsByBorrowerID(borrowerID int, includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Transaction], error) {
+	// Ensure the borrower exists before fetching transactions
+	var exists bool
+	checkQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`
+	err := p.dbConn.QueryRow(checkQuery, borrowerID).Scan(&exists)
 	if err != nil {
-		return nil, err
+		return factory.Page[factory.Transaction]{}, err
 	}
-	defer rows.Close()
-
-	var transactions []factory.Transaction
-	for rows.Next() {
-		var transaction factory.Transaction
-		err = rows.Scan(
-			&transaction.TransactionID,
-			&transaction.LenderID,
-			&transaction.BorrowerID,
-			&transaction.GroupID, // Nullable field
-			&transaction.Amount,
-			&transaction.Status,
-			&transaction.Purpose,         // Nullable field
-			&transaction.PaymentMethodID, // Nullable field
-			&transaction.RetryCount,
-			&transaction.FailureReason, // Nullable field
-		)
-		if err != nil {
-			return nil, err
-		}
-		transactions = append(transactions, transaction)
+	if !exists {
+		return factory.Page[factory.Transaction]{}, errors.New("borrower not found")
 	}
 
-	return transactions, nil
+	query := listTransactionsQuery + `WHERE borrower_id = $1 AND ($2 OR deleted_at IS NULL)`
+	return transactionKeyset.list(p.dbConn, query, []interface{}{borrowerID, includeDeleted}, page, scanTransactionRow)
 }
 
-func (p *Postgres) GetTransactionsByBorrowerID(borrowerID int) ([]factory.Transaction, error) {
-	// Ensure the borrower exists before fetching transactions
-	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, borrowerID).Scan(&exists)
+// UpdateTransactionStatus applies the status change through the state machine,
+// logs it and notifies the lender and the borrower in the same database
+// transaction. The row is locked so concurrent changes see each other.
+func (p *Postgres) UpdateTransactionStatus(transactionID int, update factory.StatusUpdate, machine transaction.StateMachine, performedBy int) (*factory.Transaction, error) {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var t factory.Transaction
+	var previousStatus sql.NullString
+	selectQuery := `SELECT transaction_id, lender_id, borrower_id, group_id, amount, currency,
+	                       status, purpose, category, payment_method_id, retry_count, failure_reason, created_at
+	                FROM transactions WHERE transaction_id = $1 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(selectQuery, transactionID).Scan(
+		&t.TransactionID,
+		&t.LenderID,
+		&t.BorrowerID,
+		&t.GroupID,
+		&t.Amount,
+		&t.Currency,
+		&previousStatus,
+		&t.Purpose,
+		&t.Category,
+		&t.PaymentMethodID,
+		&t.RetryCount,
+		&t.FailureReason,
+		&t.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, transaction.ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
-	if !exists {
-		return nil, errors.New("borrower not found")
+	t.Status = previousStatus.String
+
+	if err = machine.Apply(&t, update.Status, update.FailureReason); err != nil {
+		return nil, err
 	}
 
-	query := `SELECT 
-				 transaction_id, lender_id, borrower_id, group_id, amount, 
-				 status, purpose, payment_method_id, retry_count, failure_reason
-			  FROM transactions 
-			  WHERE borrower_id = $1`
+	query := `UPDATE transactions SET status = $1, retry_count = $2, failure_reason = $3 WHERE transaction_id = $4`
+	if _, err = tx.Exec(query, t.Status, t.RetryCount, t.FailureReason, transactionID); err != nil {
+		return nil, err
+	}
 
-	rows, err := p.dbConn.Query(query, borrowerID)
-	if err != nil {
+	// Failed transactions are left out of the ledger, so their balance changes
+	// are undone when they fail and made again when they are retried
+	if wasCounted, counted := inLedger(&previousStatus.String), inLedger(&t.Status); wasCounted != counted {
+		sign := factory.Money(1)
+		if !counted {
+			sign = -1
+		}
+		if err = applyTransactionBalances(tx, transactionID, sign); err != nil {
+			return nil, err
+		}
+	}
+
+	log := factory.TransactionLog{
+		TransactionID: transactionID,
+		Action:        factory.TransactionStatusChanged,
+		Status:        &t.Status,
+		PerformedBy:   &performedBy,
+	}
+	details := fmt.Sprintf("status changed from %s to %s", previousStatus.String, t.Status)
+	switch t.Status {
+	case transaction.StatusRetrying:
+		log.Action = factory.TransactionRetried
+		details = fmt.Sprintf("retry %d, status changed from %s to %s", t.RetryCount, previousStatus.String, t.Status)
+	case transaction.StatusFailed:
+		log.ErrorDetails = t.FailureReason
+	}
+	log.Details = &details
+	if err = insertTransactionLog(tx, log); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var transactions []factory.Transaction
-	for rows.Next() {
-		var transaction factory.Transaction
-		err = rows.Scan(
-			&transaction.TransactionID,
-			&transaction.LenderID,
-			&transaction.BorrowerID,
-			&transaction.GroupID, // Nullable field
-			&transaction.Amount,
-			&transaction.Status,
-			&transaction.Purpose,         // Nullable field
-			&transaction.PaymentMethodID, // Nullable field
-			&transaction.RetryCount,
-			&transaction.FailureReason, // Nullable field
-		)
+	recipients := []int{t.LenderID}
+	if t.BorrowerID != t.LenderID {
+		recipients = append(recipients, t.BorrowerID)
+	}
+	for _, userID := range recipients {
+		err := insertNotification(tx, factory.Notification{
+			UserID:           userID,
+			TransactionID:    &transactionID,
+			NotificationType: factory.NotificationTransactionStatus,
+			Message:          fmt.Sprintf("Transaction #%d is now %s", transactionID, t.Status),
+		})
 		if err != nil {
 			return nil, err
 		}
-		transactions = append(transactions, transaction)
 	}
 
-	return transactions, nil
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &t, nil
+}
+
+// inLedger reports whether a transaction with the given status counts towards
+// balances. Failed transactions do not.
+func inLedger(status *string) bool {
+	return status == nil || *status != transaction.StatusFailed
 }
 
-func (p *Postgres) UpdateTransactionStatus(transactionID int, status string) error {
-	// Ensure the transaction exists before updating
-	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, transactionID).Scan(&exists)
+// DeleteTransaction soft deletes the transaction, undoing its balance changes.
+// Its log gets a final entry describing what was removed.
+func (p *Postgres) DeleteTransaction(transactionID int, performedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE transactions SET deleted_at = NOW(), deleted_by = $2
+	          WHERE transaction_id = $1 AND deleted_at IS NULL
+	          RETURNING lender_id, borrower_id, amount, currency, status`
+	var lenderID, borrowerID int
+	var amount factory.Money
+	var currency string
+	var status *string
+	err = tx.QueryRow(query, transactionID, performedBy).Scan(&lenderID, &borrowerID, &amount, &currency, &status)
+	if err == sql.ErrNoRows {
+		return transaction.ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.New("transaction not found")
+
+	if inLedger(status) {
+		if err = applyTransactionBalances(tx, transactionID, -1); err != nil {
+			return err
+		}
 	}
 
-	query := `UPDATE transactions SET status = $1 WHERE transaction_id = $2`
-	_, err = p.dbConn.Exec(query, status, transactionID)
+	details := fmt.Sprintf("deleted %s %s lent by user %d to user %d", amount, currency, lenderID, borrowerID)
+	err = insertTransactionLog(tx, factory.TransactionLog{
+		TransactionID: transactionID,
+		Action:        factory.TransactionDeleted,
+		Status:        status,
+		Details:       &details,
+		PerformedBy:   &performedBy,
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (p *Postgres) DeleteTransaction(transactionID int) error {
-	// Ensure the transaction exists before deleting
-	var exists bool
-	checkQuery := `SELECT EXISTS (SELECT 1 FROM transactions WHERE transaction_id = $1)`
-	err := p.dbConn.QueryRow(checkQuery, transactionID).Scan(&exists)
+// RestoreTransaction brings back a soft deleted transaction and reapplies its
+// balance changes.
+func (p *Postgres) RestoreTransaction(transactionID int, performedBy int) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE transactions SET deleted_at = NULL, deleted_by = NULL
+	          WHERE transaction_id = $1 AND deleted_at IS NOT NULL
+	          RETURNING status`
+	var status *string
+	err = tx.QueryRow(query, transactionID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return errors.New("deleted transaction not found")
+	}
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return errors.New("transaction not found")
+
+	if inLedger(status) {
+		if err = applyTransactionBalances(tx, transactionID, 1); err != nil {
+			return err
+		}
 	}
 
-	query := `DELETE FROM transactions WHERE transaction_id = $1`
-	_, err = p.dbConn.Exec(query, transactionID)
+	err = insertTransactionLog(tx, factory.TransactionLog{
+		TransactionID: transactionID,
+		Action:        factory.TransactionRestored,
+		Status:        status,
+		PerformedBy:   &performedBy,
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (p *Postgres) SearchTransactions(filters factory.TransactionFilters) ([]factory.Transaction, error) {
-	// Ensure at least one filter is provided
-	if filters.LenderID == nil && filters.BorrowerID == nil && filters.GroupID == nil &&
-		filters.Status == nil && filters.MinAmount == nil && filters.MaxAmount == nil &&
-		filters.PaymentMethodID == nil {
-		return nil, errors.New("at least one filter must be provided")
+// transactionSearchWhere turns the filters into a WHERE clause and its
+// arguments
+func transactionSearchWhere(filters factory.TransactionFilters) (string, []interface{}) {
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
 	}
 
-	query := `SELECT 
-                 transaction_id, lender_id, borrower_id, group_id, amount, 
-                 status, purpose, payment_method_id, retry_count, failure_reason
-              FROM transactions 
-              WHERE lender_id = COALESCE($1, lender_id)
-              AND borrower_id = COALESCE($2, borrower_id)
-              AND group_id = COALESCE($3, group_id)
-              AND status = COALESCE($4, status)
-              AND amount >= COALESCE($5, amount)
-              AND amount <= COALESCE($6, amount)
-              AND payment_method_id = COALESCE($7, payment_method_id)`
-
-	// Execute the query with the filters
-	rows, err := p.dbConn.Query(
-		query,
-		filters.LenderID,
-		filters.BorrowerID,
-		filters.GroupID,
-		filters.Status,
-		filters.MinAmount,
-		filters.MaxAmount,
-		filters.PaymentMethodID,
-	)
+	conditions := []string{"(" + arg(filters.IncludeDeleted) + " OR deleted_at IS NULL)"}
+	if filters.LenderID != nil {
+		conditions = append(conditions, "lender_id = "+arg(*filters.LenderID))
+	}
+	if filters.BorrowerID != nil {
+		conditions = append(conditions, "borrower_id = "+arg(*filters.BorrowerID))
+	}
+	if filters.GroupID != nil {
+		conditions = append(conditions, "group_id = "+arg(*filters.GroupID))
+	}
+	if filters.InvolvingUserID != nil {
+		user := arg(*filters.InvolvingUserID)
+		conditions = append(conditions, fmt.Sprintf(`(lender_id = %[1]s OR borrower_id = %[1]s
+		       OR EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.transaction_id AND s.user_id = %[1]s))`, user))
+	}
+
+	statuses := filters.Statuses
+	if filters.Status != nil {
+		statuses = append(statuses, *filters.Status)
+	}
+	if len(statuses) > 0 {
+		conditions = append(conditions, "status = ANY("+arg(pq.Array(statuses))+")")
+	}
+
+	if filters.MinAmount != nil {
+		conditions = append(conditions, "amount >= "+arg(*filters.MinAmount))
+	}
+	if filters.MaxAmount != nil {
+		conditions = append(conditions, "amount <= "+arg(*filters.MaxAmount))
+	}
+	if filters.Currency != nil {
+		conditions = append(conditions, "currency = "+arg(*filters.Currency))
+	}
+	if filters.PaymentMethodID != nil {
+		conditions = append(conditions, "payment_method_id = "+arg(*filters.PaymentMethodID))
+	}
+	if filters.Category != nil {
+		conditions = append(conditions, "category = "+arg(*filters.Category))
+	}
+	if filters.Text != "" {
+		conditions = append(conditions, "to_tsvector('english', COALESCE(purpose, '')) @@ plainto_tsquery('english', "+arg(filters.Text)+")")
+	}
+	if filters.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filters.CreatedFrom))
+	}
+	if filters.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+arg(*filters.CreatedTo))
+	}
+
+	return "WHERE " + strings.Join(conditions, "\n\t\t  AND "), args
+}
+
+// SearchTransactions returns one page of the transactions matching the
+// filters and, when filters.Aggregate is set, totals over every match.
+// Dates in the filters take the place of the page's own date range.
+func (p *Postgres) SearchTransactions(filters factory.TransactionFilters, page factory.PageRequest) (factory.TransactionSearchResult, error) {
+	var result factory.TransactionSearchResult
+
+	var keyExpr string
+	switch filters.GroupBy {
+	case "":
+	case factory.GroupByStatus:
+		keyExpr = "COALESCE(status, '')"
+	case factory.GroupByMonth:
+		keyExpr = "to_char(created_at, 'YYYY-MM')"
+	case factory.GroupByCategory:
+		keyExpr = "COALESCE(category, '')"
+	default:
+		return result, fmt.Errorf("cannot group by %q", filters.GroupBy)
+	}
+
+	if filters.CreatedFrom == nil {
+		filters.CreatedFrom = page.CreatedFrom
+	}
+	if filters.CreatedTo == nil {
+		filters.CreatedTo = page.CreatedTo
+	}
+	page.CreatedFrom, page.CreatedTo = nil, nil
+
+	where, args := transactionSearchWhere(filters)
+
+	var err error
+	result.Page, err = transactionKeyset.list(p.dbConn, listTransactionsQuery+where, args, page, scanTransactionRow)
 	if err != nil {
-		return nil, err
+		return result, err
+	}
+
+	if !filters.Aggregate {
+		return result, nil
+	}
+
+	// Amounts are only ever added up within a currency
+	key := "''"
+	if keyExpr != "" {
+		key = keyExpr
+	}
+	query := fmt.Sprintf(`SELECT %[1]s, currency, COUNT(*), COALESCE(SUM(amount), 0)
+		FROM transactions
+		%[2]s
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, key, where)
+	rows, err := p.dbConn.Query(query, args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to total transactions: %w", err)
 	}
 	defer rows.Close()
 
-	var transactions []factory.Transaction
+	result.Aggregates = []factory.TransactionAggregate{}
 	for rows.Next() {
-		var transaction factory.Transaction
-		err := rows.Scan(
-			&transaction.TransactionID,
-			&transaction.LenderID,
-			&transaction.BorrowerID,
-			&transaction.GroupID, // Nullable field
-			&transaction.Amount,
-			&transaction.Status,
-			&transaction.Purpose,         // Nullable field
-			&transaction.PaymentMethodID, // Nullable field
-			&transaction.RetryCount,
-			&transaction.FailureReason, // Nullable field
-		)
-		if err != nil {
-			return nil, err
+		var aggregate factory.TransactionAggregate
+		if err := rows.Scan(&aggregate.Key, &aggregate.Currency, &aggregate.Count, &aggregate.Total); err != nil {
+			return result, fmt.Errorf("failed to scan transaction totals: %w", err)
 		}
-		transactions = append(transactions, transaction)
+		result.Aggregates = append(result.Aggregates, aggregate)
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to iterate transaction totals: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetGroupSpendByCurrency totals a group's transactions, one row per currency.
+// Failed and deleted transactions are left out.
+func (p *Postgres) GetGroupSpendByCurrency(groupID int) ([]factory.CurrencyAmount, error) {
+	groupExists, err := p.CheckGroupExists(groupID)
+	if err != nil || !groupExists {
+		return nil, errors.New("invalid group ID")
 	}
 
-	// Check for row iteration errors
+	query := `
+		SELECT currency, SUM(amount)
+		FROM transactions
+		WHERE group_id = $1 AND status IS DISTINCT FROM 'failed' AND deleted_at IS NULL
+		GROUP BY currency
+		ORDER BY currency
+	`
+	rows, err := p.dbConn.Query(query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group totals: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []factory.CurrencyAmount{}
+	for rows.Next() {
+		var total factory.CurrencyAmount
+		if err := rows.Scan(&total.Currency, &total.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan group total: %w", err)
+		}
+		totals = append(totals, total)
+	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to iterate group totals: %w", err)
 	}
 
-	return transactions, nil
+	return totals, nil
 }
 
 // Helper function to check if a user exists
 func (p *Postgres) CheckUserExists(userID int) (bool, error) {
-	query := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1)`
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE user_id = $1 AND deleted_at IS NULL)`
 	var exists bool
 	err := p.dbConn.QueryRow(query, userID).Scan(&exists)
 	return exists, err
@@ -319,7 +607,7 @@ func (p *Postgres) CheckUserExists(userID int) (bool, error) {
 
 // Helper function to check if a group exists
 func (p *Postgres) CheckGroupExists(groupID int) (bool, error) {
-	query := `SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1)`
+	query := `SELECT EXISTS (SELECT 1 FROM groups WHERE group_id = $1 AND deleted_at IS NULL)`
 	var exists bool
 	err := p.dbConn.QueryRow(query, groupID).Scan(&exists)
 	return exists, err
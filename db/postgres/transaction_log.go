@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// insertTransactionLog records an action on a transaction inside tx, so the
+// history only changes when the transaction does.
+func insertTransactionLog(tx *sql.Tx, log factory.TransactionLog) error {
+	_, err := tx.Exec(`
+		INSERT INTO transaction_logs (transaction_id, action, status, details, error_details, performed_by)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		log.TransactionID, log.Action, log.Status, log.Details, log.ErrorDetails, log.PerformedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log transaction %s: %w", log.Action, err)
+	}
+	return nil
+}
+
+// GetTransactionLogs returns the history of a transaction, oldest first. It
+// works for deleted transactions too.
+func (p *Postgres) GetTransactionLogs(transactionID int) ([]factory.TransactionLog, error) {
+	rows, err := p.dbConn.Query(`
+		SELECT log_id, transaction_id, action, status, details, error_details, performed_by, timestamp
+		FROM transaction_logs
+		WHERE transaction_id = $1
+		ORDER BY timestamp, log_id`,
+		transactionID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction history: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []factory.TransactionLog{}
+	for rows.Next() {
+		var log factory.TransactionLog
+		err := rows.Scan(
+			&log.LogID,
+			&log.TransactionID,
+			&log.Action,
+			&log.Status,
+			&log.Details,
+			&log.ErrorDetails,
+			&log.PerformedBy,
+			&log.Timestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transaction log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	return logs, rows.Err()
+}
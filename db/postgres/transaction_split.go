@@ -1,39 +1,14 @@
 package postgres
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/transaction"
+	transactionsplit "github.com/Abhinav7903/split/pkg/transaction_split"
 )
 
-func (p *Postgres) CreateTransactionSplit(transaction *factory.TransactionSplit) error {
-	query := `
-        INSERT INTO transaction_splits (transaction_id, user_id, amount)
-        VALUES ($1, $2, $3)
-        RETURNING transaction_split_id
-    `
-
-	tx, err := p.dbConn.Begin() // Start a transaction
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-
-	// Perform the query within the transaction
-	err = tx.QueryRow(query, transaction.TransactionID, transaction.UserID, transaction.Amount).
-		Scan(&transaction.TransactionSplitID)
-	if err != nil {
-		tx.Rollback() // Roll back the transaction on error
-		return fmt.Errorf("error creating transaction split: %w", err)
-	}
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return nil
-}
-
 func (p *Postgres) GetTransactionSplits(transactionID int) ([]factory.TransactionSplit, error) {
 	query := `
 		SELECT transaction_split_id, transaction_id, user_id, amount
@@ -70,3 +45,89 @@ func (p *Postgres) GetTransactionSplits(transactionID int) ([]factory.Transactio
 
 	return transactionSplits, nil
 }
+
+// SplitTransaction divides an existing transaction between the given splits and
+// turns it into an expense, moving the borrower's debt onto the participants
+// the way CreateExpense does. Everything happens in one SQL transaction, and a
+// transaction that already has splits is refused so balances are never moved
+// twice.
+func (p *Postgres) SplitTransaction(transactionID int, splits []factory.TransactionSplit) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the transaction so it cannot be split twice at once
+	var groupID *int
+	var status *string
+	var isExpense bool
+	err = tx.QueryRow(`
+		SELECT group_id, status, is_expense FROM transactions
+		WHERE transaction_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`,
+		transactionID,
+	).Scan(&groupID, &status, &isExpense)
+	if err == sql.ErrNoRows {
+		return transaction.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get transaction: %w", err)
+	}
+
+	var hasSplits bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_id = $1)`, transactionID).Scan(&hasSplits)
+	if err != nil {
+		return fmt.Errorf("failed to check transaction splits: %w", err)
+	}
+	if isExpense || hasSplits {
+		return transactionsplit.ErrAlreadySplit
+	}
+
+	// Money is only recorded between current members of the group
+	if groupID != nil {
+		userIDs := make([]int, len(splits))
+		for i, split := range splits {
+			userIDs[i] = split.UserID
+		}
+		if err = requireActiveMembers(tx, *groupID, userIDs...); err != nil {
+			return err
+		}
+	}
+
+	// Until now the borrower owed the whole amount; that debt gives way to the splits
+	if inLedger(status) {
+		if err = applyTransactionBalances(tx, transactionID, -1); err != nil {
+			return err
+		}
+	}
+
+	const insertSplitQuery = `
+		INSERT INTO transaction_splits (transaction_id, user_id, amount)
+		VALUES ($1, $2, $3)
+		RETURNING transaction_split_id
+	`
+	for i := range splits {
+		splits[i].TransactionID = transactionID
+		err = tx.QueryRow(insertSplitQuery, transactionID, splits[i].UserID, splits[i].Amount).Scan(&splits[i].TransactionSplitID)
+		if err != nil {
+			return fmt.Errorf("error creating transaction split: %w", err)
+		}
+	}
+
+	// From now on it is an expense. A failed transaction is not in the ledger
+	// until it is retried, so its balances are left alone for now.
+	if _, err = tx.Exec(`UPDATE transactions SET is_expense = TRUE WHERE transaction_id = $1`, transactionID); err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+	if inLedger(status) {
+		if err = applyTransactionBalances(tx, transactionID, 1); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -3,20 +3,31 @@ package postgres
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/Abhinav7903/split/factory"
 )
 
-func (p *Postgres) AddUser(user factory.User) error {
+func (p *Postgres) AddUser(user factory.User, messages ...factory.OutboxMessage) error {
+	tx, err := p.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO users (email, name, firebase_id) 
-		VALUES ($1, $2, $3)
+		INSERT INTO users (email, name, firebase_id, password_hash) 
+		VALUES ($1, $2, $3, NULLIF($4, ''))
 	`
-	_, err := p.dbConn.Exec(query, user.Email, user.Name, user.FirebaseUID)
+	_, err = tx.Exec(query, user.Email, user.Name, user.FirebaseUID, user.PasswordHash)
 	if err != nil {
 		return fmt.Errorf("failed to add user: %w", err)
 	}
-	return nil
+
+	if err := insertOutbox(tx, messages); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (p *Postgres) VerifyEmail(email string) error {
@@ -33,7 +44,7 @@ func (p *Postgres) VerifyEmail(email string) error {
 // Getuser Details from the database
 func (p *Postgres) GetUser(email string) (factory.User, error) {
 	var user factory.User
-	err := p.dbConn.QueryRow("SELECT email, name, firebase_uid, verified FROM users WHERE email=$1", email).Scan(&user.Email, &user.Name, &user.FirebaseUID, &user.Verified)
+	err := p.dbConn.QueryRow("SELECT email, name, firebase_uid, verified FROM users WHERE email=$1 AND deleted_at IS NULL", email).Scan(&user.Email, &user.Name, &user.FirebaseUID, &user.Verified)
 	if err != nil {
 		return user, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -42,37 +53,94 @@ func (p *Postgres) GetUser(email string) (factory.User, error) {
 
 // UpdateUserDetails updates the user details in the database
 func (p *Postgres) UpdateUserDetails(user factory.User) error {
-	_, err := p.dbConn.Exec("UPDATE users SET name=$1, firebase_uid=$2 WHERE email=$3", user.Name, user.FirebaseUID, user.Email)
+	_, err := p.dbConn.Exec("UPDATE users SET name=$1, firebase_uid=$2 WHERE email=$3 AND deleted_at IS NULL", user.Name, user.FirebaseUID, user.Email)
 	if err != nil {
 		return fmt.Errorf("failed to update user details: %w", err)
 	}
 	return nil
 }
 
-// DeleteUser deletes the user from the database
-func (p *Postgres) DeleteUser(email string) error {
-	_, err := p.dbConn.Exec("DELETE FROM users WHERE email=$1", email)
+// DeleteUser soft deletes the user. The email stays taken so the account can
+// be restored.
+func (p *Postgres) DeleteUser(email string, deletedBy int) error {
+	result, err := p.dbConn.Exec("UPDATE users SET deleted_at=NOW(), deleted_by=$2 WHERE email=$1 AND deleted_at IS NULL", email, deletedBy)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
 	return nil
 }
 
-// GetAllUsers gets all the users from the database
-func (p *Postgres) GetAllUsers() ([]factory.User, error) {
-	var users []factory.User
-	rows, err := p.dbConn.Query("SELECT email, name, firebase_uid, verified FROM users")
+// RestoreUser brings back a soft deleted user
+func (p *Postgres) RestoreUser(email string) error {
+	result, err := p.dbConn.Exec("UPDATE users SET deleted_at=NULL, deleted_by=NULL WHERE email=$1 AND deleted_at IS NOT NULL", email)
+	if err != nil {
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+	rows, err := result.RowsAffected()
 	if err != nil {
-		return users, fmt.Errorf("failed to get all users: %w", err)
+		return fmt.Errorf("failed to restore user: %w", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var user factory.User
-		err := rows.Scan(&user.Email, &user.Name, &user.FirebaseUID, &user.Verified)
+	if rows == 0 {
+		return fmt.Errorf("deleted user not found")
+	}
+	return nil
+}
+
+// userRow is a user along with the columns users are paged on
+type userRow struct {
+	factory.User
+	id        int
+	createdAt time.Time
+}
+
+// userKeyset pages the user list by creation time, email or name
+var userKeyset = keyset[userRow]{
+	keys: map[string]sortKey[userRow]{
+		factory.SortCreatedAt: createdAtKey("created_at", func(u userRow) time.Time { return u.createdAt }),
+		"email": {
+			column: "COALESCE(email, '')",
+			cast:   "text",
+			value:  func(u userRow) string { return u.Email },
+		},
+		"name": {
+			column: "COALESCE(name, '')",
+			cast:   "text",
+			value:  func(u userRow) string { return u.Name },
+		},
+	},
+	id:      "user_id",
+	idOf:    func(u userRow) int { return u.id },
+	created: "created_at",
+}
+
+// GetAllUsers gets a page of the users in the database, leaving out deleted
+// users unless includeDeleted is set
+func (p *Postgres) GetAllUsers(includeDeleted bool, page factory.PageRequest) (factory.Page[factory.User], error) {
+	query := `SELECT user_id, COALESCE(email, ''), COALESCE(name, ''), COALESCE(firebase_id, ''), verified, deleted_at, created_at
+		FROM users
+		WHERE ($1 OR deleted_at IS NULL)`
+	rows, err := userKeyset.list(p.dbConn, query, []interface{}{includeDeleted}, page, func(rows *sql.Rows) (userRow, error) {
+		var user userRow
+		err := rows.Scan(&user.id, &user.Email, &user.Name, &user.FirebaseUID, &user.Verified, &user.DeletedAt, &user.createdAt)
 		if err != nil {
-			return users, fmt.Errorf("failed to scan user: %w", err)
+			return user, fmt.Errorf("failed to scan user: %w", err)
 		}
-		users = append(users, user)
+		return user, nil
+	})
+	if err != nil {
+		return factory.Page[factory.User]{}, fmt.Errorf("failed to get all users: %w", err)
+	}
+
+	users := factory.Page[factory.User]{Items: make([]factory.User, 0, len(rows.Items)), NextCursor: rows.NextCursor}
+	for _, user := range rows.Items {
+		users.Items = append(users.Items, user.User)
 	}
 	return users, nil
 }
@@ -86,7 +154,8 @@ func (p *Postgres) UpdateUserVerification(email string, status bool) error {
 	return nil
 }
 
-// EmailExists checks if the email exists in the database
+// EmailExists checks if the email exists in the database. Deleted users still
+// hold on to their email.
 func (p *Postgres) EmailExists(email string) (bool, error) {
 	var exists bool
 	err := p.dbConn.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", email).Scan(&exists)
@@ -100,7 +169,7 @@ func (p *Postgres) GetUserIDByEmail(email string) (int, error) {
 	const query = `
         SELECT user_id 
         FROM users 
-        WHERE email = $1
+        WHERE email = $1 AND deleted_at IS NULL
     `
 	var userID int
 	err := p.dbConn.QueryRow(query, email).Scan(&userID)
@@ -116,12 +185,12 @@ func (p *Postgres) GetUserIDByEmail(email string) (int, error) {
 
 func (p *Postgres) GetUserByID(id int) (factory.User, error) {
 	const query = `
-		SELECT email, name, verified
+		SELECT email, name, verified, password_changed_at
 		FROM users
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL
 	`
 	var user factory.User
-	err := p.dbConn.QueryRow(query, id).Scan(&user.Email, &user.Name, &user.Verified)
+	err := p.dbConn.QueryRow(query, id).Scan(&user.Email, &user.Name, &user.Verified, &user.PasswordChangedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return user, fmt.Errorf("user not found: %w", err)
@@ -131,3 +200,62 @@ func (p *Postgres) GetUserByID(id int) (factory.User, error) {
 
 	return user, nil
 }
+
+func (p *Postgres) GetUserIDByFirebaseUID(firebaseUID string) (int, error) {
+	const query = `
+		SELECT user_id
+		FROM users
+		WHERE firebase_id = $1 AND deleted_at IS NULL
+	`
+	var userID int
+	err := p.dbConn.QueryRow(query, firebaseUID).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("user not found: %w", err)
+		}
+		return 0, fmt.Errorf("failed to get user ID: %w", err)
+	}
+
+	return userID, nil
+}
+
+// GetCredentials returns what is needed to check a password login: the user's
+// ID, password hash (empty for users without a password) and whether their
+// email is verified.
+func (p *Postgres) GetCredentials(email string) (int, string, bool, error) {
+	const query = `
+		SELECT user_id, COALESCE(password_hash, ''), verified
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL
+	`
+	var userID int
+	var passwordHash string
+	var verified bool
+	err := p.dbConn.QueryRow(query, email).Scan(&userID, &passwordHash, &verified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, "", false, fmt.Errorf("user not found: %w", err)
+		}
+		return 0, "", false, fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	return userID, passwordHash, verified, nil
+}
+
+// UpdatePassword replaces the user's password hash and records when it changed.
+// The time is stored in UTC, the same zone token issue times are compared in.
+func (p *Postgres) UpdatePassword(email, passwordHash string) error {
+	result, err := p.dbConn.Exec("UPDATE users SET password_hash=$1, password_changed_at=$2 WHERE email=$3",
+		passwordHash, time.Now().UTC(), email)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
@@ -2,13 +2,13 @@ package redis
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/Abhinav7903/split/pkg/sessmanager"
 	"github.com/go-redis/redis/v8"
 )
 
@@ -54,45 +54,52 @@ func NewRedis(envType *string) *Redis {
 	return instance
 }
 
-func (r *Redis) StoreEmailHash(email string) (string, error) {
-	// create a sha256 hash of this email
-	h := sha256.New()
-	h.Write([]byte(email))
-	bs := base64.URLEncoding.EncodeToString(h.Sum(nil))
+// resetKey namespaces password reset tokens away from other keys
+func resetKey(token string) string {
+	return "reset:" + token
+}
 
-	// store hash:email
-	return string(bs), r.client.Set(context.Background(), string(bs), email, 0).Err()
+// resetRequestKey counts the reset links asked for an email
+func resetRequestKey(email string) string {
+	return "reset_request:" + normalizeEmail(email)
 }
 
-// fetch email from hash and delete the key
-func (r *Redis) GetEmailFromHash(hash string) (string, error) {
-	ctx := context.Background()
-	email, err := r.client.Get(ctx, hash).Result()
-	if err != nil || len(email) == 0 {
-		return "", err
+// AllowResetRequest counts a password reset request for the email and reports
+// whether it is within limit for the current window.
+func (r *Redis) AllowResetRequest(email string, limit int, window time.Duration) (bool, error) {
+	allowed, err := r.allowWithinLimit(resetRequestKey(email), limit, window)
+	if err != nil {
+		return false, fmt.Errorf("failed to count password reset requests: %w", err)
 	}
-	// now delete the key
-	err = r.client.Del(ctx, hash).Err()
-	return email, err
+	return allowed, nil
 }
 
 // GenerateToken generates a new token for password reset
 func (r *Redis) GenerateToken(email string) (string, error) {
-	// Create a SHA256 hash of the email for a secure token
-	h := sha256.New()
-	h.Write([]byte(email + time.Now().String())) // Include timestamp for uniqueness
-	token := base64.URLEncoding.EncodeToString(h.Sum(nil))
+	// Use a random token so it cannot be guessed from the email
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
 
 	// Store the token in Redis with an expiration of 1 hour
-	if err := r.client.Set(context.Background(), token, email, time.Hour).Err(); err != nil {
+	if err := r.client.Set(context.Background(), resetKey(token), email, time.Hour).Err(); err != nil {
 		return "", fmt.Errorf("failed to store token in Redis: %w", err)
 	}
 
 	return token, nil
 }
 
-// delete token
-
-func (r *Redis) DeleteToken(token string) error {
-	return r.client.Del(context.Background(), token).Err()
+// ConsumeResetToken deletes a password reset token and returns the email it
+// was issued for. Reading and deleting happen in one step, so a token can't
+// be used by two requests at once.
+func (r *Redis) ConsumeResetToken(token string) (string, error) {
+	email, err := r.client.GetDel(context.Background(), resetKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", sessmanager.ErrTokenNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	return email, nil
 }
@@ -0,0 +1,194 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/sessmanager"
+	"github.com/go-redis/redis/v8"
+)
+
+func refreshKey(token string) string {
+	return "refresh:" + token
+}
+
+func sessionsKey(userID int) string {
+	return "sessions:" + strconv.Itoa(userID)
+}
+
+func loginAttemptKey(email string) string {
+	return "login_attempts:" + normalizeEmail(email)
+}
+
+// normalizeEmail folds the case and surrounding spaces of an address so that
+// every spelling of it shares one counter
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// randomToken returns 32 random bytes, base64url encoded
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateSession stores a new refresh token for the user. The user's set of
+// tokens is kept so every session can be revoked at once.
+func (r *Redis) CreateSession(userID int, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshKey(token), userID, ttl)
+		pipe.SAdd(ctx, sessionsKey(userID), token)
+		pipe.Expire(ctx, sessionsKey(userID), ttl)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store session: %w", err)
+	}
+
+	return token, nil
+}
+
+// RotateSession consumes a refresh token and issues a new one for the same
+// user. A token can only be rotated once, so a replayed token is rejected.
+func (r *Redis) RotateSession(refreshToken string, ttl time.Duration) (int, string, error) {
+	ctx := context.Background()
+	value, err := r.client.GetDel(ctx, refreshKey(refreshToken)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, "", sessmanager.ErrSessionNotFound
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read session: %w", err)
+	}
+
+	userID, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid session: %w", err)
+	}
+	r.client.SRem(ctx, sessionsKey(userID), refreshToken)
+
+	token, err := r.CreateSession(userID, ttl)
+	if err != nil {
+		return 0, "", err
+	}
+	return userID, token, nil
+}
+
+// RevokeSession deletes a refresh token
+func (r *Redis) RevokeSession(refreshToken string) error {
+	ctx := context.Background()
+	value, err := r.client.GetDel(ctx, refreshKey(refreshToken)).Result()
+	if errors.Is(err, redis.Nil) {
+		return sessmanager.ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if userID, err := strconv.Atoi(value); err == nil {
+		r.client.SRem(ctx, sessionsKey(userID), refreshToken)
+	}
+	return nil
+}
+
+// RevokeAllSessions deletes every refresh token the user holds
+func (r *Redis) RevokeAllSessions(userID int) error {
+	ctx := context.Background()
+	tokens, err := r.client.SMembers(ctx, sessionsKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	keys := []string{sessionsKey(userID)}
+	for _, token := range tokens {
+		keys = append(keys, refreshKey(token))
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// GetLoginAttempt returns the failed logins recorded for the email
+func (r *Redis) GetLoginAttempt(email string) (factory.LoginAttempt, error) {
+	var attempt factory.LoginAttempt
+	data, err := r.client.Get(context.Background(), loginAttemptKey(email)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return attempt, nil
+	}
+	if err != nil {
+		return attempt, fmt.Errorf("failed to read login attempts: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &attempt); err != nil {
+		return attempt, fmt.Errorf("failed to decode login attempts: %w", err)
+	}
+	return attempt, nil
+}
+
+// recordFailedLoginScript counts a failed login in one step, so concurrent
+// failures can't overwrite each other's count. KEYS[1] is the attempt key;
+// ARGV is maxAttempts, the lockout in milliseconds and the encoded time the
+// lockout would end. It returns the stored attempt.
+var recordFailedLoginScript = redis.NewScript(`
+local attempt = {FailedAttempts = 0, LockoutTime = "0001-01-01T00:00:00Z"}
+local data = redis.call("GET", KEYS[1])
+if data then
+	attempt = cjson.decode(data)
+end
+
+attempt.FailedAttempts = attempt.FailedAttempts + 1
+if attempt.FailedAttempts >= tonumber(ARGV[1]) then
+	attempt.FailedAttempts = 0
+	attempt.LockoutTime = ARGV[3]
+end
+
+data = cjson.encode(attempt)
+redis.call("SET", KEYS[1], data, "PX", ARGV[2])
+return data
+`)
+
+// RecordFailedLogin counts a failed login. Reaching maxAttempts locks the
+// account for the lockout duration and starts the count again. Failures are
+// forgotten after the lockout duration without another one.
+func (r *Redis) RecordFailedLogin(email string, maxAttempts int, lockout time.Duration) (factory.LoginAttempt, error) {
+	var attempt factory.LoginAttempt
+	lockedUntil, err := time.Now().Add(lockout).MarshalText()
+	if err != nil {
+		return attempt, fmt.Errorf("failed to encode lockout time: %w", err)
+	}
+
+	data, err := recordFailedLoginScript.Run(context.Background(), r.client,
+		[]string{loginAttemptKey(email)},
+		maxAttempts, lockout.Milliseconds(), string(lockedUntil),
+	).Text()
+	if err != nil {
+		return attempt, fmt.Errorf("failed to store login attempts: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &attempt); err != nil {
+		return attempt, fmt.Errorf("failed to decode login attempts: %w", err)
+	}
+	return attempt, nil
+}
+
+// ResetLoginAttempts forgets the failed logins for the email
+func (r *Redis) ResetLoginAttempts(email string) error {
+	return r.client.Del(context.Background(), loginAttemptKey(email)).Err()
+}
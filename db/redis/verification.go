@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Abhinav7903/split/pkg/sessmanager"
+	"github.com/go-redis/redis/v8"
+)
+
+// verificationRetention is how long a verification token is remembered after
+// it expires or is used, so those cases can be told apart from unknown tokens.
+const verificationRetention = 7 * 24 * time.Hour
+
+type verificationToken struct {
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Used      bool      `json:"used"`
+}
+
+func verificationKey(token string) string {
+	return "verify:" + token
+}
+
+func verificationResendKey(email string) string {
+	return "verify_resend:" + normalizeEmail(email)
+}
+
+// CreateVerificationToken stores a random token for the email that can be
+// used once within ttl.
+func (r *Redis) CreateVerificationToken(email string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(verificationToken{Email: email, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode verification token: %w", err)
+	}
+	err = r.client.Set(context.Background(), verificationKey(token), data, ttl+verificationRetention).Err()
+	if err != nil {
+		return "", fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ConsumeVerificationToken marks the token used and returns its email. The
+// check and update run in a WATCH transaction so a token cannot be used twice.
+func (r *Redis) ConsumeVerificationToken(token string) (string, error) {
+	ctx := context.Background()
+	key := verificationKey(token)
+
+	var email string
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return sessmanager.ErrTokenNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read verification token: %w", err)
+		}
+
+		var record verificationToken
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("failed to decode verification token: %w", err)
+		}
+		if record.Used {
+			return sessmanager.ErrTokenUsed
+		}
+		if time.Now().After(record.ExpiresAt) {
+			return sessmanager.ErrTokenExpired
+		}
+
+		record.Used = true
+		data, err = json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode verification token: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, redis.KeepTTL)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		email = record.Email
+		return nil
+	}, key)
+	if err != nil {
+		return "", err
+	}
+
+	return email, nil
+}
+
+// AllowVerificationResend counts a resend for the email and reports whether
+// it is within limit for the current window.
+func (r *Redis) AllowVerificationResend(email string, limit int, window time.Duration) (bool, error) {
+	allowed, err := r.allowWithinLimit(verificationResendKey(email), limit, window)
+	if err != nil {
+		return false, fmt.Errorf("failed to count verification resends: %w", err)
+	}
+	return allowed, nil
+}
+
+// allowWithinLimit counts a request against key and reports whether it is
+// within limit. The count starts over once window has passed since the first.
+func (r *Redis) allowWithinLimit(key string, limit int, window time.Duration) (bool, error) {
+	ctx := context.Background()
+
+	count, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if count == 1 {
+		if err := r.client.Expire(ctx, key, window).Err(); err != nil {
+			return false, err
+		}
+	}
+
+	return count <= int64(limit), nil
+}
@@ -3,18 +3,30 @@ CREATE TABLE users (
     user_id SERIAL PRIMARY KEY,
     email VARCHAR(255) UNIQUE,
     firebase_id VARCHAR(255) UNIQUE,
+    password_hash VARCHAR(255),                       -- bcrypt hash; NULL for users who only sign in with Firebase
+    password_changed_at TIMESTAMP,                    -- UTC; access tokens issued before it are rejected
     name VARCHAR(100),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    verified boolean DEFAULT false NOT NULL
+    verified boolean DEFAULT false NOT NULL,
+    deleted_at TIMESTAMP,                             -- Set when the user is soft deleted
+    deleted_by INT,                                   -- Who deleted the user
+    FOREIGN KEY (deleted_by) REFERENCES users(user_id)
 );
 
 -- Create the 'groups' table
 CREATE TABLE groups (
     group_id SERIAL PRIMARY KEY,
     group_name VARCHAR(255),
+    default_currency CHAR(3) NOT NULL DEFAULT 'INR', -- ISO 4217 code totals are converted into
     created_by INT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (created_by) REFERENCES users(user_id)
+    deleted_at TIMESTAMP,                            -- Set when the group is soft deleted
+    deleted_by INT,                                  -- Who deleted the group
+    archived_at TIMESTAMP,                           -- Set while the group is archived (read-only)
+    archived_by INT,                                 -- Who archived the group
+    FOREIGN KEY (created_by) REFERENCES users(user_id),
+    FOREIGN KEY (deleted_by) REFERENCES users(user_id),
+    FOREIGN KEY (archived_by) REFERENCES users(user_id)
 );
 
 -- Create the 'group_members' table
@@ -22,11 +34,20 @@ CREATE TABLE group_members (
     group_member_id SERIAL PRIMARY KEY,
     user_id INT NOT NULL,
     group_id INT NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member',      -- 'owner', 'admin', 'member' or 'viewer'
     joined_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    left_at TIMESTAMP,                               -- Set when the member leaves or is removed; the row is kept
+    removed_by INT,                                  -- Who removed the member; themselves when they left
     FOREIGN KEY (user_id) REFERENCES users(user_id),
-    FOREIGN KEY (group_id) REFERENCES groups(group_id)
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (removed_by) REFERENCES users(user_id),
+    UNIQUE (group_id, user_id),                      -- A user joins a group at most once
+    CONSTRAINT check_member_role CHECK (role IN ('owner', 'admin', 'member', 'viewer'))
 );
 
+-- A group has exactly one owner
+CREATE UNIQUE INDEX idx_group_members_owner ON group_members (group_id) WHERE role = 'owner';
+
 -- Create the 'payment_methods' table first so it can be referenced by the 'transactions' table
 CREATE TABLE payment_methods (
     payment_id        SERIAL PRIMARY KEY,  -- Automatically increments
@@ -55,12 +76,19 @@ CREATE TABLE transactions (
     borrower_id INT NOT NULL,
     group_id INT,
     amount DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'INR', -- ISO 4217 code of amount
     status VARCHAR(50),
     purpose VARCHAR(255),
+    category VARCHAR(50),  -- Free-form label such as 'food' or 'travel'
     payment_method_id INT, -- Linking to payment method
     retry_count INT DEFAULT 0,  -- Keeps track of retry attempts
     failure_reason TEXT,       -- Describes the failure (e.g., insufficient funds, network error, etc.)
+    is_expense BOOLEAN NOT NULL DEFAULT FALSE, -- Created by add-expense or split afterwards, so its splits carry the debts
+    deleted_at TIMESTAMP,      -- Set when the transaction is soft deleted
+    deleted_by INT,            -- Who deleted the transaction
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (lender_id) REFERENCES users(user_id),
+    FOREIGN KEY (deleted_by) REFERENCES users(user_id),
     FOREIGN KEY (borrower_id) REFERENCES users(user_id),
     FOREIGN KEY (group_id) REFERENCES groups(group_id),
     FOREIGN KEY (payment_method_id) REFERENCES payment_methods(payment_id), -- Foreign Key for payment method
@@ -84,6 +112,7 @@ CREATE TABLE balances (
     group_id INT,
     owed_amount DECIMAL(10, 2) DEFAULT 0,
     lent_amount DECIMAL(10, 2) DEFAULT 0,
+    currency CHAR(3) NOT NULL DEFAULT 'INR', -- Balances are kept separately per currency
     FOREIGN KEY (user_id) REFERENCES users(user_id),
     FOREIGN KEY (group_id) REFERENCES groups(group_id)
 );
@@ -109,10 +138,13 @@ CREATE TABLE settlements (
     counterparty_id INT NOT NULL,
     group_id INT,
     amount DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'INR',
     settlement_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    kind VARCHAR(20) NOT NULL DEFAULT 'payment',      -- 'payment', or 'transfer' and 'write_off' when a member leaves a group
     FOREIGN KEY (user_id) REFERENCES users(user_id),
     FOREIGN KEY (counterparty_id) REFERENCES users(user_id),
-    FOREIGN KEY (group_id) REFERENCES groups(group_id)
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    CONSTRAINT check_settlement_kind CHECK (kind IN ('payment', 'transfer', 'write_off'))
 );
 
 -- Create indexes for the 'transactions' table for performance
@@ -120,6 +152,9 @@ CREATE INDEX idx_transactions_lender_id ON transactions(lender_id);
 CREATE INDEX idx_transactions_borrower_id ON transactions(borrower_id);
 CREATE INDEX idx_transactions_group_id ON transactions(group_id);
 CREATE INDEX idx_transactions_payment_method_id ON transactions(payment_method_id);
+CREATE INDEX idx_transactions_lender_created ON transactions(lender_id, created_at, transaction_id);
+CREATE INDEX idx_transactions_borrower_created ON transactions(borrower_id, created_at, transaction_id);
+CREATE INDEX idx_transactions_purpose_search ON transactions USING GIN (to_tsvector('english', COALESCE(purpose, '')));
 
 -- Create indexes for the 'transaction_splits' table for performance
 CREATE INDEX idx_transaction_splits_transaction_id ON transaction_splits(transaction_id);
@@ -129,37 +164,229 @@ CREATE INDEX idx_transaction_splits_user_id ON transaction_splits(user_id);
 CREATE INDEX idx_balances_user_id ON balances(user_id);
 CREATE INDEX idx_balances_group_id ON balances(group_id);
 
--- newtable idea for logging transaction actions
+-- History of every action taken on a transaction
 CREATE TABLE transaction_logs (
     log_id SERIAL PRIMARY KEY,
-    transaction_id INT NOT NULL,                    -- Links to the transaction
-    action VARCHAR(100) NOT NULL,                    -- Action taken (e.g., 'Payment Initiated', 'Payment Successful', 'Payment Failed')
-    status VARCHAR(50),                              -- Status of the action (e.g., 'Pending', 'Success', 'Failed')
-    details TEXT,                                    -- Additional details or error messages, if any
-    error_details TEXT,                              -- Specific error details (for failed actions)
+    transaction_id INT NOT NULL,                    -- Not a foreign key so deleted transactions keep their history
+    action VARCHAR(100) NOT NULL,                    -- 'created', 'status_changed', 'retried' or 'deleted'
+    status VARCHAR(50),                              -- The transaction's status after the action
+    details TEXT,                                    -- Additional details, e.g. the previous status
+    error_details TEXT,                              -- Specific error details (for failed transactions)
+    performed_by INT,                                -- The user who took the action
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,    -- Timestamp of the action
-    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE
+    FOREIGN KEY (performed_by) REFERENCES users(user_id) ON DELETE SET NULL
 );
 
 -- Index for fast lookups
-CREATE INDEX idx_transaction_logs_transaction_id ON transaction_logs (transaction_id);
+CREATE INDEX idx_transaction_logs_transaction_id ON transaction_logs (transaction_id, timestamp);
+
+-- Expenses that repeat on a schedule, e.g. the monthly rent. The scheduler
+-- posts each occurrence as an ordinary expense.
+CREATE TABLE recurring_expenses (
+    recurring_expense_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    payer_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'INR',
+    purpose VARCHAR(255),
+    category VARCHAR(50),
+    payment_method_id INT,
+    split_mode VARCHAR(20),                          -- How the shares were worked out, if not given as amounts
+    frequency VARCHAR(20) NOT NULL,                  -- 'daily', 'weekly', 'monthly' or 'cron'
+    cron VARCHAR(100),                               -- Five-field cron expression (UTC) for the 'cron' frequency
+    start_at TIMESTAMP NOT NULL,                     -- UTC
+    end_at TIMESTAMP,                                -- No occurrences after this time (UTC)
+    next_run_at TIMESTAMP,                           -- The next occurrence to post (UTC); NULL once the schedule has ended
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    last_error TEXT,                                 -- Why the last posting failed
+    created_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,                            -- Set when the recurring expense is stopped for good
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (payer_id) REFERENCES users(user_id),
+    FOREIGN KEY (payment_method_id) REFERENCES payment_methods(payment_id),
+    FOREIGN KEY (created_by) REFERENCES users(user_id),
+    CONSTRAINT check_recurring_frequency CHECK (frequency IN ('daily', 'weekly', 'monthly', 'cron')),
+    CONSTRAINT check_recurring_cron CHECK ((frequency = 'cron') = (cron IS NOT NULL))
+);
+
+CREATE INDEX idx_recurring_expenses_group_id ON recurring_expenses (group_id);
+CREATE INDEX idx_recurring_expenses_due ON recurring_expenses (next_run_at) WHERE deleted_at IS NULL AND NOT paused;
+
+-- Each participant's share of every posting of a recurring expense
+CREATE TABLE recurring_expense_splits (
+    recurring_expense_id INT NOT NULL,
+    user_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,       -- The exact amount, percentage or share weight given for the split mode
+    PRIMARY KEY (recurring_expense_id, user_id),
+    FOREIGN KEY (recurring_expense_id) REFERENCES recurring_expenses(recurring_expense_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+-- Every occurrence a recurring expense has posted. The unique key is what stops
+-- an occurrence from being posted twice, e.g. after a restart.
+CREATE TABLE recurring_expense_occurrences (
+    occurrence_id SERIAL PRIMARY KEY,
+    recurring_expense_id INT NOT NULL,
+    occurrence_at TIMESTAMP NOT NULL,                -- The scheduled time (UTC)
+    transaction_id INT,                              -- The posted expense
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,  -- When it was actually posted
+    UNIQUE (recurring_expense_id, occurrence_at),
+    FOREIGN KEY (recurring_expense_id) REFERENCES recurring_expenses(recurring_expense_id),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id)
+);
+
+-- History of a group's lifecycle: archiving, closing out, deleting and each
+-- step of a permanent delete
+CREATE TABLE group_logs (
+    log_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,                           -- Not a foreign key so purged groups keep their history
+    action VARCHAR(50) NOT NULL,                     -- 'archived', 'unarchived', 'closed_out', 'deleted', 'restored' or 'purged'
+    details TEXT,                                    -- E.g. the close-out plan or how many rows a purge step removed
+    performed_by INT,                                -- The user who took the action
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (performed_by) REFERENCES users(user_id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_group_logs_group_id ON group_logs (group_id, timestamp);
+
+-- Invitations to join a group, addressed to an existing user or to an email
+-- address that may not have signed up yet
+CREATE TABLE group_invitations (
+    invitation_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    invited_by INT NOT NULL,
+    invitee_id INT,                                   -- Set when the invitee has an account
+    invitee_email VARCHAR(255),                       -- Set when invited by email
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',    -- 'pending', 'accepted', 'declined' or 'revoked'
+    expires_at TIMESTAMP NOT NULL,
+    responded_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (invited_by) REFERENCES users(user_id),
+    FOREIGN KEY (invitee_id) REFERENCES users(user_id),
+    CONSTRAINT check_invitee CHECK (invitee_id IS NOT NULL OR invitee_email IS NOT NULL),
+    CONSTRAINT check_invitation_status CHECK (status IN ('pending', 'accepted', 'declined', 'revoked'))
+);
+
+CREATE INDEX idx_group_invitations_group_id ON group_invitations (group_id);
+CREATE INDEX idx_group_invitations_invitee_id ON group_invitations (invitee_id) WHERE status = 'pending';
+CREATE INDEX idx_group_invitations_invitee_email ON group_invitations (LOWER(invitee_email)) WHERE status = 'pending';
+
+-- Shareable codes that let anyone holding them join a group, either straight
+-- away or once the group's creator approves
+CREATE TABLE group_join_codes (
+    join_code_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    code VARCHAR(16) NOT NULL UNIQUE,
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+    max_uses INT,                                     -- NULL for unlimited
+    uses INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,                             -- NULL for never
+    created_by INT NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (created_by) REFERENCES users(user_id)
+);
+
+-- Every use of a join code. Codes without approval are approved straight away.
+CREATE TABLE group_join_requests (
+    join_request_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,
+    join_code_id INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',    -- 'pending', 'approved' or 'rejected'
+    decided_by INT,                                   -- NULL when approved by the code itself
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (join_code_id) REFERENCES group_join_codes(join_code_id),
+    FOREIGN KEY (decided_by) REFERENCES users(user_id),
+    CONSTRAINT check_join_request_status CHECK (status IN ('pending', 'approved', 'rejected'))
+);
+
+-- A user waits on at most one request per group
+CREATE UNIQUE INDEX idx_group_join_requests_pending ON group_join_requests (group_id, user_id) WHERE status = 'pending';
+
+-- Create the 'group_leave_requests' table for members who want to leave and
+-- hand their balances to another member, who or the owner has to approve it
+CREATE TABLE group_leave_requests (
+    leave_request_id SERIAL PRIMARY KEY,
+    group_id INT NOT NULL,
+    user_id INT NOT NULL,                             -- The member who wants to leave
+    transfer_to INT NOT NULL,                         -- The member taking over the balances
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',    -- 'pending', 'approved' or 'rejected'
+    decided_by INT,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(group_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (transfer_to) REFERENCES users(user_id),
+    FOREIGN KEY (decided_by) REFERENCES users(user_id),
+    CONSTRAINT check_leave_request_status CHECK (status IN ('pending', 'approved', 'rejected'))
+);
+
+-- A member waits on at most one request per group
+CREATE UNIQUE INDEX idx_group_leave_requests_pending ON group_leave_requests (group_id, user_id) WHERE status = 'pending';
 
 -- Create the 'payment_notifications' table for user notifications
 CREATE TABLE payment_notifications (
     notification_id SERIAL PRIMARY KEY,
     user_id INT NOT NULL,                             -- The user to whom the notification is sent
-    transaction_id INT NOT NULL,                      -- Links to the transaction
-    notification_type VARCHAR(50) NOT NULL,           -- Type of notification (e.g., 'Success', 'Failure', 'Pending')
+    transaction_id INT,                               -- Links to the transaction, if it is about one
+    request_id INT,                                   -- Links to the payment request, if it is about one
+    settlement_id INT,                                -- Links to the settlement, if it is about one
+    invitation_id INT,                                -- Links to the group invitation, if it is about one
+    notification_type VARCHAR(50) NOT NULL,           -- 'transaction_status', 'request', 'settlement', 'invitation', 'join_request' or 'leave_request'
     message TEXT NOT NULL,                            -- The message content of the notification
     is_read BOOLEAN DEFAULT FALSE,                    -- Whether the user has read the notification
     read_at TIMESTAMP,                                -- Timestamp of when the notification was read
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,   -- Timestamp when the notification was created
     FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
-    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE
+    FOREIGN KEY (transaction_id) REFERENCES transactions(transaction_id) ON DELETE CASCADE,
+    FOREIGN KEY (request_id) REFERENCES requests(request_id) ON DELETE CASCADE,
+    FOREIGN KEY (settlement_id) REFERENCES settlements(settlement_id) ON DELETE CASCADE,
+    FOREIGN KEY (invitation_id) REFERENCES group_invitations(invitation_id) ON DELETE CASCADE
 );
 
 -- Indexes for fast lookups
-CREATE INDEX idx_payment_notifications_user_id ON payment_notifications (user_id);
+CREATE INDEX idx_payment_notifications_user_id ON payment_notifications (user_id, created_at DESC);
 CREATE INDEX idx_payment_notifications_transaction_id ON payment_notifications (transaction_id);
+CREATE INDEX idx_payment_notifications_unread ON payment_notifications (user_id) WHERE is_read = FALSE;
 
+-- Audit trail for manual (admin) changes to the 'balances' table
+CREATE TABLE balance_adjustments (
+    adjustment_id SERIAL PRIMARY KEY,
+    balance_id INT NOT NULL,                          -- Not a foreign key so deleted balances keep their history
+    previous_owed_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    previous_lent_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    owed_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    lent_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    reason TEXT NOT NULL,
+    adjusted_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (adjusted_by) REFERENCES users(user_id)
+);
+
+CREATE INDEX idx_balance_adjustments_balance_id ON balance_adjustments (balance_id);
+
+-- Emails waiting to be sent. Rows are written in the same transaction as the
+-- change they report and drained by the outbox worker.
+CREATE TABLE outbox (
+    outbox_id SERIAL PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,                               -- Plain text body
+    html_body TEXT NOT NULL DEFAULT '',               -- Optional HTML alternative
+    attempts INT NOT NULL DEFAULT 0,                  -- Send attempts so far
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,                                  -- Why the last attempt failed
+    sent_at TIMESTAMP,                                -- NULL until the email has been sent
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
 
+-- The worker only looks at unsent messages
+CREATE INDEX idx_outbox_pending ON outbox (next_attempt_at) WHERE sent_at IS NULL;
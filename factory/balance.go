@@ -1,9 +1,60 @@
 package factory
 
+import "time"
+
 type Balance struct {
-	BalanceID  int     `json:"balance_id"`
-	UserID     int     `json:"user_id"`
-	GroupID    *int    `json:"group_id,omitempty"`
-	OwedAmount float64 `json:"owed_amount"`
-	LentAmount float64 `json:"lent_amount"`
+	BalanceID  int    `json:"balance_id"`
+	UserID     int    `json:"user_id"`
+	GroupID    *int   `json:"group_id,omitempty"`
+	Currency   string `json:"currency"`
+	OwedAmount Money  `json:"owed_amount"`
+	LentAmount Money  `json:"lent_amount"`
+}
+
+// NetBalance is a user's position computed from the ledger. Net is positive
+// when others owe the user money and negative when the user owes others.
+type NetBalance struct {
+	UserID     int    `json:"user_id"`
+	GroupID    *int   `json:"group_id,omitempty"`
+	Currency   string `json:"currency"`
+	OwedAmount Money  `json:"owed_amount"`
+	LentAmount Money  `json:"lent_amount"`
+	Net        Money  `json:"net"`
+}
+
+// PairwiseBalance is what two users owe each other in one currency. Net is
+// positive when OtherUserID owes UserID.
+type PairwiseBalance struct {
+	UserID      int    `json:"user_id"`
+	OtherUserID int    `json:"other_user_id"`
+	GroupID     *int   `json:"group_id,omitempty"`
+	Currency    string `json:"currency"`
+	OwedAmount  Money  `json:"owed_amount"` // What UserID owes OtherUserID
+	LentAmount  Money  `json:"lent_amount"` // What OtherUserID owes UserID
+	Net         Money  `json:"net"`
+}
+
+// BalanceDiscrepancy is a user and group whose stored balance does not match
+// the balance recomputed from the ledger.
+type BalanceDiscrepancy struct {
+	UserID           int    `json:"user_id"`
+	GroupID          *int   `json:"group_id,omitempty"`
+	Currency         string `json:"currency"`
+	StoredOwedAmount Money  `json:"stored_owed_amount"`
+	StoredLentAmount Money  `json:"stored_lent_amount"`
+	LedgerOwedAmount Money  `json:"ledger_owed_amount"`
+	LedgerLentAmount Money  `json:"ledger_lent_amount"`
+}
+
+// BalanceAdjustment is the audit record of a manual change to a balance row
+type BalanceAdjustment struct {
+	AdjustmentID       int       `json:"adjustment_id"`
+	BalanceID          int       `json:"balance_id"`
+	PreviousOwedAmount Money     `json:"previous_owed_amount"`
+	PreviousLentAmount Money     `json:"previous_lent_amount"`
+	OwedAmount         Money     `json:"owed_amount"`
+	LentAmount         Money     `json:"lent_amount"`
+	Reason             string    `json:"reason"`
+	AdjustedBy         int       `json:"adjusted_by"`
+	CreatedAt          time.Time `json:"created_at"`
 }
@@ -0,0 +1,30 @@
+package factory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultCurrency is used for groups and amounts that do not name a currency
+const DefaultCurrency = "INR"
+
+// CurrencyAmount is an amount together with the currency it is in
+type CurrencyAmount struct {
+	Currency string `json:"currency"`
+	Amount   Money  `json:"amount"`
+}
+
+// NormalizeCurrency upper-cases a three letter ISO 4217 currency code and
+// rejects anything that is not one.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	for _, letter := range code {
+		if letter < 'A' || letter > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
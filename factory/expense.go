@@ -0,0 +1,64 @@
+package factory
+
+import "errors"
+
+// Expense is a shared cost paid by one user and split between its participants.
+type Expense struct {
+	PayerID         int                  `json:"payer_id"`
+	GroupID         int                  `json:"group_id"`
+	Amount          Money                `json:"amount"`
+	Currency        string               `json:"currency,omitempty"` // ISO 4217 code; defaults to the group's currency
+	Purpose         *string              `json:"purpose"`
+	Category        *string              `json:"category,omitempty"` // Free-form label such as "food", used to group search totals
+	PaymentMethodID *int                 `json:"payment_method_id,omitempty"`
+	SplitMode       string               `json:"split_mode,omitempty"` // equal, exact, percentage or shares; empty means amounts are given
+	Participants    []ExpenseParticipant `json:"participants"`
+}
+
+// ExpenseParticipant is one user's share of an expense. The payer may be listed
+// as a participant to record their own share. When the expense has a split mode,
+// Value carries the exact amount, percentage or share weight and Amount is
+// computed by the server.
+type ExpenseParticipant struct {
+	UserID int     `json:"user_id"`
+	Amount Money   `json:"amount"`
+	Value  float64 `json:"value,omitempty"`
+}
+
+// Validate checks the validity of an Expense object
+func (e *Expense) Validate() error {
+	if e.PayerID <= 0 {
+		return errors.New("payer_id is required and must be positive")
+	}
+	if e.GroupID <= 0 {
+		return errors.New("group_id is required and must be positive")
+	}
+	if e.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if len(e.Participants) == 0 {
+		return errors.New("at least one participant is required")
+	}
+
+	seen := make(map[int]bool, len(e.Participants))
+	var total Money
+	for _, participant := range e.Participants {
+		if participant.UserID <= 0 {
+			return errors.New("participant user_id must be positive")
+		}
+		if seen[participant.UserID] {
+			return errors.New("participants must be unique")
+		}
+		seen[participant.UserID] = true
+
+		if participant.Amount < 0 {
+			return errors.New("participant amount cannot be negative")
+		}
+		total += participant.Amount
+	}
+
+	if total != e.Amount {
+		return errors.New("participant amounts must add up to the expense amount")
+	}
+	return nil
+}
@@ -3,8 +3,13 @@ package factory
 import "time"
 
 type Group struct {
-	GroupID   int       `json:"group_id"`
-	GroupName string    `json:"group_name"`
-	CreatedBy int       `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
+	GroupID         int        `json:"group_id"`
+	GroupName       string     `json:"group_name"`
+	DefaultCurrency string     `json:"default_currency"` // ISO 4217 code amounts are converted into for totals
+	CreatedBy       int        `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"` // Set once the group is soft deleted
+	DeletedBy       *int       `json:"deleted_by,omitempty"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"` // Set while the group is archived and read-only
+	ArchivedBy      *int       `json:"archived_by,omitempty"`
 }
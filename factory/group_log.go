@@ -0,0 +1,25 @@
+package factory
+
+import "time"
+
+// Group log actions
+const (
+	GroupArchived    = "archived"
+	GroupUnarchived  = "unarchived"
+	GroupClosedOut   = "closed_out"
+	GroupDeleted     = "deleted"
+	GroupRestored    = "restored"
+	GroupPurged      = "purged"       // One entry per table emptied by a permanent delete
+	GroupPurgeForced = "purge_forced" // A permanent delete that skipped the close-out and balance checks
+)
+
+// GroupLog is one entry in a group's lifecycle history. Entries outlive the
+// group, so a permanent delete can still be audited.
+type GroupLog struct {
+	LogID       int       `json:"log_id"`
+	GroupID     int       `json:"group_id"`
+	Action      string    `json:"action"`
+	Details     *string   `json:"details,omitempty"`
+	PerformedBy *int      `json:"performed_by,omitempty"` // Nil once the user is deleted
+	Timestamp   time.Time `json:"timestamp"`
+}
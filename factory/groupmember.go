@@ -3,8 +3,132 @@ package factory
 import "time"
 
 type GroupMember struct {
-	GroupMemberID int       `json:"group_member_id"` // Maps to group_member_id (primary key)
-	UserID        int       `json:"user_id"`         // Maps to user_id (foreign key to users table)
-	GroupID       int       `json:"group_id"`        // Maps to group_id (foreign key to groups table)
-	JoinedDate    time.Time `json:"joined_date"`     // Maps to joined_date
+	GroupMemberID int        `json:"group_member_id"`      // Maps to group_member_id (primary key)
+	UserID        int        `json:"user_id"`              // Maps to user_id (foreign key to users table)
+	GroupID       int        `json:"group_id"`             // Maps to group_id (foreign key to groups table)
+	Role          string     `json:"role"`                 // Maps to role; one of the Role constants
+	JoinedDate    time.Time  `json:"joined_date"`          // Maps to joined_date
+	Active        bool       `json:"active"`               // False once the user has left or been removed
+	LeftAt        *time.Time `json:"left_at,omitempty"`    // Maps to left_at; set for former members
+	RemovedBy     *int       `json:"removed_by,omitempty"` // Maps to removed_by; who removed a former member
+}
+
+// How a departing member's outstanding balances are handled
+const (
+	SettleNone     = ""          // Refuse while anything is outstanding
+	SettleTransfer = "transfer"  // Move the member's debts and credits to another member
+	SettleWriteOff = "write_off" // Forgive them; the other side absorbs the difference
+)
+
+// MemberRemoval describes a member leaving or being removed from a group
+type MemberRemoval struct {
+	GroupID    int
+	UserID     int    // The member who goes
+	RemovedBy  int    // Equal to UserID when the member leaves by themselves
+	Settle     string // One of the Settle constants
+	TransferTo *int   // The member who takes over the balances when Settle is SettleTransfer
+}
+
+// Leave request statuses
+const (
+	LeaveRequestPending  = "pending"
+	LeaveRequestApproved = "approved"
+	LeaveRequestRejected = "rejected"
+)
+
+// LeaveRequest is a member asking to leave a group and hand their balances to
+// another member. Either that member or the owner has to approve it; until
+// then the member stays in the group.
+type LeaveRequest struct {
+	LeaveRequestID int        `json:"leave_request_id"`
+	GroupID        int        `json:"group_id"`
+	UserID         int        `json:"user_id"`     // The member who wants to leave
+	TransferTo     int        `json:"transfer_to"` // The member taking over the balances
+	Status         string     `json:"status"`
+	DecidedBy      *int       `json:"decided_by,omitempty"`
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Member roles, from most to least trusted. A group has exactly one owner.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// Permission is something a member may be allowed to do in a group
+type Permission string
+
+const (
+	PermissionAddExpenses     Permission = "add_expenses"      // Record transactions and expenses in the group
+	PermissionEditExpenses    Permission = "edit_expenses"     // Change or delete anyone's transactions in the group
+	PermissionInviteMembers   Permission = "invite_members"    // Invite people to the group
+	PermissionRemoveMembers   Permission = "remove_members"    // Remove members ranked below oneself
+	PermissionManageGroup     Permission = "manage_group"      // Edit the group and handle join codes, join requests and invitations
+	PermissionSettleForOthers Permission = "settle_for_others" // Record settlements paid by another member
+	PermissionManageRoles     Permission = "manage_roles"      // Promote, demote and hand over ownership
+	PermissionDeleteGroup     Permission = "delete_group"      // Delete the group
+)
+
+// rolePermissions is the permission matrix. Owners may do everything.
+var rolePermissions = map[string][]Permission{
+	RoleOwner: {
+		PermissionAddExpenses,
+		PermissionEditExpenses,
+		PermissionInviteMembers,
+		PermissionRemoveMembers,
+		PermissionManageGroup,
+		PermissionSettleForOthers,
+		PermissionManageRoles,
+		PermissionDeleteGroup,
+	},
+	RoleAdmin: {
+		PermissionAddExpenses,
+		PermissionEditExpenses,
+		PermissionInviteMembers,
+		PermissionRemoveMembers,
+		PermissionManageGroup,
+		PermissionSettleForOthers,
+	},
+	RoleMember: {
+		PermissionAddExpenses,
+		PermissionInviteMembers,
+	},
+	RoleViewer: {},
+}
+
+// roleRanks orders the roles so that members can only act on those below them
+var roleRanks = map[string]int{
+	RoleOwner:  4,
+	RoleAdmin:  3,
+	RoleMember: 2,
+	RoleViewer: 1,
+}
+
+// ValidRole reports whether role is one of the member roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RolePermissions returns what the role allows, in matrix order
+func RolePermissions(role string) []Permission {
+	return append([]Permission{}, rolePermissions[role]...)
+}
+
+// RoleAllows reports whether the role grants the permission
+func RoleAllows(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOutranks reports whether role a ranks strictly above role b
+func RoleOutranks(a, b string) bool {
+	return roleRanks[a] > roleRanks[b]
 }
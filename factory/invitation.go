@@ -0,0 +1,63 @@
+package factory
+
+import "time"
+
+// Invitation statuses. Expired is only ever reported, for pending invitations
+// past their expiry; it is never stored.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation asks a user to join a group. It is addressed to a user ID, an
+// email address or both; invitees who sign up later with the email see it too.
+type Invitation struct {
+	InvitationID int        `json:"invitation_id"`
+	GroupID      int        `json:"group_id"`
+	InvitedBy    int        `json:"invited_by"`
+	InviteeID    *int       `json:"invitee_id,omitempty"`
+	InviteeEmail *string    `json:"invitee_email,omitempty"`
+	Status       string     `json:"status"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RespondedAt  *time.Time `json:"responded_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// JoinCode lets anyone holding it join a group, straight away or once the
+// group's owner or an admin approves.
+type JoinCode struct {
+	JoinCodeID       int        `json:"join_code_id"`
+	GroupID          int        `json:"group_id"`
+	Code             string     `json:"code"`
+	RequiresApproval bool       `json:"requires_approval"`
+	MaxUses          *int       `json:"max_uses,omitempty"` // Nil for unlimited
+	Uses             int        `json:"uses"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"` // Nil for never
+	CreatedBy        int        `json:"created_by"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	Link             string     `json:"link,omitempty"` // Shareable link; filled in by the server
+}
+
+// Join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// JoinRequest is one use of a join code. Codes that need no approval make
+// requests that are approved straight away.
+type JoinRequest struct {
+	JoinRequestID int        `json:"join_request_id"`
+	GroupID       int        `json:"group_id"`
+	UserID        int        `json:"user_id"`
+	JoinCodeID    int        `json:"join_code_id"`
+	Status        string     `json:"status"`
+	DecidedBy     *int       `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,231 @@
+package factory
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (paise for rupees). It is written as a
+// two-decimal number in JSON and as DECIMAL(10, 2) in Postgres, so amounts never
+// pick up floating point noise on the way in or out.
+type Money int64
+
+// ParseMoney parses a decimal string such as "12", "12.5" or "-0.05". More than
+// two decimal places is an error rather than being silently rounded.
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+// parseMoney parses a decimal string into minor units. With round set, digits
+// past the second decimal place are rounded half away from zero instead of
+// being rejected.
+func parseMoney(s string, round bool) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	digits := s
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+
+	// Only digits may follow the sign, with at most one decimal point
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	roundUp := false
+	if len(fraction) > 2 {
+		for _, digit := range fraction[2:] {
+			if digit != '0' && !round {
+				return 0, fmt.Errorf("amount %q has more than two decimal places", s)
+			}
+		}
+		roundUp = round && fraction[2] >= '5'
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	cents, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	amount := units*100 + cents
+	if roundUp {
+		amount++
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money(amount), nil
+}
+
+// isDigits reports whether s contains nothing but the digits 0 to 9
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the amount with exactly two decimal places
+func (m Money) String() string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+// MarshalJSON writes the amount as a plain JSON number such as 12.50
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string. The literal
+// text is parsed, never a float, so 0.1 + 0.2 really is 0.30.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	amount, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Scan implements sql.Scanner for DECIMAL columns
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		amount, err := parseMoney(string(value), true)
+		if err != nil {
+			return err
+		}
+		*m = amount
+		return nil
+	case string:
+		amount, err := parseMoney(value, true)
+		if err != nil {
+			return err
+		}
+		*m = amount
+		return nil
+	case int64:
+		*m = Money(value * 100)
+		return nil
+	case float64:
+		amount, err := parseMoney(strconv.FormatFloat(value, 'f', -1, 64), true)
+		if err != nil {
+			return err
+		}
+		*m = amount
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// Value implements driver.Valuer so amounts are sent to Postgres as exact decimals
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// SumMoney adds amounts together
+func SumMoney(amounts ...Money) Money {
+	var total Money
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
+
+// Split divides the amount into n parts that add back up to it exactly. Parts
+// differ by at most one minor unit, with the larger parts first.
+func (m Money) Split(n int) ([]Money, error) {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights)
+}
+
+// Allocate divides the amount in proportion to weights so that the parts add
+// back up to it exactly. Each part first gets the floor of its exact share; the
+// minor units left over go one at a time to the parts with the largest
+// remainders, ties going to the earlier weight.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("at least one weight is required")
+	}
+
+	var weightSum int64
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, errors.New("weights cannot be negative")
+		}
+		weightSum += weight
+	}
+	if weightSum == 0 {
+		return nil, errors.New("weights must not all be zero")
+	}
+
+	total := int64(m)
+	sign := int64(1)
+	if total < 0 {
+		sign, total = -1, -total
+	}
+
+	parts := make([]Money, len(weights))
+	remainders := make([]int64, len(weights))
+	var allocated int64
+	for i, weight := range weights {
+		share := total * weight / weightSum
+		parts[i] = Money(share)
+		remainders[i] = total * weight % weightSum
+		allocated += share
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; allocated < total; i++ {
+		parts[order[i]]++
+		allocated++
+	}
+
+	for i := range parts {
+		parts[i] *= Money(sign)
+	}
+	return parts, nil
+}
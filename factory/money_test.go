@@ -0,0 +1,146 @@
+package factory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{name: "whole number", input: "12", want: 1200},
+		{name: "one decimal place", input: "12.5", want: 1250},
+		{name: "two decimal places", input: "12.34", want: 1234},
+		{name: "negative fraction", input: "-0.05", want: -5},
+		{name: "leading plus", input: "+5", want: 500},
+		{name: "no whole part", input: ".75", want: 75},
+		{name: "trailing point", input: "5.", want: 500},
+		{name: "surrounding spaces", input: " 3.10 ", want: 310},
+		{name: "trailing zeros past two places", input: "1.2500", want: 125},
+		{name: "more than two decimal places", input: "1.005", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+		{name: "sign only", input: "-", wantErr: true},
+		{name: "point only", input: ".", wantErr: true},
+		{name: "two signs", input: "-+5", wantErr: true},
+		{name: "repeated sign", input: "--5", wantErr: true},
+		{name: "sign in fraction", input: "1.+5", wantErr: true},
+		{name: "two points", input: "1.2.3", wantErr: true},
+		{name: "letters", input: "12a", wantErr: true},
+		{name: "exponent", input: "1e3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMoney(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Money
+		wantErr bool
+	}{
+		{name: "null", src: nil, want: 0},
+		{name: "decimal bytes", src: []byte("10.25"), want: 1025},
+		{name: "decimal string", src: "-3.50", want: -350},
+		{name: "rounds half up", src: "0.125", want: 13},
+		{name: "rounds down", src: "0.124", want: 12},
+		{name: "rounds negative away from zero", src: "-0.125", want: -13},
+		{name: "integer", src: int64(7), want: 700},
+		{name: "float", src: 0.1 + 0.2, want: 30},
+		{name: "invalid string", src: "abc", wantErr: true},
+		{name: "two signs", src: "--1", wantErr: true},
+		{name: "unsupported type", src: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			err := got.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan(%v) error = %v, wantErr %v", tt.src, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []int64
+		want    []Money
+		wantErr bool
+	}{
+		{name: "even", amount: 900, weights: []int64{1, 1, 1}, want: []Money{300, 300, 300}},
+		{name: "remainder goes to the earlier weights", amount: 1000, weights: []int64{1, 1, 1}, want: []Money{334, 333, 333}},
+		{name: "largest remainder first", amount: 100, weights: []int64{1, 2}, want: []Money{33, 67}},
+		{name: "negative amount", amount: -1000, weights: []int64{1, 1, 1}, want: []Money{-334, -333, -333}},
+		{name: "zero weight", amount: 500, weights: []int64{0, 1}, want: []Money{0, 500}},
+		{name: "no weights", amount: 100, weights: nil, wantErr: true},
+		{name: "negative weight", amount: 100, weights: []int64{1, -1}, wantErr: true},
+		{name: "all zero weights", amount: 100, weights: []int64{0, 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.Allocate(tt.weights)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Allocate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", got, tt.want)
+			}
+			if sum := SumMoney(got...); sum != tt.amount {
+				t.Errorf("Allocate() parts sum to %s, want %s", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		n       int
+		want    []Money
+		wantErr bool
+	}{
+		{name: "one part", amount: 1001, n: 1, want: []Money{1001}},
+		{name: "even", amount: 1000, n: 4, want: []Money{250, 250, 250, 250}},
+		{name: "uneven", amount: 1001, n: 3, want: []Money{334, 334, 333}},
+		{name: "fewer units than parts", amount: 2, n: 3, want: []Money{1, 1, 0}},
+		{name: "no parts", amount: 100, n: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.Split(tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Split() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package factory
+
+import "time"
+
+// Notification types
+const (
+	NotificationTransactionStatus = "transaction_status" // A transaction the user is part of changed status
+	NotificationRequest           = "request"            // Someone asked the user for money
+	NotificationSettlement        = "settlement"         // Someone recorded a payment to the user
+	NotificationInvitation        = "invitation"         // Someone invited the user to a group
+	NotificationJoinRequest       = "join_request"       // Someone asked to join the user's group, or the user's request was decided
+	NotificationLeaveRequest      = "leave_request"      // Someone asked the user to take over their balances, or the user's request was decided
+)
+
+// Notification is an in-app message shown in the user's notification center.
+// At most one of TransactionID, RequestID, SettlementID and InvitationID is
+// set, pointing at what the notification is about.
+type Notification struct {
+	NotificationID   int        `json:"notification_id"`
+	UserID           int        `json:"user_id"`
+	TransactionID    *int       `json:"transaction_id,omitempty"`
+	RequestID        *int       `json:"request_id,omitempty"`
+	SettlementID     *int       `json:"settlement_id,omitempty"`
+	InvitationID     *int       `json:"invitation_id,omitempty"`
+	NotificationType string     `json:"notification_type"`
+	Message          string     `json:"message"`
+	IsRead           bool       `json:"is_read"`
+	ReadAt           *time.Time `json:"read_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
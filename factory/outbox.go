@@ -0,0 +1,19 @@
+package factory
+
+import "time"
+
+// OutboxMessage is an email waiting in the outbox. It is written in the same
+// database transaction as the change it reports and sent later by the outbox
+// worker.
+type OutboxMessage struct {
+	OutboxID      int        `json:"outbox_id"`
+	Recipient     string     `json:"recipient"`
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`      // Plain text
+	HTMLBody      string     `json:"html_body"` // Optional HTML alternative
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     *string    `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,97 @@
+package factory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Page sizes for list endpoints
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// Sort orders
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// SortCreatedAt is the sort key every list accepts and the default
+const SortCreatedAt = "created_at"
+
+// ErrInvalidPage is wrapped by every error caused by a bad page request, such
+// as an unknown sort key or a cursor from another sort.
+var ErrInvalidPage = errors.New("invalid page request")
+
+// PageRequest selects one page of a list. Paging is keyset based: Cursor is
+// the NextCursor of the previous page, so rows added or removed in the
+// meantime never shift or repeat rows.
+type PageRequest struct {
+	Limit       int
+	Cursor      string
+	SortBy      string     // One of the list's sort keys
+	Order       string     // SortAsc or SortDesc
+	CreatedFrom *time.Time // Inclusive
+	CreatedTo   *time.Time // Exclusive
+}
+
+// WithDefaults fills in the limit, sort key and order when they are not set.
+// Lists sorted by creation time default to newest first, any other sort to
+// ascending.
+func (r PageRequest) WithDefaults() PageRequest {
+	if r.Limit <= 0 {
+		r.Limit = DefaultPageLimit
+	}
+	if r.Limit > MaxPageLimit {
+		r.Limit = MaxPageLimit
+	}
+	if r.SortBy == "" {
+		r.SortBy = SortCreatedAt
+	}
+	if r.Order == "" {
+		r.Order = SortAsc
+		if r.SortBy == SortCreatedAt {
+			r.Order = SortDesc
+		}
+	}
+	return r
+}
+
+// Page is one page of a list. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Cursor points just past the last row of a page: the row's sort key value
+// and ID, along with the sort the page used so it cannot be replayed with
+// another.
+type Cursor struct {
+	SortBy string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	ID     int    `json:"i"`
+}
+
+// Encode turns the cursor into the opaque string handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor made by Encode
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	return c, nil
+}
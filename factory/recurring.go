@@ -0,0 +1,94 @@
+package factory
+
+import (
+	"errors"
+	"time"
+)
+
+// How often a recurring expense repeats
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly" // Same day of the month as StartAt, or the month's last day when it is shorter
+	FrequencyCron    = "cron"    // Follows Cron, a five-field cron expression evaluated in UTC
+)
+
+// RecurringExpense is a template for an expense that is posted again and again
+// on a schedule, e.g. the monthly rent. Each posting is an ordinary expense
+// with its own transaction and splits.
+type RecurringExpense struct {
+	RecurringExpenseID int                  `json:"recurring_expense_id"`
+	GroupID            int                  `json:"group_id"`
+	PayerID            int                  `json:"payer_id"`
+	Amount             Money                `json:"amount"`
+	Currency           string               `json:"currency,omitempty"` // Defaults to the group's currency
+	Purpose            *string              `json:"purpose"`
+	Category           *string              `json:"category,omitempty"`
+	PaymentMethodID    *int                 `json:"payment_method_id,omitempty"`
+	SplitMode          string               `json:"split_mode,omitempty"` // As for Expense; the shares are worked out once, when the template is created
+	Participants       []ExpenseParticipant `json:"participants"`
+	Frequency          string               `json:"frequency"`             // One of the Frequency constants
+	Cron               *string              `json:"cron,omitempty"`        // Only for FrequencyCron
+	StartAt            time.Time            `json:"start_at"`              // The first occurrence, or when the cron schedule starts
+	EndAt              *time.Time           `json:"end_at,omitempty"`      // No occurrences after this time
+	NextRunAt          *time.Time           `json:"next_run_at,omitempty"` // Nil once the schedule has ended
+	Paused             bool                 `json:"paused"`
+	LastError          *string              `json:"last_error,omitempty"` // Why the last posting failed, cleared by the next success
+	CreatedBy          int                  `json:"created_by"`
+	CreatedAt          time.Time            `json:"created_at"`
+}
+
+// RecurringOccurrence records that a recurring expense was posted for one
+// scheduled time. There is at most one per expense and time, which is what
+// keeps postings from being doubled.
+type RecurringOccurrence struct {
+	OccurrenceID       int       `json:"occurrence_id"`
+	RecurringExpenseID int       `json:"recurring_expense_id"`
+	OccurrenceAt       time.Time `json:"occurrence_at"`  // The scheduled time
+	TransactionID      *int      `json:"transaction_id"` // The posted expense; nil once it has been purged
+	CreatedAt          time.Time `json:"created_at"`     // When it was actually posted
+}
+
+// Expense returns one posting of the recurring expense
+func (r *RecurringExpense) Expense() Expense {
+	return Expense{
+		PayerID:         r.PayerID,
+		GroupID:         r.GroupID,
+		Amount:          r.Amount,
+		Currency:        r.Currency,
+		Purpose:         r.Purpose,
+		Category:        r.Category,
+		PaymentMethodID: r.PaymentMethodID,
+		Participants:    append([]ExpenseParticipant{}, r.Participants...),
+	}
+}
+
+// Validate checks the validity of a RecurringExpense object. The cron
+// expression itself is checked when it is parsed.
+func (r *RecurringExpense) Validate() error {
+	expense := r.Expense()
+	if err := expense.Validate(); err != nil {
+		return err
+	}
+
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+		if r.Cron != nil {
+			return errors.New("cron is only allowed with the cron frequency")
+		}
+	case FrequencyCron:
+		if r.Cron == nil || *r.Cron == "" {
+			return errors.New("cron is required with the cron frequency")
+		}
+	default:
+		return errors.New("frequency must be daily, weekly, monthly or cron")
+	}
+
+	if r.StartAt.IsZero() {
+		return errors.New("start_at is required")
+	}
+	if r.EndAt != nil && r.EndAt.Before(r.StartAt) {
+		return errors.New("end_at cannot be before start_at")
+	}
+	return nil
+}
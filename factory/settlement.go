@@ -0,0 +1,22 @@
+package factory
+
+import "time"
+
+type Settlement struct {
+	SettlementID   int       `json:"settlement_id"`
+	UserID         int       `json:"user_id"`            // The user who paid
+	CounterpartyID int       `json:"counterparty_id"`    // The user who received the payment
+	GroupID        *int      `json:"group_id,omitempty"` // Nullable for settlements outside a group
+	Amount         Money     `json:"amount"`
+	Currency       string    `json:"currency"` // ISO 4217 code; defaults to the group's currency
+	SettlementDate time.Time `json:"settlement_date"`
+	Kind           string    `json:"kind"` // One of the Settlement kinds; always payment when recorded by a user
+}
+
+// Settlement kinds. Transfers and write-offs are made when a member leaves a
+// group with outstanding balances.
+const (
+	SettlementPayment  = "payment"
+	SettlementTransfer = "transfer"
+	SettlementWriteOff = "write_off"
+)
@@ -1,31 +1,79 @@
 package factory
 
+import "time"
+
 type Transaction struct {
-	TransactionID   int     `json:"transaction_id"`
-	LenderID        int     `json:"lender_id"`
-	BorrowerID      int     `json:"borrower_id"`
-	GroupID         int     `json:"group_id"` // Pointer for nullable field
-	Amount          float64 `json:"amount"`
-	Status          string  `json:"status"`
-	Purpose         *string `json:"purpose"`           // Pointer for nullable field
-	PaymentMethodID int     `json:"payment_method_id"` // Pointer for nullable field
-	RetryCount      int     `json:"retry_count"`
-	FailureReason   *string `json:"failure_reason"` // Pointer for nullable field
+	TransactionID   int        `json:"transaction_id"`
+	LenderID        int        `json:"lender_id"`
+	BorrowerID      int        `json:"borrower_id"`
+	GroupID         int        `json:"group_id"` // Pointer for nullable field
+	Amount          Money      `json:"amount"`
+	Currency        string     `json:"currency"` // ISO 4217 code; defaults to the group's currency
+	Status          string     `json:"status"`
+	Purpose         *string    `json:"purpose"`           // Pointer for nullable field
+	Category        *string    `json:"category"`          // Free-form label such as "food"; pointer for nullable field
+	PaymentMethodID *int       `json:"payment_method_id"` // Pointer for nullable field
+	RetryCount      int        `json:"retry_count"`
+	FailureReason   *string    `json:"failure_reason"`       // Pointer for nullable field
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"` // Only shown to admins asking for deleted transactions
+	DeletedBy       *int       `json:"deleted_by,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// StatusUpdate asks for a transaction to move to a new status
+type StatusUpdate struct {
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason"` // Required when Status is "failed"
 }
 
+// TransactionFilters narrows a transaction search. Every filter is optional
+// and they all have to match.
 type TransactionFilters struct {
-	LenderID        *int
-	BorrowerID      *int
-	GroupID         *int
-	Status          *string
-	MinAmount       *float64
-	MaxAmount       *float64
-	PaymentMethodID *int
+	LenderID        *int       `json:"lender_id"`
+	BorrowerID      *int       `json:"borrower_id"`
+	GroupID         *int       `json:"group_id"`
+	InvolvingUserID *int       `json:"involving_user_id"` // Lender, borrower or in one of the splits
+	Status          *string    `json:"status"`
+	Statuses        []string   `json:"statuses"` // Any of these; combined with Status when both are given
+	MinAmount       *Money     `json:"min_amount"`
+	MaxAmount       *Money     `json:"max_amount"`
+	Currency        *string    `json:"currency"`
+	PaymentMethodID *int       `json:"payment_method_id"`
+	Category        *string    `json:"category"`
+	Text            string     `json:"text"`         // Full-text search on the purpose
+	CreatedFrom     *time.Time `json:"created_from"` // Inclusive
+	CreatedTo       *time.Time `json:"created_to"`   // Exclusive
+	Aggregate       bool       `json:"aggregate"`    // Also total the matches
+	GroupBy         string     `json:"group_by"`     // Split the totals by status, month or category
+	IncludeDeleted  bool       `json:"-"`            // Set from include_deleted for admins
+}
+
+// Ways search totals can be grouped
+const (
+	GroupByStatus   = "status"
+	GroupByMonth    = "month"
+	GroupByCategory = "category"
+)
+
+// TransactionAggregate totals the transactions matching a search that share
+// a currency and, when grouped, a key such as "pending" or "2024-11"
+type TransactionAggregate struct {
+	Key      string `json:"key,omitempty"`
+	Currency string `json:"currency"`
+	Count    int    `json:"count"`
+	Total    Money  `json:"total"`
+}
+
+// TransactionSearchResult is one page of search matches, with totals over all
+// of them when asked for
+type TransactionSearchResult struct {
+	Page[Transaction]
+	Aggregates []TransactionAggregate `json:"aggregates,omitempty"`
 }
 
 type TransactionSplit struct {
-	TransactionSplitID int     `json:"transaction_split_id,omitempty"`
-	TransactionID      int     `json:"transaction_id"`
-	Amount             float64 `json:"amount"`
-	UserID             int     `json:"user_id"`
+	TransactionSplitID int   `json:"transaction_split_id,omitempty"`
+	TransactionID      int   `json:"transaction_id"`
+	Amount             Money `json:"amount"`
+	UserID             int   `json:"user_id"`
 }
@@ -0,0 +1,24 @@
+package factory
+
+import "time"
+
+// Transaction log actions
+const (
+	TransactionCreated       = "created"
+	TransactionStatusChanged = "status_changed"
+	TransactionRetried       = "retried"
+	TransactionDeleted       = "deleted"
+	TransactionRestored      = "restored"
+)
+
+// TransactionLog is one entry in a transaction's history
+type TransactionLog struct {
+	LogID         int       `json:"log_id"`
+	TransactionID int       `json:"transaction_id"`
+	Action        string    `json:"action"`
+	Status        *string   `json:"status,omitempty"` // The transaction's status after the action
+	Details       *string   `json:"details,omitempty"`
+	ErrorDetails  *string   `json:"error_details,omitempty"`
+	PerformedBy   *int      `json:"performed_by,omitempty"` // Nil once the user is deleted
+	Timestamp     time.Time `json:"timestamp"`
+}
@@ -3,13 +3,29 @@ package factory
 import "time"
 
 type User struct {
-	Email       string `json:"email"`
-	Name        string `json:"name"`
-	FirebaseUID string `json:"firebase_uid"`
-	Verified    bool   `json:"verified"`
+	Email             string     `json:"email"`
+	Name              string     `json:"name"`
+	FirebaseUID       string     `json:"firebase_uid"`
+	Verified          bool       `json:"verified"`
+	Password          string     `json:"password,omitempty"` // Only accepted on sign up, never returned
+	PasswordHash      string     `json:"-"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"` // Set once the user is soft deleted
+	PasswordChangedAt *time.Time `json:"-"`                    // Access tokens issued before this are rejected
 }
 
 type LoginAttempt struct {
 	FailedAttempts int
 	LockoutTime    time.Time
 }
+
+// Locked reports whether the account is locked out at the given time
+func (a LoginAttempt) Locked(now time.Time) bool {
+	return now.Before(a.LockoutTime)
+}
+
+// AuthTokens is what a successful login or refresh hands back to the client
+type AuthTokens struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // When the access token expires
+}
@@ -3,10 +3,17 @@ package balance
 import "github.com/Abhinav7903/split/factory"
 
 type Repository interface {
-	CreateBalance(balance *factory.Balance) (int, error)
+	CreateBalance(balance *factory.Balance, adjustedBy int, reason string) (int, error)
 	GetBalanceByID(balanceID int) (*factory.Balance, error)
 	GetBalancesByUserID(userID int) ([]factory.Balance, error)
 	GetBalancesByGroupID(groupID int) ([]factory.Balance, error)
-	UpdateBalanceAmounts(balanceID int, owedAmount, lentAmount *float64) error
-	DeleteBalance(balanceID int) error
+	AdjustBalanceAmounts(balanceID int, owedAmount, lentAmount *factory.Money, adjustedBy int, reason string) error
+	DeleteBalance(balanceID int, adjustedBy int, reason string) error
+	GetBalanceAdjustments(balanceID int) ([]factory.BalanceAdjustment, error)
+
+	// Balances recomputed from transactions, splits and settlements
+	GetGroupNetBalances(groupID int) ([]factory.NetBalance, error)
+	GetUserNetBalances(userID int) ([]factory.NetBalance, error)
+	GetPairwiseBalance(userID, otherUserID int, groupID *int) ([]factory.PairwiseBalance, error)
+	ReconcileBalances() ([]factory.BalanceDiscrepancy, error)
 }
@@ -0,0 +1,34 @@
+package exchange
+
+import (
+	"math/big"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Convert changes amount from one currency into another, rounding half away
+// from zero to the nearest minor unit.
+func Convert(provider Provider, amount factory.Money, from, to string) (factory.Money, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	rate, err := provider.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	converted := new(big.Rat).Mul(big.NewRat(int64(amount), 1), rate)
+
+	// Round the quotient num/denom half away from zero
+	num := new(big.Int).Abs(converted.Num())
+	denom := converted.Denom()
+	quotient, remainder := new(big.Int).QuoRem(num, denom, new(big.Int))
+	if remainder.Lsh(remainder, 1).Cmp(denom) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if converted.Sign() < 0 {
+		quotient.Neg(quotient)
+	}
+	return factory.Money(quotient.Int64()), nil
+}
@@ -0,0 +1,9 @@
+package exchange
+
+import "math/big"
+
+// Provider supplies exchange rates between currencies
+type Provider interface {
+	// Rate returns how many units of `to` one unit of `from` is worth
+	Rate(from, to string) (*big.Rat, error)
+}
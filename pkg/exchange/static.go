@@ -0,0 +1,74 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Static serves fixed rates quoted against a single base currency
+type Static struct {
+	base  string
+	rates map[string]*big.Rat // units of the currency per one unit of base
+}
+
+// NewStatic creates a provider from rates quoted against base, for example
+// base "INR" with {"USD": "0.012"}. Rates are decimal strings so they are
+// kept exactly.
+func NewStatic(base string, rates map[string]string) (*Static, error) {
+	base, err := factory.NormalizeCurrency(base)
+	if err != nil {
+		return nil, err
+	}
+
+	static := &Static{
+		base:  base,
+		rates: map[string]*big.Rat{base: big.NewRat(1, 1)},
+	}
+	for code, value := range rates {
+		code, err := factory.NormalizeCurrency(code)
+		if err != nil {
+			return nil, err
+		}
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", value, code)
+		}
+		static.rates[code] = rate
+	}
+	return static, nil
+}
+
+// LoadFile reads rates from a JSON file shaped like
+// {"base": "INR", "rates": {"USD": "0.012", "EUR": "0.011"}}
+func LoadFile(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	var file struct {
+		Base  string            `json:"base"`
+		Rates map[string]string `json:"rates"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+	return NewStatic(file.Base, file.Rates)
+}
+
+// Rate returns how many units of `to` one unit of `from` is worth
+func (s *Static) Rate(from, to string) (*big.Rat, error) {
+	fromRate, ok := s.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("no exchange rate for %s", from)
+	}
+	toRate, ok := s.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("no exchange rate for %s", to)
+	}
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
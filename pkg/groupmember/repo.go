@@ -1,13 +1,52 @@
 package groupmember
 
-import "github.com/Abhinav7903/split/factory"
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+var (
+	ErrNotMember        = errors.New("user is not a member of the group")
+	ErrOwnerRole        = errors.New("the owner's role only changes by transferring ownership")
+	ErrOwnerCannotLeave = errors.New("the owner must transfer ownership before leaving the group")
+
+	ErrOutstandingBalance = errors.New("member still owes or is owed money in the group")
+	ErrSelfWriteOff       = errors.New("members cannot write off what they owe when they leave")
+
+	ErrLeaveRequestNotFound = errors.New("leave request not found")
+	ErrLeaveRequestClosed   = errors.New("leave request has already been decided")
+	ErrLeaveRequestPending  = errors.New("a leave request is already waiting for approval")
+)
+
+// OutstandingBalanceError stops a member from leaving while they still owe or
+// are owed money. It matches ErrOutstandingBalance with errors.Is.
+type OutstandingBalanceError struct {
+	Balances []factory.PairwiseBalance // What the member and each other member owe each other
+}
+
+func (e *OutstandingBalanceError) Error() string {
+	return ErrOutstandingBalance.Error()
+}
+
+func (e *OutstandingBalanceError) Is(target error) bool {
+	return target == ErrOutstandingBalance
+}
 
 type Repository interface {
-	AddGroupMember(groupMember factory.GroupMember) (int, error)         //AddGroupMember adds a new group member to the database and returns the ID of the new group member
-	GetGroupMemberByID(groupMemberID int) (*factory.GroupMember, error)  //GetGroupMemberByID returns the group member with the given ID
-	GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember, error) //GetGroupMembersByGroupID returns all the group members in the group with the given ID
-	RemoveUserFromGroupByCreator(groupID, userID, creatorID int) error   //RemoveUserFromGroupByCreator removes the user with the given ID from the group with the given ID
-	RemoveUserSelf(groupID, userID int) error                            //RemoveUserSelf removes the user with the given ID from the group with the given ID
+	AddGroupMember(groupMember factory.GroupMember) (int, error)                                 //AddGroupMember adds a new group member to the database and returns the ID of the new group member
+	GetGroupMemberByID(groupMemberID int) (*factory.GroupMember, error)                          //GetGroupMemberByID returns the group member with the given ID
+	GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember, error)                         //GetGroupMembersByGroupID returns all the group members in the group with the given ID
+	RemoveUserFromGroup(removal factory.MemberRemoval) error                                     //RemoveUserFromGroup marks another member inactive, settling their balances as asked; the owner cannot be removed
+	RemoveUserSelf(removal factory.MemberRemoval) error                                          //RemoveUserSelf marks the leaving member inactive, settling their balances as asked
+	IsGroupMember(groupID, userID int) (bool, error)                                             //IsGroupMember reports whether the user with the given ID belongs to the group with the given ID
+	ListGroupsForUser(userID int, page factory.PageRequest) (factory.Page[factory.Group], error) //ListGroupsForUser returns a page of the groups that the user with the given ID is a member of
+	GetMemberRole(groupID, userID int) (string, error)                                           //GetMemberRole returns the user's role in the group, or ErrNotMember
+	SetMemberRole(groupID, userID int, role string) error                                        //SetMemberRole changes a member's role to admin, member or viewer
+	TransferOwnership(groupID, fromUserID, toUserID int) error                                   //TransferOwnership makes another member the owner; the old owner becomes an admin
+	RequestLeave(removal factory.MemberRemoval) (factory.LeaveRequest, error)                    //RequestLeave records that a member wants to leave handing their balances to removal.TransferTo, who or the owner must approve it
+	GetLeaveRequest(leaveRequestID int) (factory.LeaveRequest, error)                            //GetLeaveRequest returns the leave request, or ErrLeaveRequestNotFound
+	ListLeaveRequests(groupID int) ([]factory.LeaveRequest, error)                               //ListLeaveRequests returns the group's pending leave requests
+	DecideLeaveRequest(leaveRequestID int, approve bool, decidedBy int) error                    //DecideLeaveRequest approves a pending leave request, removing the member and transferring their balances, or rejects it
 	// CountMembersInGroup(groupID int) (int, error)                                      //CountMembersInGroup returns the number of members in the group with the given ID
-	// ListGroupsForUser(userID int) ([]factory.Group, error)                             //ListGroupsForUser returns all the groups that the user with the given ID is a member of
 }
@@ -1,12 +1,41 @@
 package groups
 
-import "github.com/Abhinav7903/split/factory"
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/settleup"
+)
+
+var (
+	ErrNotFound        = errors.New("group not found")
+	ErrArchived        = errors.New("group is archived")
+	ErrNotArchived     = errors.New("group is not archived")
+	ErrUnbalancedGroup = errors.New("group balances do not add up, reconcile before closing out")
+
+	ErrNotClosedOut        = errors.New("group must be closed out before it is permanently deleted")
+	ErrOutstandingBalances = errors.New("group still has outstanding balances")
+)
+
+// CloseOut is a group's final position when it is closed out: what everyone is
+// owed or owes and the transfers that settle it all.
+type CloseOut struct {
+	GroupID   int                  `json:"group_id"`
+	Balances  []factory.NetBalance `json:"balances"`
+	Transfers []settleup.Transfer  `json:"transfers"`
+}
 
 type Repository interface {
-	AddGroup(group factory.Group) (int, error)   // Return the ID of the new group
-	GetGroup(groupID int) (factory.Group, error) // Use int for groupID
-	GetAllGroups() ([]factory.Group, error)
+	AddGroup(group factory.Group) (int, error)                        // Return the ID of the new group
+	GetGroup(groupID int, includeDeleted bool) (factory.Group, error) // Use int for groupID
+	GetAllGroups(includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Group], error)
 	UpdateGroup(group factory.Group) error
-	DeleteGroup(groupID int) error // Use int for groupID
+	DeleteGroup(groupID int, deletedBy int) error // Soft delete, undone by RestoreGroup
+	RestoreGroup(groupID int, restoredBy int) error
 	GroupExists(groupID int) (bool, error)
+	ArchiveGroup(groupID int, archivedBy int) error                               // Make the group read-only, undone by UnarchiveGroup
+	UnarchiveGroup(groupID int, unarchivedBy int) error                           // Make an archived group writable again
+	CloseOutGroup(groupID int, closedBy int) (CloseOut, error)                    // Archive the group and record its final settle-up plan
+	PurgeGroup(groupID int, purgedBy int, force bool) ([]factory.GroupLog, error) // Permanently delete a closed out, settled group and everything in it, returning one log entry per step; force skips the checks and is logged
+	GetGroupLogs(groupID int) ([]factory.GroupLog, error)                         // The group's lifecycle history, oldest first; kept after a purge
 }
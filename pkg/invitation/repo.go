@@ -0,0 +1,62 @@
+package invitation
+
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+var (
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvitationClosed    = errors.New("invitation has already been answered, revoked or has expired")
+	ErrAlreadyInvited      = errors.New("user already has an open invitation to this group")
+	ErrAlreadyMember       = errors.New("user is already a member of this group")
+	ErrJoinCodeInvalid     = errors.New("join code is unknown, revoked, expired or used up")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrJoinRequestClosed   = errors.New("join request has already been decided")
+)
+
+type Repository interface {
+	// Invite a user to a group, queueing the given emails with the invitation.
+	// An email belonging to an existing user is resolved to their ID.
+	CreateInvitation(invitation factory.Invitation, messages ...factory.OutboxMessage) (factory.Invitation, error)
+
+	GetInvitation(invitationID int) (factory.Invitation, error)
+
+	// Pending invitations addressed to the user's ID or email
+	ListInvitationsForUser(userID int, email string) ([]factory.Invitation, error)
+
+	// Every invitation to the group, newest first
+	ListInvitationsForGroup(groupID int) ([]factory.Invitation, error)
+
+	// Accept an invitation addressed to the user, adding them to the group.
+	// Returns the new group member ID.
+	AcceptInvitation(invitationID, userID int, email string) (int, error)
+
+	// Decline an invitation addressed to the user
+	DeclineInvitation(invitationID, userID int, email string) error
+
+	// Withdraw a pending invitation
+	RevokeInvitation(invitationID int) error
+
+	// Create a join code for a group; the code itself is generated
+	CreateJoinCode(code factory.JoinCode) (factory.JoinCode, error)
+
+	GetJoinCode(code string) (factory.JoinCode, error)
+
+	ListJoinCodes(groupID int) ([]factory.JoinCode, error)
+
+	RevokeJoinCode(code string) error
+
+	// Use a join code. The request comes back approved when the user joined
+	// straight away and pending when an owner or admin has to approve.
+	JoinWithCode(code string, userID int) (factory.JoinRequest, error)
+
+	GetJoinRequest(joinRequestID int) (factory.JoinRequest, error)
+
+	// Pending join requests for a group, oldest first
+	ListJoinRequests(groupID int) ([]factory.JoinRequest, error)
+
+	// Approve or reject a pending join request; approving adds the member
+	DecideJoinRequest(joinRequestID int, approve bool, decidedBy int) error
+}
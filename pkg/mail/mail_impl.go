@@ -2,67 +2,44 @@ package mail
 
 import (
 	"fmt"
-	"log"
-	"net/smtp"
-	"strings"
 )
 
 type Mail struct {
-	From     string
-	Password string
-	AppPass  string
+	From      string
+	Transport Transport
 }
 
-// NewMail creates a new Mail instance with the sender's credentials
-func NewMail(from, password, appPass string) *Mail {
+// NewMail creates a new Mail instance that delivers through transport
+func NewMail(from string, transport Transport) *Mail {
 	return &Mail{
-		From:     from,
-		Password: password,
-		AppPass:  appPass,
+		From:      from,
+		Transport: transport,
 	}
 }
 
-// SendMail sends an email to the specified recipient(s)
-// It prioritizes using the App Password if available.
-func (m *Mail) SendMail(to, subject, body string) error {
-	// Use AppPass if provided, otherwise fall back to Password
-	authPassword := m.AppPass
-	if authPassword == "" {
-		authPassword = m.Password
+// Send encodes the message as MIME and hands it to the transport
+func (m *Mail) Send(message Message) error {
+	if len(message.To) == 0 {
+		return fmt.Errorf("failed to send email: no recipients")
 	}
 
-	// Log the sender's email for debugging (do not log sensitive credentials)
-	fmt.Printf("Attempting to send email from: %s\n", m.From)
-	log.Println("Using App Password: ", m.AppPass != "")
-
-	// Create the SMTP authentication
-	auth := smtp.PlainAuth("", m.From, authPassword, "smtp.gmail.com")
-
-	// Create the email message
-	msg := fmt.Sprintf(
-		"From: %s\nTo: %s\nSubject: %s\n\n%s",
-		m.From,
-		to,
-		subject,
-		body,
-	)
-
-	// Split the recipient addresses if there are multiple
-	recipients := strings.Split(to, ",")
-
-	// Use smtp.SendMail to send the email
-	err := smtp.SendMail(
-		"smtp.gmail.com:587", // SMTP server and port
-		auth,                 // Authentication
-		m.From,               // Sender email
-		recipients,           // Recipient email(s)
-		[]byte(msg),          // Email body as bytes
-	)
+	raw, err := buildMIME(m.From, message)
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
 
+	// The envelope only carries the bare addresses
+	recipients, err := parseRecipients(message.To)
 	if err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
+	to := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		to[i] = recipient.Address
+	}
 
-	fmt.Println("Email sent successfully")
+	if err := m.Transport.Deliver(m.From, to, raw); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRecipient is returned for a recipient that is not a single valid
+// email address
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+// parseRecipients parses every recipient as an RFC 5322 address. Line breaks
+// are refused outright so a recipient can never add headers of its own.
+func parseRecipients(to []string) ([]*netmail.Address, error) {
+	addresses := make([]*netmail.Address, len(to))
+	for i, recipient := range to {
+		if strings.ContainsAny(recipient, "\r\n") {
+			return nil, fmt.Errorf("%w %q: contains a line break", ErrInvalidRecipient, recipient)
+		}
+		address, err := netmail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidRecipient, recipient, err)
+		}
+		addresses[i] = address
+	}
+	return addresses, nil
+}
+
+// buildMIME renders the message with its headers. A message with an HTML body
+// is sent as multipart/alternative with the text part first, as RFC 2046 asks.
+func buildMIME(from string, message Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	recipients, err := parseRecipients(message.To)
+	if err != nil {
+		return nil, err
+	}
+	to := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		to[i] = recipient.String()
+	}
+
+	messageID, err := newMessageID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID)
+	header.Set("MIME-Version", "1.0")
+
+	if message.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(&buf, header)
+		if err := writeQuotedPrintable(&buf, message.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	writeHeader(&buf, header)
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHeader writes the headers in a fixed order followed by the blank line
+// that ends them
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, key := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// newMessageID returns a unique Message-ID on the sender's domain
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	domain := "localhost"
+	if _, host, ok := strings.Cut(from, "@"); ok && host != "" {
+		domain = strings.TrimSuffix(host, ">")
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// send delivers message through a MemoryTransport and parses what was sent
+func send(t *testing.T, message Message) (SentMessage, *netmail.Message) {
+	t.Helper()
+	transport := NewMemoryTransport()
+	if err := NewMail("Split <noreply@split.example>", transport).Send(message); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	sent := transport.Messages()
+	if len(sent) != 1 {
+		t.Fatalf("delivered %d messages, want 1", len(sent))
+	}
+	parsed, err := netmail.ReadMessage(bytes.NewReader(sent[0].Raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	return sent[0], parsed
+}
+
+func TestSendPlainText(t *testing.T) {
+	sent, parsed := send(t, Message{
+		To:      []string{"Asha Rao <asha@example.com>", "ravi@example.com"},
+		Subject: "Paiement reçu ✓",
+		Text:    "You owe ₹250.00 = your share of dinner",
+	})
+
+	if want := []string{"asha@example.com", "ravi@example.com"}; !reflect.DeepEqual(sent.To, want) {
+		t.Errorf("envelope recipients = %v, want %v", sent.To, want)
+	}
+	if got, want := parsed.Header.Get("To"), `"Asha Rao" <asha@example.com>, <ravi@example.com>`; got != want {
+		t.Errorf("To = %q, want %q", got, want)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader() error = %v", err)
+	}
+	if subject != "Paiement reçu ✓" {
+		t.Errorf("Subject = %q, want %q", subject, "Paiement reçu ✓")
+	}
+
+	if got := parsed.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if !strings.HasSuffix(parsed.Header.Get("Message-ID"), "@split.example>") {
+		t.Errorf("Message-ID = %q, want one on the sender's domain", parsed.Header.Get("Message-ID"))
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if string(body) != "You owe ₹250.00 = your share of dinner" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSendAlternative(t *testing.T) {
+	_, parsed := send(t, Message{
+		To:      []string{"asha@example.com"},
+		Subject: "Invitation",
+		Text:    "Join the group",
+		HTML:    "<p>Join the group</p>",
+	})
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, error = %v", parsed.Header.Get("Content-Type"), err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Join the group"},
+		{"text/html; charset=utf-8", "<p>Join the group</p>"},
+	} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		if got := part.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type = %q, want %q", got, want.contentType)
+		}
+		// multipart.Reader undoes the quoted-printable encoding itself
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		if string(body) != want.body {
+			t.Errorf("part body = %q, want %q", body, want.body)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("NextPart() error = %v, want io.EOF after two parts", err)
+	}
+}
+
+func TestSendRejectsInvalidRecipients(t *testing.T) {
+	tests := []string{
+		"asha@example.com\r\nBcc: everyone@example.com",
+		"asha@example.com\nSubject: hello",
+		"not an address",
+		"",
+	}
+
+	for _, recipient := range tests {
+		t.Run(recipient, func(t *testing.T) {
+			transport := NewMemoryTransport()
+			err := NewMail("noreply@split.example", transport).Send(Message{
+				To:      []string{"ravi@example.com", recipient},
+				Subject: "Hello",
+				Text:    "Hello",
+			})
+			if !errors.Is(err, ErrInvalidRecipient) {
+				t.Errorf("Send() error = %v, want ErrInvalidRecipient", err)
+			}
+			if len(transport.Messages()) != 0 {
+				t.Errorf("a message was delivered")
+			}
+		})
+	}
+}
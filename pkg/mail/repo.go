@@ -1,5 +1,14 @@
 package mail
 
 type Repository interface {
-	SendMail(to, subject, body string) error
+	Send(message Message) error
+}
+
+// Message is an email with a plain text body and an optional HTML
+// alternative. Mail clients show the HTML part when they can.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
 }
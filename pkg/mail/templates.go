@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Each template has a text file, which also defines the "subject" template,
+// and an HTML file under templates/.
+const (
+	TemplateVerification      = "verification"
+	TemplatePaymentRequest    = "payment_request"
+	TemplateReminder          = "reminder"
+	TemplateSettlementReceipt = "settlement_receipt"
+	TemplateWeeklyDigest      = "weekly_digest"
+	TemplateGroupInvitation   = "group_invitation"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+func init() {
+	for _, name := range []string{
+		TemplateVerification,
+		TemplatePaymentRequest,
+		TemplateReminder,
+		TemplateSettlementReceipt,
+		TemplateWeeklyDigest,
+		TemplateGroupInvitation,
+	} {
+		textTemplates[name] = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/"+name+".txt"))
+		htmlTemplates[name] = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/"+name+".html"))
+	}
+}
+
+// VerificationData fills the verification template
+type VerificationData struct {
+	Name      string
+	Link      string
+	ExpiresIn string
+}
+
+// PaymentRequestData fills the payment request template
+type PaymentRequestData struct {
+	SenderName   string
+	ReceiverName string
+	Amount       factory.Money
+	Currency     string
+	Link         string
+}
+
+// ReminderData fills the reminder template
+type ReminderData struct {
+	Name             string
+	CounterpartyName string
+	GroupName        string
+	Amount           factory.Money
+	Currency         string
+	Link             string
+}
+
+// SettlementReceiptData fills the settlement receipt template
+type SettlementReceiptData struct {
+	Name             string // Who the receipt is addressed to
+	PayerName        string
+	CounterpartyName string
+	Amount           factory.Money
+	Currency         string
+	Date             time.Time
+	SettlementID     int
+}
+
+// WeeklyDigestData fills the weekly digest template
+type WeeklyDigestData struct {
+	Name        string
+	WeekOf      time.Time
+	Balances    []DigestBalance
+	NewExpenses int
+}
+
+// DigestBalance is one line of the weekly digest
+type DigestBalance struct {
+	Counterparty string
+	Amount       factory.Money
+	Currency     string
+	YouOwe       bool // Whether the reader owes the counterparty, rather than the other way round
+}
+
+// GroupInvitationData fills the group invitation template
+type GroupInvitationData struct {
+	Name        string // Empty when the invitee has no account yet
+	InviterName string
+	GroupName   string
+	Link        string
+	ExpiresAt   time.Time
+}
+
+// Render fills the named template with data and returns the subject and both
+// bodies. The caller sets the recipients.
+func Render(name string, data any) (Message, error) {
+	text, ok := textTemplates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s subject: %w", name, err)
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s text: %w", name, err)
+	}
+	if err := htmlTemplates[name].Execute(&htmlBody, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s html: %w", name, err)
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    textBody.String(),
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,187 @@
+package mail
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Transport delivers an encoded message to its recipients
+type Transport interface {
+	Deliver(from string, to []string, raw []byte) error
+}
+
+// TLS modes for SMTPTransport
+const (
+	TLSStartTLS = "starttls" // Plain connection upgraded with STARTTLS
+	TLSImplicit = "tls"      // TLS from the start, usually port 465
+	TLSNone     = "none"     // No encryption, for local relays only
+)
+
+// SMTPTransport sends mail through an SMTP server
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	TLS      string
+}
+
+// NewSMTPTransport returns a transport for the given server. Authentication is
+// skipped when username is empty.
+func NewSMTPTransport(host string, port int, username, password, tlsMode string) *SMTPTransport {
+	return &SMTPTransport{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		TLS:      tlsMode,
+	}
+}
+
+func (t *SMTPTransport) Deliver(from string, to []string, raw []byte) error {
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	tlsConfig := &tls.Config{ServerName: t.Host}
+
+	var client *smtp.Client
+	switch t.TLS {
+	case TLSImplicit:
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		}
+		client, err = smtp.NewClient(conn, t.Host)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to start smtp session: %w", err)
+		}
+	case TLSStartTLS, TLSNone, "":
+		var err error
+		client, err = smtp.Dial(addr)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		}
+		if t.TLS != TLSNone {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return fmt.Errorf("failed to start tls: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown smtp tls mode %q", t.TLS)
+	}
+	defer client.Close()
+
+	if t.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", recipient, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// FileTransport writes each message into a maildir, for local development.
+// Point a mail client at the directory to read what would have been sent.
+type FileTransport struct {
+	Dir string
+}
+
+func NewFileTransport(dir string) *FileTransport {
+	return &FileTransport{Dir: dir}
+}
+
+// Deliver writes the message to tmp/ and moves it into new/, so readers never
+// see a half-written file
+func (t *FileTransport) Deliver(from string, to []string, raw []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create maildir: %w", err)
+		}
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("failed to name message file: %w", err)
+	}
+	hostname, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(b), hostname)
+
+	tmpPath := filepath.Join(t.Dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(t.Dir, "new", name)); err != nil {
+		return fmt.Errorf("failed to deliver message: %w", err)
+	}
+	return nil
+}
+
+// SentMessage is a message captured by MemoryTransport
+type SentMessage struct {
+	From string
+	To   []string
+	Raw  []byte
+}
+
+// MemoryTransport keeps messages in memory instead of sending them, for tests
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []SentMessage
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{}
+}
+
+func (t *MemoryTransport) Deliver(from string, to []string, raw []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, SentMessage{
+		From: from,
+		To:   append([]string(nil), to...),
+		Raw:  append([]byte(nil), raw...),
+	})
+	return nil
+}
+
+// Messages returns a copy of everything delivered so far
+func (t *MemoryTransport) Messages() []SentMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SentMessage(nil), t.messages...)
+}
+
+// Reset forgets the delivered messages
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = nil
+}
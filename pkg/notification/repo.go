@@ -0,0 +1,20 @@
+package notification
+
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// ErrNotificationNotFound is returned when the notification does not exist or
+// belongs to another user.
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notifications are created by the repositories that make the change they
+// describe, in the same database transaction, so there is no create method.
+type Repository interface {
+	GetNotifications(userID, limit, offset int) ([]factory.Notification, error) // Newest first
+	MarkNotificationRead(userID, notificationID int) error
+	MarkAllNotificationsRead(userID int) (int64, error) // Returns how many were marked
+	GetUnreadNotificationCount(userID int) (int, error)
+}
@@ -0,0 +1,17 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+type Repository interface {
+	// Enqueue adds messages that are not tied to any other database change
+	Enqueue(messages ...factory.OutboxMessage) error
+	// ClaimDue locks up to limit unsent messages that are due, counts the
+	// attempt and hides them from other workers until lease has passed
+	ClaimDue(limit, maxAttempts int, lease time.Duration) ([]factory.OutboxMessage, error)
+	MarkSent(outboxID int) error
+	MarkFailed(outboxID int, reason string, nextAttemptAt time.Time) error
+}
@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/mail"
+	"golang.org/x/exp/slog"
+)
+
+// Worker drains the outbox, sending each message through mail. Failed sends
+// are retried with exponential backoff until MaxAttempts is reached; after
+// that the message stays in the outbox with its last error for inspection.
+type Worker struct {
+	Repo        Repository
+	Mail        mail.Repository
+	Logger      *slog.Logger
+	Interval    time.Duration // How often the outbox is polled
+	BatchSize   int           // Messages claimed per poll
+	MaxAttempts int
+	BaseBackoff time.Duration // Delay after the first failure, doubled after each one
+	MaxBackoff  time.Duration
+	SendTimeout time.Duration // How long a claimed message is hidden from other workers
+}
+
+// NewWorker returns a worker with the given polling and retry settings
+func NewWorker(repo Repository, mailer mail.Repository, logger *slog.Logger, interval time.Duration, maxAttempts int, baseBackoff time.Duration) *Worker {
+	return &Worker{
+		Repo:        repo,
+		Mail:        mailer,
+		Logger:      logger,
+		Interval:    interval,
+		BatchSize:   20,
+		MaxAttempts: maxAttempts,
+		BaseBackoff: baseBackoff,
+		MaxBackoff:  6 * time.Hour,
+		SendTimeout: 5 * time.Minute,
+	}
+}
+
+// Run polls the outbox every Interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.drain()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain sends due messages until a poll comes back short
+func (w *Worker) drain() {
+	for {
+		messages, err := w.Repo.ClaimDue(w.BatchSize, w.MaxAttempts, w.SendTimeout)
+		if err != nil {
+			w.Logger.Error("failed to claim outbox messages", "error", err)
+			return
+		}
+
+		for _, message := range messages {
+			w.send(message)
+		}
+
+		if len(messages) < w.BatchSize {
+			return
+		}
+	}
+}
+
+func (w *Worker) send(message factory.OutboxMessage) {
+	outboxID, attempts := message.OutboxID, message.Attempts
+	err := w.Mail.Send(mail.Message{
+		To:      []string{message.Recipient},
+		Subject: message.Subject,
+		Text:    message.Body,
+		HTML:    message.HTMLBody,
+	})
+	if err != nil {
+		next := time.Now().Add(w.Backoff(attempts))
+		w.Logger.Warn("failed to send outbox message",
+			"outbox_id", outboxID,
+			"attempts", attempts,
+			"next_attempt_at", next,
+			"error", err,
+		)
+		if attempts >= w.MaxAttempts {
+			w.Logger.Error("giving up on outbox message", "outbox_id", outboxID, "attempts", attempts)
+		}
+		if err := w.Repo.MarkFailed(outboxID, err.Error(), next); err != nil {
+			w.Logger.Error("failed to record outbox failure", "outbox_id", outboxID, "error", err)
+		}
+		return
+	}
+
+	if err := w.Repo.MarkSent(outboxID); err != nil {
+		// The message will be sent again once its lease runs out
+		w.Logger.Error("failed to mark outbox message as sent", "outbox_id", outboxID, "error", err)
+	}
+}
+
+// Backoff returns how long to wait after the given number of failed attempts
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.MaxBackoff {
+			return w.MaxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,177 @@
+package recurring
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchYears is how far ahead Next looks before deciding an expression
+// never fires, e.g. "0 0 30 2 *"
+const cronSearchYears = 5
+
+// cronField is the range and optional names of one cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = cronField{name: "minute", min: 0, max: 59}
+	hourField   = cronField{name: "hour", min: 0, max: 23}
+	domField    = cronField{name: "day of month", min: 1, max: 31}
+	monthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday is both 0 and 7
+	dowField = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Cron is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week. Each field takes *, a number or name, a range a-b,
+// a step */n, a-b/n or a/n, or a comma separated list of those. As in Vixie
+// cron, when both day fields are restricted a day matching either one fires;
+// a day field starting with *, such as */2, counts as unrestricted, so the
+// other day field then has to match as well.
+type Cron struct {
+	minute, hour, dom, month, dow uint64 // Bit n is set when value n matches
+	domAny, dowAny                bool   // The day field started with *
+}
+
+// ParseCron parses a five-field cron expression
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, has %d", expr, len(fields))
+	}
+
+	c := &Cron{
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	if c.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], domField); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 << 0
+	}
+	return c, nil
+}
+
+func parseCronField(spec string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", field.name, part)
+			}
+			rangeSpec, step = part[:i], n
+		}
+
+		var low, high int
+		switch {
+		case rangeSpec == "*":
+			low, high = field.min, field.max
+		case strings.Contains(rangeSpec, "-"):
+			bounds := strings.SplitN(rangeSpec, "-", 2)
+			var err error
+			if low, err = field.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = field.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %s field %q", field.name, part)
+			}
+		default:
+			var err error
+			if low, err = field.value(rangeSpec); err != nil {
+				return 0, err
+			}
+			// A single value with a step, e.g. 5/15, runs to the end of the range
+			high = low
+			if step > 1 {
+				high = field.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name in the field's range
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %d is outside %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first minute strictly after t that matches the expression,
+// in t's location, or the zero time when nothing matches within five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	loc := t.Location()
+	limit := t.Year() + cronSearchYears
+
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
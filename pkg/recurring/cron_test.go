@@ -0,0 +1,131 @@
+package recurring
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"61 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"* * * FOO *",
+		"1,,2 * * * *",
+	}
+
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseCron(expr); err == nil {
+				t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"list of days", "30 9 1,15 * *", date(2024, 1, 1, 0, 0), date(2024, 1, 1, 9, 30)},
+		{"strictly after", "30 9 1,15 * *", date(2024, 1, 1, 9, 30), date(2024, 1, 15, 9, 30)},
+		{"seconds are ignored", "30 9 1,15 * *", date(2024, 1, 1, 9, 29).Add(59 * time.Second), date(2024, 1, 1, 9, 30)},
+		{"every minute", "* * * * *", date(2024, 1, 1, 23, 59), date(2024, 1, 2, 0, 0)},
+		{"minute step", "*/15 * * * *", date(2024, 1, 1, 10, 31), date(2024, 1, 1, 10, 45)},
+		{"value with step", "5/20 * * * *", date(2024, 1, 1, 10, 26), date(2024, 1, 1, 10, 45)},
+		{"named range with step", "0 0 * * MON-FRI/2", date(2024, 1, 1, 0, 0), date(2024, 1, 3, 0, 0)},
+		{"named month", "0 0 1 mar *", date(2024, 1, 1, 0, 0), date(2024, 3, 1, 0, 0)},
+		{"year rollover", "0 0 1 1 *", date(2024, 6, 1, 0, 0), date(2025, 1, 1, 0, 0)},
+		{"sunday as 7", "0 12 * * 7", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 12, 0)},
+		{"sunday as 0", "0 12 * * 0", date(2024, 1, 1, 0, 0), date(2024, 1, 7, 12, 0)},
+		{"leap day", "0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},
+
+		// Both day fields restricted: either one matching is enough
+		{"day of month or week", "0 0 13 * FRI", date(2024, 1, 1, 0, 0), date(2024, 1, 5, 0, 0)},
+		// A day field starting with * is unrestricted, so both must match
+		{"day of month step and weekday", "0 0 */2 * MON", date(2024, 1, 1, 0, 0), date(2024, 1, 15, 0, 0)},
+		{"day of month and weekday step", "0 0 1 * */2", date(2024, 1, 1, 0, 0), date(2024, 2, 1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := cron.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	jan31 := date(2024, 1, 31, 9, 0)
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{jan31, 1, date(2024, 2, 29, 9, 0)},
+		{jan31, 2, date(2024, 3, 31, 9, 0)},
+		{jan31, 3, date(2024, 4, 30, 9, 0)},
+		{jan31, 12, date(2025, 1, 31, 9, 0)},
+		{jan31, 13, date(2025, 2, 28, 9, 0)},
+		{date(2024, 3, 31, 9, 0), -1, date(2024, 2, 29, 9, 0)},
+		{date(2024, 1, 15, 9, 0), 1, date(2024, 2, 15, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonths(%v, %d) = %v, want %v", tt.from, tt.months, got, tt.want)
+		}
+	}
+}
+
+func TestIntervalNext(t *testing.T) {
+	daily := interval{start: date(2024, 1, 1, 9, 0), days: 1}
+	weekly := interval{start: date(2024, 1, 1, 9, 0), days: 7}
+	monthly := interval{start: date(2024, 1, 31, 9, 0), months: 1}
+
+	tests := []struct {
+		name     string
+		schedule interval
+		after    time.Time
+		want     time.Time
+	}{
+		{"before start", daily, date(2023, 12, 1, 0, 0), date(2024, 1, 1, 9, 0)},
+		{"on an occurrence", daily, date(2024, 3, 10, 9, 0), date(2024, 3, 11, 9, 0)},
+		{"just before an occurrence", daily, date(2024, 3, 10, 8, 59), date(2024, 3, 10, 9, 0)},
+		{"long after start", weekly, date(2024, 1, 1, 9, 0).AddDate(0, 0, 7000).Add(-time.Second), date(2024, 1, 1, 9, 0).AddDate(0, 0, 7000)},
+		{"monthly after start", monthly, date(2024, 1, 31, 9, 0), date(2024, 2, 29, 9, 0)},
+		{"monthly does not drift", monthly, date(2024, 2, 29, 9, 0), date(2024, 3, 31, 9, 0)},
+		{"monthly early in the month", monthly, date(2024, 5, 1, 0, 0), date(2024, 5, 31, 9, 0)},
+		{"monthly late in a short month", monthly, date(2024, 3, 30, 0, 0), date(2024, 3, 31, 9, 0)},
+		{"monthly years later", monthly, date(2030, 6, 30, 9, 0), date(2030, 7, 31, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package recurring
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+var (
+	ErrNotFound = errors.New("recurring expense not found")
+	// ErrMemberLeft is returned by PostOccurrence when the payer or a
+	// participant has left the group. The template has been paused by then.
+	ErrMemberLeft = errors.New("the payer or a participant is no longer a member of the group, so the recurring expense was paused")
+)
+
+type Repository interface {
+	CreateRecurringExpense(r *factory.RecurringExpense) (int, error)                           // CreateRecurringExpense stores the template and its shares; NextRunAt must already be set and everyone in it must be a current member
+	GetRecurringExpense(recurringExpenseID int) (*factory.RecurringExpense, error)             // GetRecurringExpense returns a template that has not been deleted, or ErrNotFound
+	ListRecurringExpenses(groupID int) ([]factory.RecurringExpense, error)                     // ListRecurringExpenses returns the group's templates, next due first
+	SetRecurringExpensePaused(recurringExpenseID int, paused bool, nextRunAt *time.Time) error // SetRecurringExpensePaused pauses a template, or resumes it from nextRunAt
+	DeleteRecurringExpense(recurringExpenseID int) error                                       // DeleteRecurringExpense stops a template for good; posted expenses are kept
+	GetOccurrences(recurringExpenseID int) ([]factory.RecurringOccurrence, error)              // GetOccurrences lists what a template has posted, newest first
+
+	// ListDue returns up to limit running templates whose next occurrence is
+	// at or before now, in groups that are neither deleted nor archived
+	ListDue(now time.Time, limit int) ([]factory.RecurringExpense, error)
+	// PostOccurrence posts the template's occurrence at occurrenceAt as an
+	// expense and moves its next run to nextRunAt, all in one transaction. It
+	// does nothing and returns false when the occurrence is no longer the
+	// template's next run, e.g. because another scheduler already posted it.
+	// When someone in the expense has left the group nothing is posted; the
+	// template is paused with the reason in LastError and ErrMemberLeft is
+	// returned.
+	PostOccurrence(recurringExpenseID int, occurrenceAt time.Time, nextRunAt *time.Time) (transactionID int, posted bool, err error)
+	// RecordFailure keeps why the last posting failed on the template
+	RecordFailure(recurringExpenseID int, reason string) error
+}
@@ -0,0 +1,121 @@
+package recurring
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Schedule says when a recurring expense is due
+type Schedule interface {
+	// Next returns the first occurrence strictly after t, or the zero time
+	// when there is none
+	Next(t time.Time) time.Time
+}
+
+// interval repeats every so many days or months from start. Occurrences are
+// always counted from start so short months do not make monthly dates drift.
+type interval struct {
+	start  time.Time
+	days   int
+	months int
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	if t.Before(i.start) {
+		return i.start
+	}
+
+	// Estimate how many occurrences have passed, then step to the first one after t
+	var n int
+	if i.days > 0 {
+		n = int(t.Sub(i.start) / (time.Duration(i.days) * 24 * time.Hour))
+	} else {
+		n = ((t.Year()-i.start.Year())*12 + int(t.Month()) - int(i.start.Month())) / i.months
+	}
+	if n > 0 {
+		n--
+	}
+	for {
+		next := i.occurrence(n)
+		if next.After(t) {
+			return next
+		}
+		n++
+	}
+}
+
+// occurrence returns the nth occurrence, the first being start itself
+func (i interval) occurrence(n int) time.Time {
+	if i.days > 0 {
+		return i.start.AddDate(0, 0, n*i.days)
+	}
+	return addMonths(i.start, n*i.months)
+}
+
+// addMonths moves t by months, keeping the day of the month unless the target
+// month is too short, in which case its last day is used
+func addMonths(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// cronSchedule starts a cron expression at a given time
+type cronSchedule struct {
+	cron  *Cron
+	start time.Time
+}
+
+func (c cronSchedule) Next(t time.Time) time.Time {
+	if t.Before(c.start) {
+		// The start itself counts when it matches
+		t = c.start.Add(-time.Nanosecond)
+	}
+	return c.cron.Next(t)
+}
+
+// ScheduleOf returns the schedule of a recurring expense. Times are in UTC.
+func ScheduleOf(r factory.RecurringExpense) (Schedule, error) {
+	start := r.StartAt.UTC()
+	switch r.Frequency {
+	case factory.FrequencyDaily:
+		return interval{start: start, days: 1}, nil
+	case factory.FrequencyWeekly:
+		return interval{start: start, days: 7}, nil
+	case factory.FrequencyMonthly:
+		return interval{start: start, months: 1}, nil
+	case factory.FrequencyCron:
+		if r.Cron == nil {
+			return nil, fmt.Errorf("cron is required with the cron frequency")
+		}
+		cron, err := ParseCron(*r.Cron)
+		if err != nil {
+			return nil, err
+		}
+		return cronSchedule{cron: cron, start: start}, nil
+	default:
+		return nil, fmt.Errorf("unknown frequency %q", r.Frequency)
+	}
+}
+
+// NextRun returns the first occurrence of r strictly after t, or nil once the
+// schedule has passed its end
+func NextRun(schedule Schedule, r factory.RecurringExpense, t time.Time) *time.Time {
+	next := schedule.Next(t.UTC())
+	if next.IsZero() || (r.EndAt != nil && next.After(r.EndAt.UTC())) {
+		return nil
+	}
+	return &next
+}
+
+// FirstRun returns the first occurrence of r at or after t, or nil when there
+// is none before its end
+func FirstRun(schedule Schedule, r factory.RecurringExpense, t time.Time) *time.Time {
+	return NextRun(schedule, r, t.Add(-time.Nanosecond))
+}
@@ -0,0 +1,107 @@
+package recurring
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"golang.org/x/exp/slog"
+)
+
+// Scheduler posts recurring expenses as they fall due. Progress is kept in the
+// database, not in memory: every posting is recorded together with the
+// template's next run in one transaction, so a restart picks up where the last
+// run stopped and missed occurrences are caught up without posting any twice.
+type Scheduler struct {
+	Repo       Repository
+	Logger     *slog.Logger
+	Interval   time.Duration // How often due templates are looked for
+	BatchSize  int           // Templates handled per poll
+	MaxCatchUp int           // Occurrences one template may post per poll
+	Now        func() time.Time
+}
+
+// NewScheduler returns a scheduler that polls every interval
+func NewScheduler(repo Repository, logger *slog.Logger, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		Repo:       repo,
+		Logger:     logger,
+		Interval:   interval,
+		BatchSize:  50,
+		MaxCatchUp: 100,
+		Now:        time.Now,
+	}
+}
+
+// Run posts due occurrences every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunDue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue posts everything that is due now
+func (s *Scheduler) RunDue() {
+	now := s.Now().UTC()
+	templates, err := s.Repo.ListDue(now, s.BatchSize)
+	if err != nil {
+		s.Logger.Error("failed to list due recurring expenses", "error", err)
+		return
+	}
+
+	for _, template := range templates {
+		s.post(template, now)
+	}
+}
+
+// post posts each of the template's occurrences up to now, oldest first
+func (s *Scheduler) post(template factory.RecurringExpense, now time.Time) {
+	id := template.RecurringExpenseID
+	schedule, err := ScheduleOf(template)
+	if err != nil {
+		s.fail(id, err)
+		return
+	}
+
+	occurrence := template.NextRunAt
+	for i := 0; i < s.MaxCatchUp && occurrence != nil && !occurrence.After(now); i++ {
+		next := NextRun(schedule, template, *occurrence)
+		transactionID, posted, err := s.Repo.PostOccurrence(id, *occurrence, next)
+		if errors.Is(err, ErrMemberLeft) {
+			// Already paused with the reason recorded
+			s.Logger.Warn("paused recurring expense", "recurring_expense_id", id, "error", err)
+			return
+		}
+		if err != nil {
+			s.fail(id, err)
+			return
+		}
+		if !posted {
+			// Someone else got there first; their next run is now the template's
+			return
+		}
+		s.Logger.Info("posted recurring expense",
+			"recurring_expense_id", id,
+			"occurrence_at", *occurrence,
+			"transaction_id", transactionID,
+		)
+		occurrence = next
+	}
+}
+
+func (s *Scheduler) fail(recurringExpenseID int, err error) {
+	s.Logger.Error("failed to post recurring expense", "recurring_expense_id", recurringExpenseID, "error", err)
+	if err := s.Repo.RecordFailure(recurringExpenseID, err.Error()); err != nil {
+		s.Logger.Error("failed to record recurring expense failure", "recurring_expense_id", recurringExpenseID, "error", err)
+	}
+}
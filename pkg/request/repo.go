@@ -3,11 +3,11 @@ package request
 import "github.com/Abhinav7903/split/factory"
 
 type Repository interface {
-	AddRequest(data factory.Request) error
+	AddRequest(data factory.Request, messages ...factory.OutboxMessage) error
 	GetRequestByID(requestID int) (factory.Request, error)
-	UpdateRequestStatus(requestID int, status string) error
+	UpdateRequestStatus(requestID int, status string, messages ...factory.OutboxMessage) error
 	DeleteRequest(requestID int) error
-	GetRequestsByReceiverID(receiverID int) ([]factory.Request, error)
-	GetRequestsBySenderID(senderID int) ([]factory.Request, error)
-	GetRequestsByGroupID(groupID int) ([]factory.Request, error)
+	GetRequestsByReceiverID(receiverID int, page factory.PageRequest) (factory.Page[factory.Request], error)
+	GetRequestsBySenderID(senderID int, page factory.PageRequest) (factory.Page[factory.Request], error)
+	GetRequestsByGroupID(groupID int, page factory.PageRequest) (factory.Page[factory.Request], error)
 }
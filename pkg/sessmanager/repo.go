@@ -1,12 +1,65 @@
 package sessmanager
 
+import (
+	"errors"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// ErrSessionNotFound is returned for refresh tokens that are unknown, expired
+// or already used.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrTokenNotFound is returned for password reset tokens that are unknown,
+// expired or already used, and for verification tokens that were never issued.
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrTokenExpired is returned for verification tokens past their expiry
+var ErrTokenExpired = errors.New("token expired")
+
+// ErrTokenUsed is returned for verification tokens that were already used
+var ErrTokenUsed = errors.New("token already used")
+
 type Repository interface {
-	// stores hash:email and returns the hash
-	StoreEmailHash(string) (string, error)
+	// stores a random email verification token valid for ttl and returns it
+	CreateVerificationToken(email string, ttl time.Duration) (string, error)
+
+	// marks a verification token used and returns its email; fails with
+	// ErrTokenNotFound, ErrTokenExpired or ErrTokenUsed
+	ConsumeVerificationToken(token string) (string, error)
+
+	// counts a verification email resend, reporting whether it is within limit per window
+	AllowVerificationResend(email string, limit int, window time.Duration) (bool, error)
 
-	// gets back email from hash
-	GetEmailFromHash(string) (string, error)
+	// counts a password reset request, reporting whether it is within limit per window
+	AllowResetRequest(email string, limit int, window time.Duration) (bool, error)
 
 	//generates a new token for passowrd reset
 	GenerateToken(string) (string, error)
+
+	// deletes a password reset token and returns its email; fails with
+	// ErrTokenNotFound when the token is unknown, expired or already used
+	ConsumeResetToken(token string) (string, error)
+
+	// creates a session for the user and returns its refresh token
+	CreateSession(userID int, ttl time.Duration) (string, error)
+
+	// swaps a refresh token for a new one, returning the session's user
+	RotateSession(refreshToken string, ttl time.Duration) (int, string, error)
+
+	// revokes a single refresh token
+	RevokeSession(refreshToken string) error
+
+	// revokes every refresh token the user holds
+	RevokeAllSessions(userID int) error
+
+	// gets the failed login count and lockout for an email
+	GetLoginAttempt(email string) (factory.LoginAttempt, error)
+
+	// counts a failed login, locking the account for lockout once maxAttempts is reached
+	RecordFailedLogin(email string, maxAttempts int, lockout time.Duration) (factory.LoginAttempt, error)
+
+	// clears failed logins after a successful one
+	ResetLoginAttempts(email string) error
 }
@@ -0,0 +1,10 @@
+package settlement
+
+import "github.com/Abhinav7903/split/factory"
+
+type Repository interface {
+	RecordSettlement(settlement *factory.Settlement) (int, error)                        // RecordSettlement stores a payment and updates both parties' balances
+	GetSettlementsByUserID(userID int) ([]factory.Settlement, error)                     // GetSettlementsByUserID returns settlements the user paid or received
+	GetSettlementsByGroupID(groupID int) ([]factory.Settlement, error)                   // GetSettlementsByGroupID returns all settlements made in the group
+	GetSettlementsBetweenUsers(userID, counterpartyID int) ([]factory.Settlement, error) // GetSettlementsBetweenUsers returns settlements in either direction between two users
+}
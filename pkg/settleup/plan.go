@@ -0,0 +1,185 @@
+package settleup
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// exactLimit is the largest number of non-zero positions planned exactly. The
+// exact search is exponential, so bigger groups fall back to the greedy plan.
+const exactLimit = 16
+
+// Transfer is a single payment from a debtor to a creditor
+type Transfer struct {
+	FromUserID int           `json:"from_user_id"`
+	ToUserID   int           `json:"to_user_id"`
+	Amount     factory.Money `json:"amount"`
+	Currency   string        `json:"currency"`
+}
+
+type position struct {
+	userID int
+	amount factory.Money // positive when the user is owed money
+}
+
+// Plan returns the payer -> payee transfers that bring every net balance to zero.
+//
+// Each currency is planned on its own, so a debt in one currency is never paid
+// off with money in another. Within a currency, positions are partitioned into
+// as many independent zero-sum subgroups as possible, which is what minimises
+// the number of transfers: a subgroup of n people always needs n-1 payments.
+// Inside each subgroup the largest debtor pays the largest creditor until
+// everyone is settled. Ties are broken by user ID so the same balances always
+// produce the same plan.
+func Plan(balances []factory.NetBalance) ([]Transfer, error) {
+	byCurrency := make(map[string][]position)
+	totals := make(map[string]factory.Money)
+	for _, balance := range balances {
+		totals[balance.Currency] += balance.Net
+		if balance.Net != 0 {
+			byCurrency[balance.Currency] = append(byCurrency[balance.Currency], position{userID: balance.UserID, amount: balance.Net})
+		}
+	}
+
+	currencies := make([]string, 0, len(totals))
+	for currency, total := range totals {
+		if total != 0 {
+			return nil, fmt.Errorf("net %s balances do not add up to zero (off by %s)", currency, total)
+		}
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	transfers := []Transfer{}
+	for _, currency := range currencies {
+		for _, transfer := range planPositions(byCurrency[currency]) {
+			transfer.Currency = currency
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// planPositions plans the transfers for positions that all share one currency.
+func planPositions(positions []position) []Transfer {
+	sort.Slice(positions, func(i, j int) bool { return positions[i].userID < positions[j].userID })
+
+	var subgroups [][]position
+	if len(positions) <= exactLimit {
+		subgroups = partition(positions)
+	} else {
+		subgroups = [][]position{positions}
+	}
+
+	var transfers []Transfer
+	for _, subgroup := range subgroups {
+		transfers = append(transfers, settle(subgroup)...)
+	}
+	return transfers
+}
+
+// partition splits positions into the largest possible number of subsets that
+// each add up to zero, using a dynamic programme over subsets.
+func partition(positions []position) [][]position {
+	n := len(positions)
+	if n == 0 {
+		return nil
+	}
+	full := 1<<n - 1
+
+	sums := make([]factory.Money, full+1)
+	for mask := 1; mask <= full; mask++ {
+		low := mask & -mask
+		sums[mask] = sums[mask^low] + positions[bitIndex(low)].amount
+	}
+
+	// groups[mask] is the most zero-sum subsets the members of mask can form
+	// when added one at a time.
+	groups := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		best := 0
+		for rest := mask; rest != 0; rest &= rest - 1 {
+			low := rest & -rest
+			if groups[mask^low] > best {
+				best = groups[mask^low]
+			}
+		}
+		if sums[mask] == 0 {
+			best++
+		}
+		groups[mask] = best
+	}
+
+	// Walk back from the full set. Every time the remaining members add up to
+	// zero, the members removed since the previous cut form one subgroup.
+	var subgroups [][]position
+	var current []position
+	for mask := full; mask != 0; {
+		for rest := mask; rest != 0; rest &= rest - 1 {
+			low := rest & -rest
+			gain := 0
+			if sums[mask] == 0 {
+				gain = 1
+			}
+			if groups[mask] == groups[mask^low]+gain {
+				current = append(current, positions[bitIndex(low)])
+				mask ^= low
+				break
+			}
+		}
+		if sums[mask] == 0 {
+			subgroups = append(subgroups, current)
+			current = nil
+		}
+	}
+
+	// Order subgroups by their lowest user ID so output does not depend on the walk
+	for _, subgroup := range subgroups {
+		sort.Slice(subgroup, func(i, j int) bool { return subgroup[i].userID < subgroup[j].userID })
+	}
+	sort.Slice(subgroups, func(i, j int) bool { return subgroups[i][0].userID < subgroups[j][0].userID })
+	return subgroups
+}
+
+// settle repeatedly has the largest debtor pay the largest creditor.
+func settle(positions []position) []Transfer {
+	remaining := make([]position, len(positions))
+	copy(remaining, positions)
+
+	var transfers []Transfer
+	for {
+		debtor, creditor := -1, -1
+		for i, p := range remaining {
+			if p.amount < 0 && (debtor == -1 || p.amount < remaining[debtor].amount) {
+				debtor = i
+			}
+			if p.amount > 0 && (creditor == -1 || p.amount > remaining[creditor].amount) {
+				creditor = i
+			}
+		}
+		if debtor == -1 || creditor == -1 {
+			return transfers
+		}
+
+		amount := min(-remaining[debtor].amount, remaining[creditor].amount)
+		transfers = append(transfers, Transfer{
+			FromUserID: remaining[debtor].userID,
+			ToUserID:   remaining[creditor].userID,
+			Amount:     amount,
+		})
+		remaining[debtor].amount += amount
+		remaining[creditor].amount -= amount
+	}
+}
+
+// bitIndex returns the position of the single set bit in bit
+func bitIndex(bit int) int {
+	index := 0
+	for bit > 1 {
+		bit >>= 1
+		index++
+	}
+	return index
+}
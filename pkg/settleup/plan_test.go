@@ -0,0 +1,186 @@
+package settleup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+func net(userID int, currency string, amount factory.Money) factory.NetBalance {
+	return factory.NetBalance{UserID: userID, Currency: currency, Net: amount}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []factory.NetBalance
+		want     []Transfer
+		wantErr  bool
+	}{
+		{
+			name:     "no balances",
+			balances: nil,
+			want:     []Transfer{},
+		},
+		{
+			name: "3-cycle that nets to zero",
+			balances: []factory.NetBalance{
+				net(1, "INR", 0),
+				net(2, "INR", 0),
+				net(3, "INR", 0),
+			},
+			want: []Transfer{},
+		},
+		{
+			name: "one creditor, two debtors",
+			balances: []factory.NetBalance{
+				net(1, "INR", 3000),
+				net(2, "INR", -2000),
+				net(3, "INR", -1000),
+			},
+			want: []Transfer{
+				{FromUserID: 2, ToUserID: 1, Amount: 2000, Currency: "INR"},
+				{FromUserID: 3, ToUserID: 1, Amount: 1000, Currency: "INR"},
+			},
+		},
+		{
+			name: "independent pairs are settled separately",
+			balances: []factory.NetBalance{
+				net(1, "INR", 1000),
+				net(2, "INR", -500),
+				net(3, "INR", 500),
+				net(4, "INR", -1000),
+			},
+			want: []Transfer{
+				{FromUserID: 4, ToUserID: 1, Amount: 1000, Currency: "INR"},
+				{FromUserID: 2, ToUserID: 3, Amount: 500, Currency: "INR"},
+			},
+		},
+		{
+			name: "mixed currencies",
+			balances: []factory.NetBalance{
+				net(1, "USD", -300),
+				net(1, "INR", 1000),
+				net(2, "INR", -1000),
+				net(3, "USD", 300),
+			},
+			want: []Transfer{
+				{FromUserID: 2, ToUserID: 1, Amount: 1000, Currency: "INR"},
+				{FromUserID: 1, ToUserID: 3, Amount: 300, Currency: "USD"},
+			},
+		},
+		{
+			name: "balances that do not add up",
+			balances: []factory.NetBalance{
+				net(1, "INR", 1000),
+				net(2, "INR", -999),
+			},
+			wantErr: true,
+		},
+		{
+			name: "one currency that does not add up",
+			balances: []factory.NetBalance{
+				net(1, "INR", 1000),
+				net(2, "INR", -1000),
+				net(1, "USD", 5),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Plan(tt.balances)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Plan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// largeGroup returns more non-zero positions than are planned exactly: pairs
+// of users where one owes the other, with amounts that differ per pair.
+func largeGroup() []factory.NetBalance {
+	var balances []factory.NetBalance
+	for i := 1; i <= exactLimit/2+2; i++ {
+		amount := factory.Money(i * 100)
+		balances = append(balances, net(2*i-1, "INR", amount), net(2*i, "INR", -amount))
+	}
+	return balances
+}
+
+func TestPlanGreedyFallback(t *testing.T) {
+	balances := largeGroup()
+	if len(balances) <= exactLimit {
+		t.Fatalf("test group has %d positions, want more than %d", len(balances), exactLimit)
+	}
+
+	transfers, err := Plan(balances)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(transfers) > len(balances)-1 {
+		t.Errorf("Plan() made %d transfers, want at most %d", len(transfers), len(balances)-1)
+	}
+
+	// Applying the transfers must leave everyone settled
+	remaining := make(map[int]factory.Money)
+	for _, balance := range balances {
+		remaining[balance.UserID] = balance.Net
+	}
+	for _, transfer := range transfers {
+		if transfer.Amount <= 0 {
+			t.Errorf("transfer %+v has a non-positive amount", transfer)
+		}
+		remaining[transfer.FromUserID] += transfer.Amount
+		remaining[transfer.ToUserID] -= transfer.Amount
+	}
+	for userID, amount := range remaining {
+		if amount != 0 {
+			t.Errorf("user %d is left with %s", userID, amount)
+		}
+	}
+}
+
+func TestPlanIgnoresInputOrder(t *testing.T) {
+	groups := map[string][]factory.NetBalance{
+		"exact": {
+			net(1, "INR", 1000),
+			net(2, "INR", -500),
+			net(3, "INR", 500),
+			net(4, "INR", -1000),
+			net(1, "USD", -300),
+			net(3, "USD", 300),
+		},
+		"greedy": largeGroup(),
+	}
+
+	for name, balances := range groups {
+		t.Run(name, func(t *testing.T) {
+			want, err := Plan(balances)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+
+			reversed := make([]factory.NetBalance, len(balances))
+			for i, balance := range balances {
+				reversed[len(balances)-1-i] = balance
+			}
+			rotated := append(append([]factory.NetBalance{}, balances[2:]...), balances[:2]...)
+
+			for _, reordered := range [][]factory.NetBalance{reversed, rotated} {
+				got, err := Plan(reordered)
+				if err != nil {
+					t.Fatalf("Plan() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Plan() = %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+}
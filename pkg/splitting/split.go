@@ -0,0 +1,144 @@
+package splitting
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Mode selects how an amount is divided between participants
+type Mode string
+
+const (
+	Equal      Mode = "equal"      // everyone pays the same
+	Exact      Mode = "exact"      // Value is the exact amount each participant pays
+	Percentage Mode = "percentage" // Value is the participant's percentage of the total
+	Shares     Mode = "shares"     // Value is the participant's weight relative to the others
+)
+
+// Participant is a user taking part in a split. Value is ignored for equal
+// splits and holds the amount, percentage or share weight for the other modes.
+type Participant struct {
+	UserID int     `json:"user_id"`
+	Value  float64 `json:"value,omitempty"`
+}
+
+// Compute divides total between the participants according to mode and returns
+// one split per participant in the order they were given. The splits always add
+// up to total exactly; paise left over from rounding go one at a time to the
+// participants with the largest remainders, ties broken by the lowest user ID.
+func Compute(total factory.Money, mode Mode, participants []Participant) ([]factory.TransactionSplit, error) {
+	if total <= 0 {
+		return nil, errors.New("total must be greater than zero")
+	}
+	if len(participants) == 0 {
+		return nil, errors.New("at least one participant is required")
+	}
+
+	seen := make(map[int]bool, len(participants))
+	for _, participant := range participants {
+		if participant.UserID <= 0 {
+			return nil, errors.New("participant user_id must be positive")
+		}
+		if seen[participant.UserID] {
+			return nil, fmt.Errorf("user %d appears more than once", participant.UserID)
+		}
+		seen[participant.UserID] = true
+		if participant.Value < 0 {
+			return nil, errors.New("participant value cannot be negative")
+		}
+	}
+
+	var amounts []factory.Money
+	var err error
+	switch mode {
+	case Equal:
+		weights := make([]int64, len(participants))
+		for i := range weights {
+			weights[i] = 1
+		}
+		amounts, err = allocate(total, weights, participants)
+
+	case Exact:
+		amounts = make([]factory.Money, len(participants))
+		for i, participant := range participants {
+			amounts[i] = factory.Money(toHundredths(participant.Value))
+		}
+		if sum := factory.SumMoney(amounts...); sum != total {
+			return nil, fmt.Errorf("exact amounts add up to %s, expected %s", sum, total)
+		}
+
+	case Percentage:
+		// Percentages are kept to two decimal places, so they must add up to 10000
+		var sum int64
+		weights := make([]int64, len(participants))
+		for i, participant := range participants {
+			weights[i] = toHundredths(participant.Value)
+			sum += weights[i]
+		}
+		if sum != 10000 {
+			return nil, fmt.Errorf("percentages add up to %s, expected 100", factory.Money(sum))
+		}
+		amounts, err = allocate(total, weights, participants)
+
+	case Shares:
+		weights := make([]int64, len(participants))
+		for i, participant := range participants {
+			weights[i] = toHundredths(participant.Value)
+		}
+		amounts, err = allocate(total, weights, participants)
+
+	default:
+		return nil, fmt.Errorf("unknown split mode %q", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	splits := make([]factory.TransactionSplit, len(participants))
+	for i, participant := range participants {
+		splits[i] = factory.TransactionSplit{
+			UserID: participant.UserID,
+			Amount: amounts[i],
+		}
+	}
+	return splits, nil
+}
+
+// allocate divides total proportionally to weights with Money.Allocate, which
+// favours earlier weights on ties, so participants are handed over in user ID
+// order and the result is mapped back to the order they were given in.
+func allocate(total factory.Money, weights []int64, participants []Participant) ([]factory.Money, error) {
+	order := make([]int, len(participants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return participants[order[a]].UserID < participants[order[b]].UserID
+	})
+
+	sorted := make([]int64, len(weights))
+	for i, index := range order {
+		sorted[i] = weights[index]
+	}
+
+	parts, err := total.Allocate(sorted)
+	if err != nil {
+		return nil, err
+	}
+
+	amounts := make([]factory.Money, len(participants))
+	for i, index := range order {
+		amounts[index] = parts[i]
+	}
+	return amounts, nil
+}
+
+// toHundredths converts a two-decimal value such as rupees or a percentage into
+// an integer number of hundredths.
+func toHundredths(value float64) int64 {
+	return int64(math.Round(value * 100))
+}
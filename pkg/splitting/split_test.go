@@ -0,0 +1,181 @@
+package splitting
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+func people(userIDs ...int) []Participant {
+	participants := make([]Participant, len(userIDs))
+	for i, userID := range userIDs {
+		participants[i] = Participant{UserID: userID}
+	}
+	return participants
+}
+
+func valued(values map[int]float64, userIDs ...int) []Participant {
+	participants := people(userIDs...)
+	for i := range participants {
+		participants[i].Value = values[participants[i].UserID]
+	}
+	return participants
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        factory.Money
+		mode         Mode
+		participants []Participant
+		want         []factory.Money
+		wantErr      bool
+	}{
+		{
+			name:         "equal without remainder",
+			total:        900,
+			mode:         Equal,
+			participants: people(1, 2, 3),
+			want:         []factory.Money{300, 300, 300},
+		},
+		{
+			name:         "equal remainder goes to the lowest user ID",
+			total:        10000,
+			mode:         Equal,
+			participants: people(3, 1, 2),
+			want:         []factory.Money{3333, 3334, 3333},
+		},
+		{
+			name:         "equal with fewer paise than participants",
+			total:        2,
+			mode:         Equal,
+			participants: people(1, 2, 3),
+			want:         []factory.Money{1, 1, 0},
+		},
+		{
+			name:         "exact",
+			total:        1000,
+			mode:         Exact,
+			participants: valued(map[int]float64{1: 2.5, 2: 7.5}, 1, 2),
+			want:         []factory.Money{250, 750},
+		},
+		{
+			name:         "exact amounts must add up to the total",
+			total:        1000,
+			mode:         Exact,
+			participants: valued(map[int]float64{1: 2.5, 2: 7.49}, 1, 2),
+			wantErr:      true,
+		},
+		{
+			name:         "percentage remainder goes to the largest remainder",
+			total:        1000,
+			mode:         Percentage,
+			participants: valued(map[int]float64{1: 33.33, 2: 33.33, 3: 33.34}, 1, 2, 3),
+			want:         []factory.Money{333, 333, 334},
+		},
+		{
+			name:         "percentage tie goes to the lowest user ID",
+			total:        1,
+			mode:         Percentage,
+			participants: valued(map[int]float64{1: 50, 2: 50}, 2, 1),
+			want:         []factory.Money{0, 1},
+		},
+		{
+			name:         "percentages must add up to 100",
+			total:        1000,
+			mode:         Percentage,
+			participants: valued(map[int]float64{1: 50, 2: 49.99}, 1, 2),
+			wantErr:      true,
+		},
+		{
+			name:         "shares remainder goes to the largest remainder",
+			total:        100,
+			mode:         Shares,
+			participants: valued(map[int]float64{1: 1, 2: 2}, 1, 2),
+			want:         []factory.Money{33, 67},
+		},
+		{
+			name:         "equal shares remainder goes to the lowest user ID",
+			total:        1000,
+			mode:         Shares,
+			participants: valued(map[int]float64{1: 1, 2: 1, 3: 1}, 2, 1, 3),
+			want:         []factory.Money{333, 334, 333},
+		},
+		{
+			name:         "fractional shares",
+			total:        1001,
+			mode:         Shares,
+			participants: valued(map[int]float64{1: 0.5, 2: 1.5}, 1, 2),
+			want:         []factory.Money{250, 751},
+		},
+		{
+			name:         "shares must not all be zero",
+			total:        1000,
+			mode:         Shares,
+			participants: people(1, 2),
+			wantErr:      true,
+		},
+		{
+			name:         "zero total",
+			total:        0,
+			mode:         Equal,
+			participants: people(1),
+			wantErr:      true,
+		},
+		{
+			name:         "no participants",
+			total:        1000,
+			mode:         Equal,
+			participants: nil,
+			wantErr:      true,
+		},
+		{
+			name:         "duplicate participant",
+			total:        1000,
+			mode:         Equal,
+			participants: people(1, 1),
+			wantErr:      true,
+		},
+		{
+			name:         "negative value",
+			total:        1000,
+			mode:         Shares,
+			participants: valued(map[int]float64{1: -1, 2: 2}, 1, 2),
+			wantErr:      true,
+		},
+		{
+			name:         "unknown mode",
+			total:        1000,
+			mode:         "thirds",
+			participants: people(1, 2),
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splits, err := Compute(tt.total, tt.mode, tt.participants)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := make([]factory.Money, len(splits))
+			for i, split := range splits {
+				if split.UserID != tt.participants[i].UserID {
+					t.Errorf("split %d is for user %d, want %d", i, split.UserID, tt.participants[i].UserID)
+				}
+				got[i] = split.Amount
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compute() = %v, want %v", got, tt.want)
+			}
+			if sum := factory.SumMoney(got...); sum != tt.total {
+				t.Errorf("Compute() splits sum to %s, want %s", sum, tt.total)
+			}
+		})
+	}
+}
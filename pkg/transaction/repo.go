@@ -1,26 +1,48 @@
 package transaction
 
-import "github.com/Abhinav7903/split/factory"
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// ErrNotFound is returned for transactions that do not exist, or that were
+// deleted when deleted ones are not asked for
+var ErrNotFound = errors.New("transaction not found")
 
 type Repository interface {
 	// Create a new transaction
 	CreateTransaction(transaction *factory.Transaction) (int, error)
 
-	// Retrieve a transaction by ID
-	GetTransactionByID(transactionID int) (*factory.Transaction, error)
+	// Retrieve a transaction by ID, or ErrNotFound when missing or deleted
+	// unless includeDeleted is set
+	GetTransactionByID(transactionID int, includeDeleted bool) (*factory.Transaction, error)
+
+	// Retrieve a page of transactions by Lender ID
+	GetTransactionsByLenderID(lenderID int, includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Transaction], error)
+
+	// Retrieve a page of transactions by Borrower ID
+	GetTransactionsByBorrowerID(borrowerID int, includeDeleted bool, page factory.PageRequest) (factory.Page[factory.Transaction], error)
+
+	// Move a transaction to a new status as the state machine allows and
+	// return it as updated
+	UpdateTransactionStatus(transactionID int, update factory.StatusUpdate, machine StateMachine, performedBy int) (*factory.Transaction, error)
+
+	// Soft delete a transaction by ID, reversing an expense's balance changes
+	DeleteTransaction(transactionID int, performedBy int) error
 
-	// Retrieve transactions by Lender ID
-	GetTransactionsByLenderID(lenderID int) ([]factory.Transaction, error)
+	// Bring back a soft deleted transaction
+	RestoreTransaction(transactionID int, performedBy int) error
 
-	// Retrieve transactions by Borrower ID
-	GetTransactionsByBorrowerID(borrowerID int) ([]factory.Transaction, error)
+	// History of creates, status changes, retries, deletes and restores, oldest first
+	GetTransactionLogs(transactionID int) ([]factory.TransactionLog, error)
 
-	// Update the status of a transaction
-	UpdateTransactionStatus(transactionID int, status string) error
+	// Create an expense with its splits and balance updates in one step
+	CreateExpense(expense *factory.Expense) (int, error)
 
-	// Delete a transaction by ID
-	DeleteTransaction(transactionID int) error
+	// Total a group's transactions per currency
+	GetGroupSpendByCurrency(groupID int) ([]factory.CurrencyAmount, error)
 
-	// Custom queries for filtering or searching
-	SearchTransactions(filters factory.TransactionFilters) ([]factory.Transaction, error)
+	// Search with filters, one page at a time, optionally with totals
+	SearchTransactions(filters factory.TransactionFilters, page factory.PageRequest) (factory.TransactionSearchResult, error)
 }
@@ -0,0 +1,111 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// Transaction statuses, matching the check constraint on transactions.status
+const (
+	StatusPending    = "pending"
+	StatusSuccessful = "successful"
+	StatusFailed     = "failed"
+	StatusRetrying   = "retrying"
+)
+
+// transitions lists where each status may move next. A successful transaction
+// is final; a failed one can only be retried.
+var transitions = map[string][]string{
+	StatusPending:    {StatusSuccessful, StatusFailed},
+	StatusFailed:     {StatusRetrying},
+	StatusRetrying:   {StatusSuccessful, StatusFailed},
+	StatusSuccessful: {},
+}
+
+// ErrFailureReasonRequired is returned when a transaction is marked failed
+// without saying why.
+var ErrFailureReasonRequired = errors.New("failure_reason is required when marking a transaction failed")
+
+// TransitionError is returned for a status change the state machine does not
+// allow. It carries the transaction's current state.
+type TransitionError struct {
+	From       string
+	To         string
+	RetryCount int
+	Reason     string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move transaction from %s to %s: %s", e.From, e.To, e.Reason)
+}
+
+// ValidStatus reports whether status is one of the known statuses
+func ValidStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// AllowedTransitions returns the statuses a transaction in status can move to
+func AllowedTransitions(status string) []string {
+	return append([]string{}, transitions[status]...)
+}
+
+// StateMachine applies status changes to transactions
+type StateMachine struct {
+	MaxRetries int // How many times a failed transaction may be retried
+}
+
+// Apply moves t to status, or returns why it cannot. Failing records the
+// reason, retrying counts the retry and succeeding clears the last failure.
+func (m StateMachine) Apply(t *factory.Transaction, status, failureReason string) error {
+	if !ValidStatus(status) {
+		return fmt.Errorf("unknown transaction status %q", status)
+	}
+
+	from := t.Status
+	if from == "" {
+		from = StatusPending
+	}
+
+	allowed := false
+	for _, next := range transitions[from] {
+		if next == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		reason := "allowed next statuses are " + strings.Join(transitions[from], ", ")
+		if len(transitions[from]) == 0 {
+			reason = from + " is final"
+		}
+		return &TransitionError{From: from, To: status, RetryCount: t.RetryCount, Reason: reason}
+	}
+
+	switch status {
+	case StatusFailed:
+		failureReason = strings.TrimSpace(failureReason)
+		if failureReason == "" {
+			return ErrFailureReasonRequired
+		}
+		t.FailureReason = &failureReason
+	case StatusRetrying:
+		if t.RetryCount >= m.MaxRetries {
+			return &TransitionError{
+				From:       from,
+				To:         status,
+				RetryCount: t.RetryCount,
+				Reason:     fmt.Sprintf("retry limit of %d reached", m.MaxRetries),
+			}
+		}
+		t.RetryCount++
+	case StatusSuccessful:
+		t.FailureReason = nil
+	}
+
+	t.Status = status
+	return nil
+}
@@ -0,0 +1,168 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+func reason(text string) *string {
+	return &text
+}
+
+func TestStateMachineApply(t *testing.T) {
+	machine := StateMachine{MaxRetries: 2}
+
+	tests := []struct {
+		name          string
+		from          factory.Transaction
+		status        string
+		failureReason string
+		want          factory.Transaction
+		wantErr       error
+		wantTransErr  bool
+	}{
+		{
+			name:   "pending to successful",
+			from:   factory.Transaction{Status: StatusPending},
+			status: StatusSuccessful,
+			want:   factory.Transaction{Status: StatusSuccessful},
+		},
+		{
+			name:   "empty status is treated as pending",
+			from:   factory.Transaction{},
+			status: StatusSuccessful,
+			want:   factory.Transaction{Status: StatusSuccessful},
+		},
+		{
+			name:          "pending to failed records the reason",
+			from:          factory.Transaction{Status: StatusPending},
+			status:        StatusFailed,
+			failureReason: "  card declined ",
+			want:          factory.Transaction{Status: StatusFailed, FailureReason: reason("card declined")},
+		},
+		{
+			name:    "failing needs a reason",
+			from:    factory.Transaction{Status: StatusPending},
+			status:  StatusFailed,
+			want:    factory.Transaction{Status: StatusPending},
+			wantErr: ErrFailureReasonRequired,
+		},
+		{
+			name:   "failed to retrying counts the retry",
+			from:   factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout")},
+			status: StatusRetrying,
+			want:   factory.Transaction{Status: StatusRetrying, FailureReason: reason("timeout"), RetryCount: 1},
+		},
+		{
+			name:         "retry limit reached",
+			from:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout"), RetryCount: 2},
+			status:       StatusRetrying,
+			want:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout"), RetryCount: 2},
+			wantTransErr: true,
+		},
+		{
+			name:   "retrying to successful clears the failure",
+			from:   factory.Transaction{Status: StatusRetrying, FailureReason: reason("timeout"), RetryCount: 1},
+			status: StatusSuccessful,
+			want:   factory.Transaction{Status: StatusSuccessful, RetryCount: 1},
+		},
+		{
+			name:          "retrying to failed",
+			from:          factory.Transaction{Status: StatusRetrying, FailureReason: reason("timeout"), RetryCount: 1},
+			status:        StatusFailed,
+			failureReason: "declined again",
+			want:          factory.Transaction{Status: StatusFailed, FailureReason: reason("declined again"), RetryCount: 1},
+		},
+		{
+			name:         "pending cannot be retried",
+			from:         factory.Transaction{Status: StatusPending},
+			status:       StatusRetrying,
+			want:         factory.Transaction{Status: StatusPending},
+			wantTransErr: true,
+		},
+		{
+			name:         "failed cannot succeed without a retry",
+			from:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout")},
+			status:       StatusSuccessful,
+			want:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout")},
+			wantTransErr: true,
+		},
+		{
+			name:         "successful is final",
+			from:         factory.Transaction{Status: StatusSuccessful},
+			status:       StatusFailed,
+			want:         factory.Transaction{Status: StatusSuccessful},
+			wantTransErr: true,
+		},
+		{
+			name:         "successful cannot be retried",
+			from:         factory.Transaction{Status: StatusSuccessful},
+			status:       StatusRetrying,
+			want:         factory.Transaction{Status: StatusSuccessful},
+			wantTransErr: true,
+		},
+		{
+			name:         "successful cannot succeed again",
+			from:         factory.Transaction{Status: StatusSuccessful},
+			status:       StatusSuccessful,
+			want:         factory.Transaction{Status: StatusSuccessful},
+			wantTransErr: true,
+		},
+		{
+			name:         "no move back to pending",
+			from:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout")},
+			status:       StatusPending,
+			want:         factory.Transaction{Status: StatusFailed, FailureReason: reason("timeout")},
+			wantTransErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.from
+			err := machine.Apply(&got, tt.status, tt.failureReason)
+
+			var transitionErr *TransitionError
+			switch {
+			case tt.wantTransErr:
+				if !errors.As(err, &transitionErr) {
+					t.Fatalf("Apply() error = %v, want a TransitionError", err)
+				}
+				if transitionErr.To != tt.status || transitionErr.RetryCount != tt.from.RetryCount {
+					t.Errorf("Apply() error = %+v, want a move to %s at retry %d", transitionErr, tt.status, tt.from.RetryCount)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if got.Status != tt.want.Status || got.RetryCount != tt.want.RetryCount {
+				t.Errorf("Apply() left status %s at retry %d, want %s at retry %d", got.Status, got.RetryCount, tt.want.Status, tt.want.RetryCount)
+			}
+			if (got.FailureReason == nil) != (tt.want.FailureReason == nil) ||
+				got.FailureReason != nil && *got.FailureReason != *tt.want.FailureReason {
+				t.Errorf("Apply() failure reason = %v, want %v", got.FailureReason, tt.want.FailureReason)
+			}
+		})
+	}
+}
+
+func TestStateMachineApplyUnknownStatus(t *testing.T) {
+	got := factory.Transaction{Status: StatusPending}
+	err := StateMachine{MaxRetries: 1}.Apply(&got, "refunded", "")
+	if err == nil {
+		t.Fatal("Apply() error = nil, want an error for an unknown status")
+	}
+	var transitionErr *TransitionError
+	if errors.As(err, &transitionErr) {
+		t.Errorf("Apply() error = %v, want an unknown status error", err)
+	}
+	if got.Status != StatusPending {
+		t.Errorf("Apply() changed status to %s", got.Status)
+	}
+}
@@ -1,8 +1,14 @@
 package transactionsplit
 
-import "github.com/Abhinav7903/split/factory"
+import (
+	"errors"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+var ErrAlreadySplit = errors.New("transaction is already split")
 
 type Repository interface {
-	CreateTransactionSplit(transaction *factory.TransactionSplit) error
 	GetTransactionSplits(transactionID int) ([]factory.TransactionSplit, error)
+	SplitTransaction(transactionID int, splits []factory.TransactionSplit) error //SplitTransaction stores the splits of an unsplit transaction and moves the balances like an expense, or fails with ErrAlreadySplit
 }
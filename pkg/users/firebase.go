@@ -0,0 +1,127 @@
+package users
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// firebaseCertsURL serves the certificates Firebase signs ID tokens with
+const firebaseCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+
+var maxAgePattern = regexp.MustCompile(`max-age=(\d+)`)
+
+// FirebaseVerifier checks Firebase ID tokens issued for one project. Google's
+// signing certificates are fetched on demand and cached for as long as the
+// response allows.
+type FirebaseVerifier struct {
+	projectID string
+	client    *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	expires time.Time
+}
+
+func NewFirebaseVerifier(projectID string) *FirebaseVerifier {
+	return &FirebaseVerifier{
+		projectID: projectID,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify checks the token's signature, audience, issuer and expiry and returns
+// the Firebase UID and email it was issued for.
+func (f *FirebaseVerifier) Verify(idToken string) (string, string, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return f.key(kid)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("invalid firebase token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", "", errors.New("invalid firebase token")
+	}
+	if !claims.VerifyAudience(f.projectID, true) ||
+		!claims.VerifyIssuer("https://securetoken.google.com/"+f.projectID, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return "", "", errors.New("firebase token was not issued for this project")
+	}
+
+	uid, _ := claims["sub"].(string)
+	if uid == "" {
+		return "", "", errors.New("firebase token has no subject")
+	}
+	email, _ := claims["email"].(string)
+	return uid, email, nil
+}
+
+// key returns the public key with the given ID, refreshing the cached
+// certificates when they have expired.
+func (f *FirebaseVerifier) key(kid string) (*rsa.PublicKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.keys == nil || time.Now().After(f.expires) {
+		if err := f.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := f.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown firebase key %q", kid)
+	}
+	return key, nil
+}
+
+func (f *FirebaseVerifier) refresh() error {
+	resp, err := f.client.Get(firebaseCertsURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch firebase certificates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch firebase certificates: %s", resp.Status)
+	}
+
+	var certs map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		return fmt.Errorf("failed to decode firebase certificates: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for kid, cert := range certs {
+		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(cert))
+		if err != nil {
+			return fmt.Errorf("failed to parse firebase certificate %q: %w", kid, err)
+		}
+		keys[kid] = key
+	}
+
+	maxAge := time.Hour
+	if match := maxAgePattern.FindStringSubmatch(resp.Header.Get("Cache-Control")); match != nil {
+		if seconds, err := strconv.Atoi(match[1]); err == nil {
+			maxAge = time.Duration(seconds) * time.Second
+		}
+	}
+
+	f.keys = keys
+	f.expires = time.Now().Add(maxAge)
+	return nil
+}
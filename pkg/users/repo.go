@@ -5,13 +5,17 @@ import (
 )
 
 type Repository interface {
-	AddUser(user factory.User) error
+	AddUser(user factory.User, messages ...factory.OutboxMessage) error
 	VerifyEmail(email string) error
 	GetUser(email string) (factory.User, error)
 	UpdateUserDetails(user factory.User) error
-	DeleteUser(email string) error
-	GetAllUsers() ([]factory.User, error)
+	DeleteUser(email string, deletedBy int) error // Soft delete, undone by RestoreUser
+	RestoreUser(email string) error
+	GetAllUsers(includeDeleted bool, page factory.PageRequest) (factory.Page[factory.User], error)
 	EmailExists(email string) (bool, error)
 	GetUserIDByEmail(email string) (int, error)
 	GetUserByID(id int) (factory.User, error)
+	GetUserIDByFirebaseUID(firebaseUID string) (int, error)
+	UpdatePassword(email, passwordHash string) error
+	GetCredentials(email string) (userID int, passwordHash string, verified bool, err error)
 }
@@ -1,6 +1,8 @@
 package users
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -18,15 +20,81 @@ func VerifyPassword(hashedPassword, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) == nil
 }
 
-func CreateToken(email string, expirationTime time.Time) (string, error) {
+// MinJWTSecretLength is the shortest jwt_secret the server accepts
+const MinJWTSecretLength = 32
+
+// ErrNoJWTSecret is returned when no jwt_secret is configured. Tokens signed
+// with an empty key could be forged by anyone.
+var ErrNoJWTSecret = errors.New("jwt_secret is not configured")
+
+// jwtKey returns the configured signing key
+func jwtKey() ([]byte, error) {
+	secret := viper.GetString("jwt_secret")
+	if secret == "" {
+		return nil, ErrNoJWTSecret
+	}
+	return []byte(secret), nil
+}
+
+func CreateToken(userID int, email string, expirationTime time.Time) (string, error) {
+	key, err := jwtKey()
+	if err != nil {
+		return "", err
+	}
 
 	claims := jwt.MapClaims{
-		"email": email,
-		"exp":   expirationTime.Unix(),
+		"user_id": userID,
+		"email":   email,
+		"iat":     time.Now().Unix(),
+		"exp":     expirationTime.Unix(),
 	}
 
 	// Generate the JWT token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(viper.GetString("jwt_secret")))
+	return token.SignedString(key)
+}
+
+// TokenClaims is who a token made by CreateToken was issued for, and when
+type TokenClaims struct {
+	UserID   int
+	Email    string
+	IssuedAt time.Time // Zero for tokens made before issue times were recorded
+}
+
+// ParseToken verifies a token made by CreateToken and returns the user it was
+// issued for. Tokens without an expiry are rejected.
+func ParseToken(tokenString string) (TokenClaims, error) {
+	key, err := jwtKey()
+	if err != nil {
+		return TokenClaims{}, err
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return TokenClaims{}, errors.New("invalid token")
+	}
+
+	// Numbers in JSON claims decode as float64
+	userID, _ := claims["user_id"].(float64)
+	email, _ := claims["email"].(string)
+	if userID <= 0 && email == "" {
+		return TokenClaims{}, errors.New("token does not identify a user")
+	}
+
+	parsed := TokenClaims{UserID: int(userID), Email: email}
+	if issuedAt, ok := claims["iat"].(float64); ok {
+		parsed.IssuedAt = time.Unix(int64(issuedAt), 0)
+	}
+	return parsed, nil
 }
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/spf13/viper"
+)
+
+// isAdmin reports whether the request carries the configured admin key. When no
+// admin_key is configured nobody is an admin.
+func (s *Server) isAdmin(r *http.Request) bool {
+	adminKey := viper.GetString("admin_key")
+	if adminKey == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Key")), []byte(adminKey)) == 1
+}
+
+// includeDeleted reports whether the request asks for soft deleted rows with
+// include_deleted=true. Only admins may see them.
+func (s *Server) includeDeleted(r *http.Request) bool {
+	return r.URL.Query().Get("include_deleted") == "true" && s.isAdmin(r)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Abhinav7903/split/pkg/users"
+	"github.com/golang-jwt/jwt"
+)
+
+type contextKey string
+
+const callerKey contextKey = "caller"
+
+// caller is the authenticated user making a request
+type caller struct {
+	UserID int
+	Email  string
+}
+
+// publicRoutes can be used without signing in
+var publicRoutes = map[string]bool{
+	"/ping":                true,
+	"/signup":              true,
+	"/verify":              true,
+	"/email-exists":        true,
+	"/login":               true,
+	"/refresh":             true,
+	"/logout":              true,
+	"/forgot-password":     true,
+	"/reset-password":      true,
+	"/resend-verification": true,
+}
+
+// authenticate is router middleware that verifies the bearer token on every
+// non-public route and stores the caller in the request context.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || publicRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			s.respond(w, ResponseMsg{Message: "Missing bearer token"}, http.StatusUnauthorized, nil)
+			return
+		}
+
+		c, err := s.identify(token)
+		if err != nil {
+			s.logger.Info("rejected token", "path", r.URL.Path, "error", err)
+			s.respond(w, ResponseMsg{Message: "Invalid or expired token"}, http.StatusUnauthorized, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey, c)))
+	})
+}
+
+// identify resolves a token to a user. Our own tokens are HS256; Firebase ID
+// tokens are RS256 and are only accepted when firebase_project_id is set.
+func (s *Server) identify(token string) (caller, error) {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return caller{}, err
+	}
+
+	if unverified.Method == jwt.SigningMethodRS256 {
+		if s.firebase == nil {
+			return caller{}, errors.New("firebase tokens are not accepted")
+		}
+		uid, email, err := s.firebase.Verify(token)
+		if err != nil {
+			return caller{}, err
+		}
+		userID, err := s.user.GetUserIDByFirebaseUID(uid)
+		if err != nil {
+			return caller{}, err
+		}
+		return caller{UserID: userID, Email: email}, nil
+	}
+
+	claims, err := users.ParseToken(token)
+	if err != nil {
+		return caller{}, err
+	}
+
+	userID, email := claims.UserID, claims.Email
+	if userID <= 0 {
+		if userID, err = s.user.GetUserIDByEmail(email); err != nil {
+			return caller{}, err
+		}
+	}
+
+	// The user is looked up on every request, so the tokens of a deleted user
+	// stop working straight away rather than when they expire
+	user, err := s.user.GetUserByID(userID)
+	if err != nil {
+		return caller{}, err
+	}
+	if email != "" && !strings.EqualFold(email, user.Email) {
+		return caller{}, errors.New("token was issued for another email")
+	}
+	// Changing the password signs out every access token issued before it.
+	// Issue times are whole seconds, so the change is compared at that precision.
+	if user.PasswordChangedAt != nil && claims.IssuedAt.Unix() < user.PasswordChangedAt.Unix() {
+		return caller{}, errors.New("token was issued before the password changed")
+	}
+	return caller{UserID: userID, Email: user.Email}, nil
+}
+
+// callerFrom returns the authenticated caller of the request
+func callerFrom(r *http.Request) (caller, bool) {
+	c, ok := r.Context().Value(callerKey).(caller)
+	return c, ok
+}
+
+// callerEmail returns the authenticated caller's email, or "" when the request
+// was not authenticated.
+func callerEmail(r *http.Request) string {
+	c, _ := callerFrom(r)
+	return c.Email
+}
+
+// callerID returns the authenticated caller's user ID, or 0 when the request
+// was not authenticated.
+func callerID(r *http.Request) int {
+	c, _ := callerFrom(r)
+	return c.UserID
+}
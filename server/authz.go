@@ -0,0 +1,146 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/Abhinav7903/split/pkg/groups"
+)
+
+// Authorization helpers. Each one writes the error response itself and returns
+// false when the caller may not go on, so handlers can simply return. Admins
+// (see isAdmin) pass every check.
+
+// requireGroupMember allows members of the group, whatever their role.
+func (s *Server) requireGroupMember(w http.ResponseWriter, r *http.Request, groupID int) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+
+	isMember, err := s.group_members.IsGroupMember(groupID, callerID(r))
+	if err != nil {
+		s.logger.Error("failed to check group membership", "group_id", groupID, "error", err)
+		s.respond(w, ResponseMsg{Message: "Failed to check group membership"}, http.StatusInternalServerError, nil)
+		return false
+	}
+	if !isMember {
+		s.respond(w, ResponseMsg{Message: "You are not a member of this group"}, http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// archivedAllows lists what can still be done in an archived group: paying off
+// what is left and deleting the group.
+var archivedAllows = map[factory.Permission]bool{
+	factory.PermissionSettleForOthers: true,
+	factory.PermissionDeleteGroup:     true,
+}
+
+// requireGroupPermission allows members whose role in the group grants the
+// permission, as long as the group is not archived or the permission is still
+// usable in an archived group.
+func (s *Server) requireGroupPermission(w http.ResponseWriter, r *http.Request, groupID int, permission factory.Permission) bool {
+	if !archivedAllows[permission] && !s.requireGroupWritable(w, r, groupID) {
+		return false
+	}
+	return s.requireRolePermission(w, r, groupID, permission)
+}
+
+// requireRolePermission allows members whose role in the group grants the
+// permission, whether or not the group is archived.
+func (s *Server) requireRolePermission(w http.ResponseWriter, r *http.Request, groupID int, permission factory.Permission) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+
+	role, err := s.group_members.GetMemberRole(groupID, callerID(r))
+	if errors.Is(err, groupmember.ErrNotMember) {
+		s.respond(w, ResponseMsg{Message: "You are not a member of this group"}, http.StatusForbidden, nil)
+		return false
+	}
+	if err != nil {
+		s.logger.Error("failed to get member role", "group_id", groupID, "error", err)
+		s.respond(w, ResponseMsg{Message: "Failed to check group membership"}, http.StatusInternalServerError, nil)
+		return false
+	}
+	if !factory.RoleAllows(role, permission) {
+		s.respond(w, ResponseMsg{Message: "Your role in this group does not allow this"}, http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// requireGroupWritable refuses changes to an archived group, even from admins.
+// A group ID of zero means no group and always passes.
+func (s *Server) requireGroupWritable(w http.ResponseWriter, r *http.Request, groupID int) bool {
+	if groupID == 0 {
+		return true
+	}
+
+	group, err := s.group.GetGroup(groupID, false)
+	if errors.Is(err, groups.ErrNotFound) {
+		s.respond(w, ResponseMsg{Message: "Group not found"}, http.StatusNotFound, nil)
+		return false
+	}
+	if err != nil {
+		s.logger.Error("failed to get group", "group_id", groupID, "error", err)
+		s.respond(w, ResponseMsg{Message: "Failed to get group"}, http.StatusInternalServerError, nil)
+		return false
+	}
+	if group.ArchivedAt != nil {
+		s.respond(w, ResponseMsg{Message: "This group is archived and read-only"}, http.StatusConflict, nil)
+		return false
+	}
+	return true
+}
+
+// requireSelf allows the caller to act only on their own user ID.
+func (s *Server) requireSelf(w http.ResponseWriter, r *http.Request, userID int) bool {
+	if s.isAdmin(r) || userID == callerID(r) {
+		return true
+	}
+	s.respond(w, ResponseMsg{Message: "You can only access your own data"}, http.StatusForbidden, nil)
+	return false
+}
+
+// requireRequestParty allows only the sender and receiver of a payment request.
+func (s *Server) requireRequestParty(w http.ResponseWriter, r *http.Request, requestID int) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+
+	request, err := s.request.GetRequestByID(requestID)
+	if err != nil {
+		s.respond(w, ResponseMsg{Message: "Failed", Data: "Request not found"}, http.StatusNotFound, nil)
+		return false
+	}
+	caller := callerID(r)
+	if request.SenderID != caller && request.ReceiverID != caller {
+		s.respond(w, ResponseMsg{Message: "Failed", Data: "You are not part of this request"}, http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// requireTransactionAccess allows the lender, the borrower and members of the
+// transaction's group to read it.
+func (s *Server) requireTransactionAccess(w http.ResponseWriter, r *http.Request, transaction *factory.Transaction) bool {
+	caller := callerID(r)
+	if transaction.LenderID == caller || transaction.BorrowerID == caller {
+		return true
+	}
+	return s.requireGroupMember(w, r, transaction.GroupID)
+}
+
+// requireTransactionOwner allows the lender and members who may edit the
+// group's expenses to change or remove a transaction, unless its group is
+// archived.
+func (s *Server) requireTransactionOwner(w http.ResponseWriter, r *http.Request, transaction *factory.Transaction) bool {
+	if transaction.LenderID == callerID(r) {
+		return s.requireGroupWritable(w, r, transaction.GroupID)
+	}
+	return s.requireGroupPermission(w, r, transaction.GroupID, factory.PermissionEditExpenses)
+}
@@ -0,0 +1,462 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/balance"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/Abhinav7903/split/pkg/groups"
+	"github.com/Abhinav7903/split/pkg/invitation"
+	"github.com/Abhinav7903/split/pkg/recurring"
+	"github.com/Abhinav7903/split/pkg/request"
+	"github.com/Abhinav7903/split/pkg/settlement"
+	"github.com/Abhinav7903/split/pkg/transaction"
+	transactionsplit "github.com/Abhinav7903/split/pkg/transaction_split"
+	"github.com/Abhinav7903/split/pkg/users"
+	"github.com/gorilla/mux"
+	"github.com/spf13/viper"
+	"golang.org/x/exp/slog"
+)
+
+// The fakes embed the repository interfaces and implement what the routes
+// under test call, returning just enough for each handler to finish. Calling
+// anything else panics, which fails the test.
+
+type fakeUsers struct{ users.Repository }
+
+func (fakeUsers) GetUserByID(id int) (factory.User, error) {
+	return factory.User{Email: fmt.Sprintf("user%d@example.com", id), Name: fmt.Sprintf("User %d", id)}, nil
+}
+
+type fakeGroups struct{ groups.Repository }
+
+func (fakeGroups) GetGroup(groupID int, includeDeleted bool) (factory.Group, error) {
+	if groupID != testGroupID {
+		return factory.Group{}, groups.ErrNotFound
+	}
+	return factory.Group{GroupID: groupID, GroupName: "Trip", DefaultCurrency: "INR"}, nil
+}
+
+type fakeMembers struct{ groupmember.Repository }
+
+func (fakeMembers) IsGroupMember(groupID, userID int) (bool, error) {
+	_, ok := testRoles[userID]
+	return groupID == testGroupID && ok, nil
+}
+
+func (fakeMembers) GetMemberRole(groupID, userID int) (string, error) {
+	role, ok := testRoles[userID]
+	if groupID != testGroupID || !ok {
+		return "", groupmember.ErrNotMember
+	}
+	return role, nil
+}
+
+func (fakeMembers) GetGroupMembersByGroupID(groupID int) ([]factory.GroupMember, error) {
+	var members []factory.GroupMember
+	for userID, role := range testRoles {
+		members = append(members, factory.GroupMember{GroupID: groupID, UserID: userID, Role: role, Active: true})
+	}
+	return members, nil
+}
+
+func (fakeMembers) RemoveUserFromGroup(removal factory.MemberRemoval) error { return errNotStored }
+
+func (fakeMembers) SetMemberRole(groupID, userID int, role string) error { return errNotStored }
+
+// errNotStored is what the fakes return for writes; the handler reports it as
+// a failure, which is enough to show the caller got past authorization
+var errNotStored = errors.New("not stored in this test")
+
+func (fakeGroups) UpdateGroup(group factory.Group) error { return errNotStored }
+
+func (fakeGroups) DeleteGroup(groupID int, deletedBy int) error { return errNotStored }
+
+func (fakeGroups) ArchiveGroup(groupID int, archivedBy int) error { return errNotStored }
+
+func (fakeGroups) CloseOutGroup(groupID int, closedBy int) (groups.CloseOut, error) {
+	return groups.CloseOut{}, errNotStored
+}
+
+func (fakeGroups) PurgeGroup(groupID int, purgedBy int, force bool) ([]factory.GroupLog, error) {
+	return nil, errNotStored
+}
+
+func (fakeGroups) GetGroupLogs(groupID int) ([]factory.GroupLog, error) { return nil, nil }
+
+// Transaction 10 is lent by the member to the viewer in the test group
+const testTransactionID = 10
+
+type fakeTransactions struct{ transaction.Repository }
+
+func (fakeTransactions) GetTransactionByID(transactionID int, includeDeleted bool) (*factory.Transaction, error) {
+	if transactionID != testTransactionID {
+		return nil, transaction.ErrNotFound
+	}
+	return &factory.Transaction{TransactionID: transactionID, LenderID: memberID, BorrowerID: viewerID, GroupID: testGroupID, Amount: 1000, Currency: "INR"}, nil
+}
+
+func (fakeTransactions) CreateTransaction(created *factory.Transaction) (int, error) {
+	return 0, errNotStored
+}
+
+func (fakeTransactions) CreateExpense(expense *factory.Expense) (int, error) { return 0, errNotStored }
+
+func (fakeTransactions) GetGroupSpendByCurrency(groupID int) ([]factory.CurrencyAmount, error) {
+	return nil, nil
+}
+
+func (fakeTransactions) SearchTransactions(filters factory.TransactionFilters, page factory.PageRequest) (factory.TransactionSearchResult, error) {
+	return factory.TransactionSearchResult{}, nil
+}
+
+type fakeSplits struct{ transactionsplit.Repository }
+
+func (fakeSplits) GetTransactionSplits(transactionID int) ([]factory.TransactionSplit, error) {
+	return nil, nil
+}
+
+// Balance 30 is the member's in the test group; balance 31 is the member's
+// outside any group
+const (
+	testGroupBalanceID = 30
+	testOwnBalanceID   = 31
+)
+
+type fakeBalances struct{ balance.Repository }
+
+func (fakeBalances) GetBalanceByID(balanceID int) (*factory.Balance, error) {
+	groupID := testGroupID
+	switch balanceID {
+	case testGroupBalanceID:
+		return &factory.Balance{BalanceID: balanceID, UserID: memberID, GroupID: &groupID, Currency: "INR"}, nil
+	case testOwnBalanceID:
+		return &factory.Balance{BalanceID: balanceID, UserID: memberID, Currency: "INR"}, nil
+	}
+	return nil, nil
+}
+
+func (fakeBalances) GetGroupNetBalances(groupID int) ([]factory.NetBalance, error) { return nil, nil }
+
+// Request 20 is from the member to the viewer outside any group; request 21
+// is from the member to the admin in the test group
+const (
+	testOwnRequestID   = 20
+	testGroupRequestID = 21
+)
+
+type fakeRequests struct{ request.Repository }
+
+func (fakeRequests) GetRequestByID(requestID int) (factory.Request, error) {
+	groupID := testGroupID
+	switch requestID {
+	case testOwnRequestID:
+		return factory.Request{RequestID: requestID, SenderID: memberID, ReceiverID: viewerID, Amount: 500}, nil
+	case testGroupRequestID:
+		return factory.Request{RequestID: requestID, SenderID: memberID, ReceiverID: adminID, GroupID: &groupID, Amount: 500}, nil
+	}
+	return factory.Request{}, errors.New("request not found")
+}
+
+func (fakeRequests) GetRequestsByGroupID(groupID int, page factory.PageRequest) (factory.Page[factory.Request], error) {
+	return factory.Page[factory.Request]{}, nil
+}
+
+func (fakeRequests) UpdateRequestStatus(requestID int, status string, messages ...factory.OutboxMessage) error {
+	return errNotStored
+}
+
+func (fakeRequests) AddRequest(data factory.Request, messages ...factory.OutboxMessage) error {
+	return errNotStored
+}
+
+func (fakeRequests) DeleteRequest(requestID int) error { return errNotStored }
+
+type fakeSettlements struct{ settlement.Repository }
+
+func (fakeSettlements) RecordSettlement(settlement *factory.Settlement) (int, error) {
+	return 0, errNotStored
+}
+
+type fakeRecurring struct{ recurring.Repository }
+
+func (fakeRecurring) CreateRecurringExpense(r *factory.RecurringExpense) (int, error) {
+	return 0, errNotStored
+}
+
+func (fakeRecurring) ListRecurringExpenses(groupID int) ([]factory.RecurringExpense, error) {
+	return nil, nil
+}
+
+type fakeInvitations struct{ invitation.Repository }
+
+func (fakeInvitations) CreateInvitation(invitation factory.Invitation, messages ...factory.OutboxMessage) (factory.Invitation, error) {
+	return factory.Invitation{}, errNotStored
+}
+
+func (fakeInvitations) CreateJoinCode(code factory.JoinCode) (factory.JoinCode, error) {
+	return factory.JoinCode{}, errNotStored
+}
+
+const testGroupID = 1
+
+// Callers by their role in the test group; user 5 is not a member
+const (
+	ownerID     = 1
+	adminID     = 2
+	memberID    = 3
+	viewerID    = 4
+	nonMemberID = 5
+)
+
+var testRoles = map[int]string{
+	ownerID:  factory.RoleOwner,
+	adminID:  factory.RoleAdmin,
+	memberID: factory.RoleMember,
+	viewerID: factory.RoleViewer,
+}
+
+func newAuthzTestServer(t *testing.T) *Server {
+	t.Helper()
+	viper.Set("jwt_secret", strings.Repeat("k", users.MinJWTSecretLength))
+	viper.Set("admin_key", "")
+	t.Cleanup(func() { viper.Set("jwt_secret", "") })
+
+	s := &Server{
+		router:           mux.NewRouter(),
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		user:             fakeUsers{},
+		group:            fakeGroups{},
+		group_members:    fakeMembers{},
+		invitation:       fakeInvitations{},
+		transaction:      fakeTransactions{},
+		transactionsplit: fakeSplits{},
+		balance:          fakeBalances{},
+		request:          fakeRequests{},
+		settlement:       fakeSettlements{},
+		recurring:        fakeRecurring{},
+	}
+	s.RegisterRoutes()
+	return s
+}
+
+// serve sends the request as userID and returns the response status. A
+// handler that panics fails the test.
+func serve(t *testing.T, s *Server, userID int, method, target, body string) int {
+	t.Helper()
+	token, err := users.CreateToken(userID, fmt.Sprintf("user%d@example.com", userID), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	defer func() {
+		if p := recover(); p != nil {
+			t.Fatalf("%s %s panicked: %v", method, target, p)
+		}
+	}()
+	s.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	everyone := []int{ownerID, adminID, memberID, viewerID}
+	contributors := []int{ownerID, adminID, memberID}
+	managers := []int{ownerID, adminID}
+	owner := []int{ownerID}
+	memberOnly := []int{memberID}
+	requestParties := []int{memberID, viewerID}
+	nobody := []int{}
+
+	startAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		method  string
+		target  string
+		body    string
+		allowed []int
+	}{
+		{http.MethodGet, "/get-group?group_id=1", "", everyone},
+		{http.MethodGet, "/get-group-settle-up?group_id=1", "", everyone},
+		{http.MethodGet, "/group-totals?group_id=1", "", everyone},
+		{http.MethodGet, "/group-history?group_id=1", "", everyone},
+		{http.MethodGet, "/get-group-members-by-group-id?group_id=1", "", everyone},
+		{http.MethodGet, "/recurring-expenses?group_id=1", "", everyone},
+		{http.MethodPost, "/create-transaction", `{"group_id":1,"borrower_id":4,"amount":"10.00"}`, contributors},
+		{http.MethodPost, "/add-expense", `{"group_id":1,"amount":"10.00","participants":[{"user_id":4,"amount":"10.00"}]}`, contributors},
+		{http.MethodPost, "/recurring-expenses", `{"group_id":1,"amount":"10.00","participants":[{"user_id":4,"amount":"10.00"}],"frequency":"daily","start_at":"` + startAt + `"}`, contributors},
+		{http.MethodPost, "/group-invitations", `{"group_id":1,"user_id":6}`, contributors},
+		{http.MethodPost, "/settlement", `{"user_id":6,"counterparty_id":4,"group_id":1,"amount":"5.00"}`, managers},
+		{http.MethodPut, "/update-group", `{"group_id":1,"group_name":"Holiday"}`, managers},
+		{http.MethodPost, "/join-codes", `{"group_id":1}`, managers},
+		{http.MethodDelete, "/remove-group-member?group_id=1&user_id=4", "", managers},
+		{http.MethodPost, "/archive-group?group_id=1", "", managers},
+		{http.MethodPost, "/close-out-group?group_id=1", "", managers},
+		{http.MethodPut, "/group-member-role", `{"group_id":1,"user_id":4,"role":"member"}`, owner},
+		{http.MethodDelete, "/delete-group?group_id=1", "", owner},
+		{http.MethodDelete, "/purge-group?group_id=1", "", owner},
+
+		// Transactions are visible to their lender, borrower and group
+		{http.MethodGet, "/get-transaction?id=10", "", everyone},
+		{http.MethodGet, "/get-transaction-splits/10", "", everyone},
+		{http.MethodPost, "/search-transactions", `{"group_id":1}`, everyone},
+		{http.MethodPost, "/search-transactions", `{"lender_id":3}`, memberOnly},
+
+		// Payment requests
+		{http.MethodGet, "/requests-by-group?group_id=1", "", everyone},
+		{http.MethodPost, "/request", `{"receiver_id":4,"group_id":1,"amount":"5.00"}`, everyone},
+		{http.MethodGet, "/request?request_id=20", "", requestParties},
+		{http.MethodGet, "/request?request_id=21", "", everyone},
+		{http.MethodPut, "/request", `{"request_id":20,"sender_id":3,"receiver_id":4,"amount":"5.00","status":"accepted"}`, requestParties},
+		{http.MethodDelete, "/request", `{"request_id":20}`, requestParties},
+
+		// Balances are readable by their user and group; writes need the admin key
+		{http.MethodGet, "/balance?balance_id=30", "", everyone},
+		{http.MethodGet, "/balance?balance_id=31", "", memberOnly},
+		{http.MethodPost, "/balance", `{"user_id":3,"owed_amount":"1.00","reason":"fix"}`, nobody},
+		{http.MethodPut, "/balance?balance_id=30", `{"owed_amount":"1.00","reason":"fix"}`, nobody},
+		{http.MethodDelete, "/balance?balance_id=30&reason=fix", "", nobody},
+	}
+
+	s := newAuthzTestServer(t)
+	callers := map[int]string{
+		ownerID:     "owner",
+		adminID:     "admin",
+		memberID:    "member",
+		viewerID:    "viewer",
+		nonMemberID: "non-member",
+	}
+	for _, tt := range tests {
+		allowed := make(map[int]bool, len(tt.allowed))
+		for _, userID := range tt.allowed {
+			allowed[userID] = true
+		}
+
+		for userID, name := range callers {
+			t.Run(tt.method+" "+tt.target+" as "+name, func(t *testing.T) {
+				status := serve(t, s, userID, tt.method, tt.target, tt.body)
+				if allowed[userID] && (status == http.StatusForbidden || status == http.StatusUnauthorized) {
+					t.Errorf("status = %d, want the caller to be let through", status)
+				}
+				if !allowed[userID] && status != http.StatusForbidden {
+					t.Errorf("status = %d, want %d", status, http.StatusForbidden)
+				}
+			})
+		}
+	}
+}
+
+// leavingMembers records how members leave; writeOffErr is what a self
+// write-off returns
+type leavingMembers struct {
+	fakeMembers
+	writeOffErr error
+	removals    *[]factory.MemberRemoval
+}
+
+func (m leavingMembers) RequestLeave(removal factory.MemberRemoval) (factory.LeaveRequest, error) {
+	*m.removals = append(*m.removals, removal)
+	return factory.LeaveRequest{GroupID: removal.GroupID, UserID: removal.UserID, TransferTo: *removal.TransferTo}, nil
+}
+
+func (m leavingMembers) RemoveUserSelf(removal factory.MemberRemoval) error {
+	*m.removals = append(*m.removals, removal)
+	return m.writeOffErr
+}
+
+func TestMemberLeavesSettlingOwnBalances(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		writeOffErr error
+		wantStatus  int
+		wantSettle  string
+	}{
+		{"transfer waits for approval", "&settle=transfer&transfer_to=1", nil, http.StatusAccepted, factory.SettleTransfer},
+		{"write off", "&settle=write_off", nil, http.StatusOK, factory.SettleWriteOff},
+		{"write off while owing", "&settle=write_off", groupmember.ErrSelfWriteOff, http.StatusForbidden, factory.SettleWriteOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var removals []factory.MemberRemoval
+			s := newAuthzTestServer(t)
+			s.group_members = leavingMembers{writeOffErr: tt.writeOffErr, removals: &removals}
+
+			status := serve(t, s, memberID, http.MethodDelete, "/remove-group-member-self?group_id=1"+tt.query, "")
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if len(removals) != 1 || removals[0].UserID != memberID || removals[0].Settle != tt.wantSettle {
+				t.Errorf("removals = %+v, want one %s for user %d", removals, tt.wantSettle, memberID)
+			}
+		})
+	}
+}
+
+func TestMissingTransactionNotFound(t *testing.T) {
+	s := newAuthzTestServer(t)
+	targets := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/get-transaction?id=99", ""},
+		{http.MethodGet, "/get-transaction-splits/99", ""},
+		{http.MethodPost, "/create-transaction-split", `{"transaction_id":99,"mode":"equal"}`},
+	}
+
+	for _, tt := range targets {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			if status := serve(t, s, ownerID, tt.method, tt.target, tt.body); status != http.StatusNotFound {
+				t.Errorf("status = %d, want %d", status, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+// passwordChangedUsers is fakeUsers for users whose password changed at changedAt
+type passwordChangedUsers struct {
+	fakeUsers
+	changedAt time.Time
+}
+
+func (u passwordChangedUsers) GetUserByID(id int) (factory.User, error) {
+	user, err := u.fakeUsers.GetUserByID(id)
+	user.PasswordChangedAt = &u.changedAt
+	return user, err
+}
+
+func TestTokensIssuedBeforePasswordChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		changedAt  time.Time
+		wantReject bool
+	}{
+		{"token issued after the change", time.Now().Add(-time.Minute), false},
+		{"token issued before the change", time.Now().Add(time.Minute), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAuthzTestServer(t)
+			s.user = passwordChangedUsers{changedAt: tt.changedAt}
+
+			status := serve(t, s, ownerID, http.MethodGet, "/get-transaction?id=10", "")
+			if (status == http.StatusUnauthorized) != tt.wantReject {
+				t.Errorf("status = %d, want rejected: %v", status, tt.wantReject)
+			}
+		})
+	}
+}
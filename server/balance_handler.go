@@ -16,22 +16,36 @@ func (s *Server) handlerAddBalance() http.HandlerFunc {
 			return
 		}
 
+		// Manual balance writes are admin adjustments
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		// Parse the JSON payload
-		var balance factory.Balance
-		err := json.NewDecoder(r.Body).Decode(&balance)
+		var request struct {
+			factory.Balance
+			Reason string `json:"reason"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
 
 		// Validate the input
+		balance := request.Balance
 		if balance.UserID <= 0 || balance.OwedAmount < 0 || balance.LentAmount < 0 {
 			http.Error(w, "Invalid balance data", http.StatusBadRequest)
 			return
 		}
+		if request.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
 
 		// Add the balance
-		balanceID, err := s.balance.CreateBalance(&balance)
+		balanceID, err := s.balance.CreateBalance(&balance, callerID(r), request.Reason)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to add balance"}, http.StatusInternalServerError, nil)
 			return
@@ -77,6 +91,17 @@ func (s *Server) handlerGetBalanceByID() http.HandlerFunc {
 			return
 		}
 
+		// Users see their own balances and those of groups they belong to
+		if balance.UserID != callerID(r) {
+			if balance.GroupID == nil {
+				if !s.requireSelf(w, r, balance.UserID) {
+					return
+				}
+			} else if !s.requireGroupMember(w, r, *balance.GroupID) {
+				return
+			}
+		}
+
 		// Respond with the balance data
 		s.respond(w, ResponseMsg{Message: "Balance fetched successfully", Data: balance}, http.StatusOK, nil)
 	}
@@ -90,6 +115,12 @@ func (s *Server) handlerUpdateBalance() http.HandlerFunc {
 			return
 		}
 
+		// Manual balance writes are admin adjustments
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		// Extract balance ID from the URL
 		balanceID := r.URL.Query().Get("balance_id")
 		if balanceID == "" {
@@ -105,21 +136,29 @@ func (s *Server) handlerUpdateBalance() http.HandlerFunc {
 		}
 
 		// Parse the JSON payload
-		var balance factory.Balance
-		err = json.NewDecoder(r.Body).Decode(&balance)
+		var request struct {
+			OwedAmount *factory.Money `json:"owed_amount"`
+			LentAmount *factory.Money `json:"lent_amount"`
+			Reason     string         `json:"reason"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&request)
 		if err != nil {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
 
 		// Validate the input
-		if balance.OwedAmount < 0 || balance.LentAmount < 0 {
+		if (request.OwedAmount != nil && *request.OwedAmount < 0) || (request.LentAmount != nil && *request.LentAmount < 0) {
 			http.Error(w, "Invalid balance data", http.StatusBadRequest)
 			return
 		}
+		if request.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
 
-		// Update the balance
-		err = s.balance.UpdateBalanceAmounts(id, &balance.OwedAmount, &balance.LentAmount)
+		// Adjust the balance
+		err = s.balance.AdjustBalanceAmounts(id, request.OwedAmount, request.LentAmount, callerID(r), request.Reason)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to update balance"}, http.StatusInternalServerError, nil)
 			return
@@ -137,6 +176,12 @@ func (s *Server) handlerDeleteBalance() http.HandlerFunc {
 			return
 		}
 
+		// Manual balance writes are admin adjustments
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
 		// Extract balance ID from the URL
 		balanceID := r.URL.Query().Get("balance_id")
 		if balanceID == "" {
@@ -151,8 +196,15 @@ func (s *Server) handlerDeleteBalance() http.HandlerFunc {
 			return
 		}
 
+		// Why the balance is being deleted
+		reason := r.URL.Query().Get("reason")
+		if reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
 		// Delete the balance
-		err = s.balance.DeleteBalance(id)
+		err = s.balance.DeleteBalance(id, callerID(r), reason)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to delete balance"}, http.StatusInternalServerError, nil)
 			return
@@ -162,3 +214,132 @@ func (s *Server) handlerDeleteBalance() http.HandlerFunc {
 		s.respond(w, ResponseMsg{Message: "Balance deleted successfully"}, http.StatusOK, nil)
 	}
 }
+
+func (s *Server) handlerGetBalanceAdjustments() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Extract balance ID from the URL
+		id, err := strconv.Atoi(r.URL.Query().Get("balance_id"))
+		if err != nil {
+			http.Error(w, "Invalid balance ID", http.StatusBadRequest)
+			return
+		}
+
+		adjustments, err := s.balance.GetBalanceAdjustments(id)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to fetch balance adjustments"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Balance adjustments fetched successfully", Data: adjustments}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerGetUserNetBalances() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract user ID from the URL
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil || userID <= 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		if !s.requireSelf(w, r, userID) {
+			return
+		}
+
+		balances, err := s.balance.GetUserNetBalances(userID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to fetch balances"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Balances fetched successfully", Data: balances}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerGetGroupNetBalances() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract group ID from the URL
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group ID", http.StatusBadRequest)
+			return
+		}
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		balances, err := s.balance.GetGroupNetBalances(groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to fetch balances"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Balances fetched successfully", Data: balances}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerGetPairwiseBalance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Extract both user IDs and the optional group ID from the URL
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil || userID <= 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+
+		otherUserID, err := strconv.Atoi(r.URL.Query().Get("other_user_id"))
+		if err != nil || otherUserID <= 0 {
+			http.Error(w, "Invalid other user ID", http.StatusBadRequest)
+			return
+		}
+
+		var groupID *int
+		if value := r.URL.Query().Get("group_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid group ID", http.StatusBadRequest)
+				return
+			}
+			groupID = &id
+		}
+
+		// Within a group any member may look; otherwise only one of the pair
+		if groupID != nil {
+			if !s.requireGroupMember(w, r, *groupID) {
+				return
+			}
+		} else if otherUserID != callerID(r) && !s.requireSelf(w, r, userID) {
+			return
+		}
+
+		balances, err := s.balance.GetPairwiseBalance(userID, otherUserID, groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to fetch balance"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Balances fetched successfully", Data: balances}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerReconcileBalances() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		discrepancies, err := s.balance.ReconcileBalances()
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to reconcile balances"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Balances reconciled successfully", Data: discrepancies}, http.StatusOK, nil)
+	}
+}
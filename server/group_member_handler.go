@@ -2,11 +2,13 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
 )
 
 func (s *Server) handleAddGroupMember() http.HandlerFunc {
@@ -33,17 +35,27 @@ func (s *Server) handleAddGroupMember() http.HandlerFunc {
 			return
 		}
 
-		// Add the group member via repository
-		groupMemberID, err := s.group_members.AddGroupMember(groupMember)
+		// Members can invite others, viewers cannot
+		if !s.requireGroupPermission(w, r, groupMember.GroupID, factory.PermissionInviteMembers) {
+			return
+		}
+
+		// Members join only by accepting, so this invites the user
+		inv, err := s.inviteToGroup(r, groupMember.GroupID, &groupMember.UserID, nil)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed to add group member"}, http.StatusInternalServerError, nil)
+			status := invitationErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.Error("failed to invite group member", "group_id", groupMember.GroupID, "error", err)
+				status = http.StatusBadRequest
+			}
+			s.respond(w, ResponseMsg{Message: err.Error()}, status, nil)
 			return
 		}
 
-		// Respond with success and the new group member ID
+		// Respond with the invitation the user has to accept
 		s.respond(w, ResponseMsg{
-			Message: "Group member added successfully",
-			Data:    groupMemberID,
+			Message: "Invitation sent to group member",
+			Data:    inv,
 		}, http.StatusOK, nil)
 	}
 }
@@ -77,6 +89,11 @@ func (s *Server) handleGetGroupMember() http.HandlerFunc {
 			return
 		}
 
+		// Only members of the same group can see the membership
+		if !s.requireGroupMember(w, r, groupMember.GroupID) {
+			return
+		}
+
 		// Respond with the group member
 		s.respond(w, ResponseMsg{
 			Message: "Group member retrieved successfully",
@@ -107,6 +124,11 @@ func (s *Server) handleGetGroupMembersByGroupID() http.HandlerFunc {
 			return
 		}
 
+		// Only members can list the group's members
+		if !s.requireGroupMember(w, r, id) {
+			return
+		}
+
 		// Retrieve the group members from the repository
 		groupMembers, err := s.group_members.GetGroupMembersByGroupID(id)
 		if err != nil {
@@ -130,12 +152,11 @@ func (s *Server) handleRemoveUserFromGroupByCreator() http.HandlerFunc {
 			return
 		}
 
-		// Get group ID, user ID, and creator ID from URL params or request body
+		// Get group ID and user ID from URL params; the caller's role must allow removing members
 		groupIDStr := r.URL.Query().Get("group_id")
 		userIDStr := r.URL.Query().Get("user_id")
-		creatorIDStr := r.URL.Query().Get("creator_id")
 
-		if groupIDStr == "" || userIDStr == "" || creatorIDStr == "" {
+		if groupIDStr == "" || userIDStr == "" {
 			s.respond(w, ResponseMsg{Message: "Missing required parameters"}, http.StatusBadRequest, nil)
 			return
 		}
@@ -152,16 +173,23 @@ func (s *Server) handleRemoveUserFromGroupByCreator() http.HandlerFunc {
 			return
 		}
 
-		creatorID, err := strconv.Atoi(creatorIDStr)
-		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Invalid creator ID"}, http.StatusBadRequest, nil)
+		// Owners and admins can remove members ranked below them
+		if !s.requireGroupPermission(w, r, groupID, factory.PermissionRemoveMembers) {
+			return
+		}
+		if !s.requireOutranks(w, r, groupID, userID) {
 			return
 		}
 
-		// Remove user from the group by the group creator
-		err = s.group_members.RemoveUserFromGroupByCreator(groupID, userID, creatorID)
+		removal, ok := s.parseMemberRemoval(w, r, groupID, userID)
+		if !ok {
+			return
+		}
+
+		// Remove user from the group
+		err = s.group_members.RemoveUserFromGroup(removal)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: fmt.Sprintf("Failed to remove user from group: %v", err)}, http.StatusInternalServerError, nil)
+			s.respondRemovalError(w, err)
 			return
 		}
 
@@ -178,11 +206,10 @@ func (s *Server) handleRemoveUserSelfFromGroup() http.HandlerFunc {
 			return
 		}
 
-		// Get group ID and user ID from URL params or request body
+		// Get group ID from URL params; the caller is the one leaving
 		groupIDStr := r.URL.Query().Get("group_id")
-		userIDStr := r.URL.Query().Get("user_id")
 
-		if groupIDStr == "" || userIDStr == "" {
+		if groupIDStr == "" {
 			s.respond(w, ResponseMsg{Message: "Missing required parameters"}, http.StatusBadRequest, nil)
 			return
 		}
@@ -193,16 +220,30 @@ func (s *Server) handleRemoveUserSelfFromGroup() http.HandlerFunc {
 			return
 		}
 
-		userID, err := strconv.Atoi(userIDStr)
-		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Invalid user ID"}, http.StatusBadRequest, nil)
+		removal, ok := s.parseMemberRemoval(w, r, groupID, callerID(r))
+		if !ok {
 			return
 		}
 
-		// Remove the user from the group
-		err = s.group_members.RemoveUserSelf(groupID, userID)
+		// Nobody takes over someone's balances without agreeing to it, so a
+		// transfer waits for that member or the owner to approve it
+		if removal.Settle == factory.SettleTransfer {
+			request, err := s.group_members.RequestLeave(removal)
+			if err != nil {
+				s.respondRemovalError(w, err)
+				return
+			}
+			s.respond(w, ResponseMsg{
+				Message: "Waiting for the member taking over your balances, or the owner, to approve",
+				Data:    request,
+			}, http.StatusAccepted, nil)
+			return
+		}
+
+		// Remove the user from the group; owners hand over ownership first
+		err = s.group_members.RemoveUserSelf(removal)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: fmt.Sprintf("Failed to remove user from group: %v", err)}, http.StatusInternalServerError, nil)
+			s.respondRemovalError(w, err)
 			return
 		}
 
@@ -210,3 +251,273 @@ func (s *Server) handleRemoveUserSelfFromGroup() http.HandlerFunc {
 		s.respond(w, ResponseMsg{Message: "User removed from group successfully"}, http.StatusOK, nil)
 	}
 }
+
+// handleGetLeaveRequests lists a group's pending leave requests for its members
+func (s *Server) handleGetLeaveRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		requests, err := s.group_members.ListLeaveRequests(groupID)
+		if err != nil {
+			s.logger.Error("failed to get leave requests", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to get leave requests"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Leave requests fetched successfully", Data: requests}, http.StatusOK, nil)
+	}
+}
+
+// handleDecideLeaveRequest lets the member taking over the balances, or the
+// owner, approve or reject a pending leave request
+func (s *Server) handleDecideLeaveRequest(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		leaveRequestID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || leaveRequestID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid leave request ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		request, err := s.group_members.GetLeaveRequest(leaveRequestID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, groupMemberErrorStatus(err), nil)
+			return
+		}
+
+		if request.TransferTo != callerID(r) && !s.requireGroupOwner(w, r, request.GroupID) {
+			return
+		}
+
+		if err := s.group_members.DecideLeaveRequest(leaveRequestID, approve, callerID(r)); err != nil {
+			s.respondRemovalError(w, err)
+			return
+		}
+
+		if approve {
+			s.respond(w, ResponseMsg{Message: "Leave request approved"}, http.StatusOK, nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "Leave request rejected"}, http.StatusOK, nil)
+	}
+}
+
+// requireGroupOwner allows only the group's owner
+func (s *Server) requireGroupOwner(w http.ResponseWriter, r *http.Request, groupID int) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+
+	role, err := s.group_members.GetMemberRole(groupID, callerID(r))
+	if err != nil && !errors.Is(err, groupmember.ErrNotMember) {
+		s.logger.Error("failed to get member role", "group_id", groupID, "error", err)
+		s.respond(w, ResponseMsg{Message: "Failed to check group membership"}, http.StatusInternalServerError, nil)
+		return false
+	}
+	if role != factory.RoleOwner {
+		s.respond(w, ResponseMsg{Message: "Only the member taking over the balances or the group owner can decide this"}, http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// groupMemberErrorStatus maps group member errors to response statuses
+func groupMemberErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, groupmember.ErrNotMember),
+		errors.Is(err, groupmember.ErrLeaveRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, groupmember.ErrSelfWriteOff):
+		return http.StatusForbidden
+	case errors.Is(err, groupmember.ErrOwnerRole),
+		errors.Is(err, groupmember.ErrOwnerCannotLeave),
+		errors.Is(err, groupmember.ErrOutstandingBalance),
+		errors.Is(err, groupmember.ErrLeaveRequestClosed),
+		errors.Is(err, groupmember.ErrLeaveRequestPending):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// parseMemberRemoval reads how a departing member's balances are settled from
+// the settle and transfer_to query parameters. Settling balances for someone
+// needs the settle_for_others permission.
+func (s *Server) parseMemberRemoval(w http.ResponseWriter, r *http.Request, groupID, userID int) (factory.MemberRemoval, bool) {
+	removal := factory.MemberRemoval{
+		GroupID:   groupID,
+		UserID:    userID,
+		RemovedBy: callerID(r),
+		Settle:    r.URL.Query().Get("settle"),
+	}
+
+	switch removal.Settle {
+	case factory.SettleNone:
+		return removal, true
+	case factory.SettleTransfer:
+		transferTo, err := strconv.Atoi(r.URL.Query().Get("transfer_to"))
+		if err != nil || transferTo <= 0 || transferTo == userID {
+			s.respond(w, ResponseMsg{Message: "settle=transfer needs transfer_to, the user ID of another member"}, http.StatusBadRequest, nil)
+			return removal, false
+		}
+		removal.TransferTo = &transferTo
+	case factory.SettleWriteOff:
+	default:
+		s.respond(w, ResponseMsg{Message: "settle must be transfer or write_off"}, http.StatusBadRequest, nil)
+		return removal, false
+	}
+
+	// Members leaving on their own settle their own balances
+	if userID != callerID(r) && !s.requireGroupPermission(w, r, groupID, factory.PermissionSettleForOthers) {
+		return removal, false
+	}
+	return removal, true
+}
+
+// respondRemovalError writes the response for a failed leave or removal. A
+// member with outstanding balances gets them back with the 409.
+func (s *Server) respondRemovalError(w http.ResponseWriter, err error) {
+	var outstanding *groupmember.OutstandingBalanceError
+	if errors.As(err, &outstanding) {
+		s.respond(w, ResponseMsg{
+			Message: "Member has outstanding balances in this group; settle up first, or retry with settle=transfer&transfer_to=<user_id> or settle=write_off",
+			Data:    outstanding.Balances,
+		}, http.StatusConflict, nil)
+		return
+	}
+
+	status := groupMemberErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		s.logger.Error("failed to remove user from group", "error", err)
+		status = http.StatusBadRequest
+	}
+	s.respond(w, ResponseMsg{Message: fmt.Sprintf("Failed to remove user from group: %v", err)}, status, nil)
+}
+
+// requireOutranks allows the caller to act on another member only when their
+// role ranks above the other member's, so admins cannot act on other admins.
+func (s *Server) requireOutranks(w http.ResponseWriter, r *http.Request, groupID, userID int) bool {
+	if s.isAdmin(r) {
+		return true
+	}
+
+	callerRole, err := s.group_members.GetMemberRole(groupID, callerID(r))
+	if err != nil {
+		s.respond(w, ResponseMsg{Message: "You are not a member of this group"}, http.StatusForbidden, nil)
+		return false
+	}
+	targetRole, err := s.group_members.GetMemberRole(groupID, userID)
+	if err != nil {
+		s.respond(w, ResponseMsg{Message: err.Error()}, groupMemberErrorStatus(err), nil)
+		return false
+	}
+	if !factory.RoleOutranks(callerRole, targetRole) {
+		s.respond(w, ResponseMsg{Message: "You can only act on members ranked below you"}, http.StatusForbidden, nil)
+		return false
+	}
+	return true
+}
+
+// handleGetMyGroupRole returns the caller's role in a group and what it allows
+func (s *Server) handleGetMyGroupRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		role, err := s.group_members.GetMemberRole(groupID, callerID(r))
+		if errors.Is(err, groupmember.ErrNotMember) {
+			s.respond(w, ResponseMsg{Message: "You are not a member of this group"}, http.StatusForbidden, nil)
+			return
+		}
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to get group role"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		response := map[string]interface{}{
+			"group_id":    groupID,
+			"role":        role,
+			"permissions": factory.RolePermissions(role),
+		}
+		s.respond(w, ResponseMsg{Message: "Group role fetched successfully", Data: response}, http.StatusOK, nil)
+	}
+}
+
+// handleSetGroupMemberRole lets the owner promote or demote a member between
+// admin, member and viewer
+func (s *Server) handleSetGroupMemberRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var groupMember factory.GroupMember
+		if err := json.NewDecoder(r.Body).Decode(&groupMember); err != nil {
+			s.respond(w, ResponseMsg{Message: "Invalid request payload"}, http.StatusBadRequest, nil)
+			return
+		}
+		if groupMember.GroupID <= 0 || groupMember.UserID <= 0 || !factory.ValidRole(groupMember.Role) {
+			s.respond(w, ResponseMsg{Message: "group_id, user_id and a role of admin, member or viewer are required"}, http.StatusBadRequest, nil)
+			return
+		}
+		if groupMember.Role == factory.RoleOwner {
+			s.respond(w, ResponseMsg{Message: "Use /transfer-group-ownership to change the owner"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, groupMember.GroupID, factory.PermissionManageRoles) {
+			return
+		}
+
+		err := s.group_members.SetMemberRole(groupMember.GroupID, groupMember.UserID, groupMember.Role)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, groupMemberErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group member role updated successfully"}, http.StatusOK, nil)
+	}
+}
+
+// handleTransferGroupOwnership hands the caller's group to another member.
+// The caller stays on as an admin.
+func (s *Server) handleTransferGroupOwnership() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			GroupID int `json:"group_id"`
+			UserID  int `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.respond(w, ResponseMsg{Message: "Invalid request payload"}, http.StatusBadRequest, nil)
+			return
+		}
+		if body.GroupID <= 0 || body.UserID <= 0 {
+			s.respond(w, ResponseMsg{Message: "group_id and user_id are required"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Only the owner themselves can hand the group over
+		role, err := s.group_members.GetMemberRole(body.GroupID, callerID(r))
+		if err != nil || role != factory.RoleOwner {
+			s.respond(w, ResponseMsg{Message: "Only the group owner can transfer ownership"}, http.StatusForbidden, nil)
+			return
+		}
+
+		err = s.group_members.TransferOwnership(body.GroupID, callerID(r), body.UserID)
+		if err != nil {
+			status := groupMemberErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.Error("failed to transfer group ownership", "group_id", body.GroupID, "error", err)
+			}
+			s.respond(w, ResponseMsg{Message: err.Error()}, status, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group ownership transferred successfully"}, http.StatusOK, nil)
+	}
+}
@@ -2,10 +2,14 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/exchange"
+	"github.com/Abhinav7903/split/pkg/groups"
+	"github.com/Abhinav7903/split/pkg/settleup"
 )
 
 func (s *Server) handlerAddGroup() http.HandlerFunc {
@@ -23,6 +27,7 @@ func (s *Server) handlerAddGroup() http.HandlerFunc {
 			http.Error(w, "Invalid request payload", http.StatusBadRequest)
 			return
 		}
+		group.CreatedBy = callerID(r)
 
 		// Validate the input
 		if group.GroupName == "" || group.CreatedBy <= 0 {
@@ -65,8 +70,13 @@ func (s *Server) handlerGetGroup() http.HandlerFunc {
 			return
 		}
 
+		// Only members can see the group
+		if !s.requireGroupMember(w, r, groupIDInt) {
+			return
+		}
+
 		// Retrieve the group
-		group, err := s.group.GetGroup(groupIDInt)
+		group, err := s.group.GetGroup(groupIDInt, s.includeDeleted(r))
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to get group"}, http.StatusInternalServerError, nil)
 			return
@@ -77,6 +87,112 @@ func (s *Server) handlerGetGroup() http.HandlerFunc {
 	}
 }
 
+func (s *Server) handlerGetGroupSettleUp() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check for the correct HTTP method
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the group ID from the query parameters
+		groupID := r.URL.Query().Get("group_id")
+		if groupID == "" {
+			http.Error(w, "group_id is required", http.StatusBadRequest)
+			return
+		}
+
+		// Convert the group ID to an integer
+		groupIDInt, err := strconv.Atoi(groupID)
+		if err != nil {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Only members can see the group's balances
+		if !s.requireGroupMember(w, r, groupIDInt) {
+			return
+		}
+
+		// Work out everyone's net position in the group
+		balances, err := s.balance.GetGroupNetBalances(groupIDInt)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to get group balances"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		// Plan the fewest transfers that settle the group
+		transfers, err := settleup.Plan(balances)
+		if err != nil {
+			s.logger.Error("failed to plan settle up", "group_id", groupIDInt, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to plan settle up"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		// Respond with the balances and the suggested transfers
+		response := map[string]interface{}{
+			"group_id":  groupIDInt,
+			"balances":  balances,
+			"transfers": transfers,
+		}
+		s.respond(w, ResponseMsg{Message: "Settle up plan fetched successfully", Data: response}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerGetGroupTotals() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check for the correct HTTP method
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Parse the group ID from the query parameters
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Only members can see the group's totals
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		group, err := s.group.GetGroup(groupID, false)
+		if err != nil {
+			http.Error(w, "Group not found", http.StatusNotFound)
+			return
+		}
+
+		// Totals are kept per currency and only converted for display
+		totals, err := s.transaction.GetGroupSpendByCurrency(groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to get group totals"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		var converted factory.Money
+		for _, total := range totals {
+			amount, err := exchange.Convert(s.exchange, total.Amount, total.Currency, group.DefaultCurrency)
+			if err != nil {
+				s.logger.Error("failed to convert group total", "group_id", groupID, "currency", total.Currency, "error", err)
+				s.respond(w, ResponseMsg{Message: "No exchange rate for " + total.Currency}, http.StatusUnprocessableEntity, nil)
+				return
+			}
+			converted += amount
+		}
+
+		response := map[string]interface{}{
+			"group_id":         groupID,
+			"default_currency": group.DefaultCurrency,
+			"totals":           totals,
+			"converted_total":  converted,
+		}
+		s.respond(w, ResponseMsg{Message: "Group totals fetched successfully", Data: response}, http.StatusOK, nil)
+	}
+}
+
 func (s *Server) handlerGetAllGroups() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check for the correct HTTP method
@@ -85,8 +201,23 @@ func (s *Server) handlerGetAllGroups() http.HandlerFunc {
 			return
 		}
 
-		// Retrieve all groups
-		groups, err := s.group.GetAllGroups()
+		page, err := parsePageRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Admins see every group, everyone else only the groups they belong to
+		var groups factory.Page[factory.Group]
+		if s.isAdmin(r) {
+			groups, err = s.group.GetAllGroups(s.includeDeleted(r), page)
+		} else {
+			groups, err = s.group_members.ListGroupsForUser(callerID(r), page)
+		}
+		if errors.Is(err, factory.ErrInvalidPage) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to get all groups"}, http.StatusInternalServerError, nil)
 			return
@@ -114,11 +245,16 @@ func (s *Server) handlerUpdateGroup() http.HandlerFunc {
 		}
 
 		// Validate the input
-		if group.GroupName == "" || group.CreatedBy <= 0 {
+		if group.GroupID <= 0 || group.GroupName == "" {
 			http.Error(w, "Invalid group data", http.StatusBadRequest)
 			return
 		}
 
+		// Owners and admins can change the group
+		if !s.requireGroupPermission(w, r, group.GroupID, factory.PermissionManageGroup) {
+			return
+		}
+
 		// Update the group
 		err = s.group.UpdateGroup(group)
 		if err != nil {
@@ -153,8 +289,13 @@ func (s *Server) handlerDeleteGroup() http.HandlerFunc {
 			return
 		}
 
+		// Only the owner can delete the group
+		if !s.requireGroupPermission(w, r, groupIDInt, factory.PermissionDeleteGroup) {
+			return
+		}
+
 		// Delete the group
-		err = s.group.DeleteGroup(groupIDInt)
+		err = s.group.DeleteGroup(groupIDInt, callerID(r))
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed to delete group"}, http.StatusInternalServerError, nil)
 			return
@@ -165,6 +306,30 @@ func (s *Server) handlerDeleteGroup() http.HandlerFunc {
 	}
 }
 
+func (s *Server) handlerRestoreGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only admins can bring back a deleted group
+		if !s.isAdmin(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		err = s.group.RestoreGroup(groupID, callerID(r))
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, http.StatusNotFound, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group restored successfully"}, http.StatusOK, nil)
+	}
+}
+
 func (s *Server) handlerGroupExists() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check for the correct HTTP method
@@ -201,3 +366,164 @@ func (s *Server) handlerGroupExists() http.HandlerFunc {
 		s.respond(w, ResponseMsg{Message: "Group existence check successful", Data: response}, http.StatusOK, nil)
 	}
 }
+
+// groupErrorStatus maps the group lifecycle errors to HTTP status codes
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, groups.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, groups.ErrArchived),
+		errors.Is(err, groups.ErrNotArchived),
+		errors.Is(err, groups.ErrNotClosedOut),
+		errors.Is(err, groups.ErrOutstandingBalances):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) handlerArchiveGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Owners and admins can archive the group
+		if !s.requireRolePermission(w, r, groupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		err = s.group.ArchiveGroup(groupID, callerID(r))
+		if err != nil {
+			s.logger.Error("failed to archive group", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to archive group: " + err.Error()}, groupErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group archived successfully"}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerUnarchiveGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Owners and admins can make the group writable again
+		if !s.requireRolePermission(w, r, groupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		err = s.group.UnarchiveGroup(groupID, callerID(r))
+		if err != nil {
+			s.logger.Error("failed to unarchive group", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to unarchive group: " + err.Error()}, groupErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group unarchived successfully"}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerCloseOutGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Owners and admins can close the group out, again if it is already archived
+		if !s.requireRolePermission(w, r, groupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		// Archive the group and record the transfers that settle it for good
+		closeOut, err := s.group.CloseOutGroup(groupID, callerID(r))
+		if err != nil {
+			s.logger.Error("failed to close out group", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to close out group"}, groupErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group closed out successfully", Data: closeOut}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerPurgeGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Only the owner can permanently delete the group. The members list is
+		// used rather than the role lookup so soft deleted groups can be purged too.
+		if !s.isAdmin(r) {
+			members, err := s.group_members.GetGroupMembersByGroupID(groupID)
+			if err != nil {
+				s.respond(w, ResponseMsg{Message: "Failed to get group members"}, http.StatusInternalServerError, nil)
+				return
+			}
+			isOwner := false
+			for _, member := range members {
+				if member.Active && member.Role == factory.RoleOwner && member.UserID == callerID(r) {
+					isOwner = true
+				}
+			}
+			if !isOwner {
+				s.respond(w, ResponseMsg{Message: "Only the group owner can permanently delete it"}, http.StatusForbidden, nil)
+				return
+			}
+		}
+
+		// Only a closed out group with nothing outstanding can go, unless the
+		// caller forces it, which is recorded in the group's history
+		force := false
+		if value := r.URL.Query().Get("force"); value != "" {
+			if force, err = strconv.ParseBool(value); err != nil {
+				http.Error(w, "Invalid force", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Everything in the group is removed in one transaction; each step is logged
+		steps, err := s.group.PurgeGroup(groupID, callerID(r), force)
+		if err != nil {
+			s.logger.Error("failed to purge group", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to permanently delete group: " + err.Error()}, groupErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group permanently deleted", Data: steps}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handlerGetGroupHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			http.Error(w, "Invalid group_id", http.StatusBadRequest)
+			return
+		}
+
+		// Members can read the history; once the group is purged only admins can
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		logs, err := s.group.GetGroupLogs(groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed to get group history"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Group history fetched successfully", Data: logs}, http.StatusOK, nil)
+	}
+}
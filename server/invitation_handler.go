@@ -0,0 +1,417 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/invitation"
+	"github.com/Abhinav7903/split/pkg/mail"
+	"github.com/spf13/viper"
+)
+
+// invitationErrorStatus maps invitation errors to response statuses
+func invitationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, invitation.ErrInvitationNotFound),
+		errors.Is(err, invitation.ErrJoinRequestNotFound),
+		errors.Is(err, invitation.ErrJoinCodeInvalid):
+		return http.StatusNotFound
+	case errors.Is(err, invitation.ErrInvitationClosed),
+		errors.Is(err, invitation.ErrJoinRequestClosed),
+		errors.Is(err, invitation.ErrAlreadyInvited),
+		errors.Is(err, invitation.ErrAlreadyMember):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// inviteToGroup invites a user, by ID or email, to a group on behalf of the
+// caller and queues the invitation email with it
+func (s *Server) inviteToGroup(r *http.Request, groupID int, userID *int, email *string) (factory.Invitation, error) {
+	ttl := viper.GetDuration("invitation_ttl")
+	inv := factory.Invitation{
+		GroupID:      groupID,
+		InvitedBy:    callerID(r),
+		InviteeID:    userID,
+		InviteeEmail: email,
+		ExpiresAt:    time.Now().UTC().Add(ttl),
+	}
+
+	// Work out who the email goes to
+	var name, to string
+	if userID != nil {
+		invitee, err := s.user.GetUserByID(*userID)
+		if err != nil {
+			return inv, errors.New("user does not exist")
+		}
+		name, to = invitee.Name, invitee.Email
+	}
+	if email != nil {
+		to = *email
+		if invitee, err := s.user.GetUser(*email); err == nil {
+			name = invitee.Name
+		}
+	}
+
+	var messages []factory.OutboxMessage
+	inviter, err := s.user.GetUserByID(inv.InvitedBy)
+	if err != nil {
+		s.logger.Error("failed to get inviter", "user_id", inv.InvitedBy, "error", err)
+	} else if group, err := s.group.GetGroup(groupID, false); err != nil {
+		s.logger.Error("failed to get group", "group_id", groupID, "error", err)
+	} else {
+		message, err := templatedEmail(to, mail.TemplateGroupInvitation, mail.GroupInvitationData{
+			Name:        name,
+			InviterName: inviter.Name,
+			GroupName:   group.GroupName,
+			Link:        viper.GetString("app_url") + "/group-invitations",
+			ExpiresAt:   inv.ExpiresAt,
+		})
+		if err != nil {
+			s.logger.Error("failed to render invitation email", "error", err)
+		} else {
+			messages = append(messages, message)
+		}
+	}
+
+	return s.invitation.CreateInvitation(inv, messages...)
+}
+
+// handleCreateInvitation lets a member invite someone to the group by user ID
+// or email
+func (s *Server) handleCreateInvitation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			GroupID int     `json:"group_id"`
+			UserID  *int    `json:"user_id"`
+			Email   *string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			s.respond(w, ResponseMsg{Message: "Invalid request payload"}, http.StatusBadRequest, nil)
+			return
+		}
+		if body.Email != nil && strings.TrimSpace(*body.Email) == "" {
+			body.Email = nil
+		}
+		if body.GroupID <= 0 || (body.UserID == nil) == (body.Email == nil) {
+			s.respond(w, ResponseMsg{Message: "group_id and exactly one of user_id or email are required"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Only a bare address is accepted, as it ends up in the email's headers
+		if body.Email != nil {
+			email := strings.TrimSpace(*body.Email)
+			address, err := netmail.ParseAddress(email)
+			if err != nil || address.Address != email {
+				s.respond(w, ResponseMsg{Message: "Invalid email address"}, http.StatusBadRequest, nil)
+				return
+			}
+			body.Email = &address.Address
+		}
+
+		// Members can invite, viewers cannot
+		if !s.requireGroupPermission(w, r, body.GroupID, factory.PermissionInviteMembers) {
+			return
+		}
+
+		inv, err := s.inviteToGroup(r, body.GroupID, body.UserID, body.Email)
+		if err != nil {
+			status := invitationErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.Error("failed to create invitation", "group_id", body.GroupID, "error", err)
+				status = http.StatusBadRequest
+			}
+			s.respond(w, ResponseMsg{Message: err.Error()}, status, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Invitation sent successfully", Data: inv}, http.StatusOK, nil)
+	}
+}
+
+// handleGetMyInvitations lists the open invitations addressed to the caller
+func (s *Server) handleGetMyInvitations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitations, err := s.invitation.ListInvitationsForUser(callerID(r), callerEmail(r))
+		if err != nil {
+			s.logger.Error("failed to get invitations", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to get invitations"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Invitations fetched successfully", Data: invitations}, http.StatusOK, nil)
+	}
+}
+
+// handleGetGroupInvitations lists every invitation to a group for its members
+func (s *Server) handleGetGroupInvitations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		invitations, err := s.invitation.ListInvitationsForGroup(groupID)
+		if err != nil {
+			s.logger.Error("failed to get group invitations", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to get invitations"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Invitations fetched successfully", Data: invitations}, http.StatusOK, nil)
+	}
+}
+
+// handleRespondToInvitation accepts or declines an invitation addressed to
+// the caller
+func (s *Server) handleRespondToInvitation(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitationID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || invitationID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid invitation ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !accept {
+			err = s.invitation.DeclineInvitation(invitationID, callerID(r), callerEmail(r))
+			if err != nil {
+				s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+				return
+			}
+			s.respond(w, ResponseMsg{Message: "Invitation declined"}, http.StatusOK, nil)
+			return
+		}
+
+		groupMemberID, err := s.invitation.AcceptInvitation(invitationID, callerID(r), callerEmail(r))
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "Invitation accepted", Data: groupMemberID}, http.StatusOK, nil)
+	}
+}
+
+// handleRevokeInvitation withdraws a pending invitation. The inviter and
+// anyone who manages the group may do this.
+func (s *Server) handleRevokeInvitation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitationID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || invitationID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid invitation ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		inv, err := s.invitation.GetInvitation(invitationID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+		if inv.InvitedBy != callerID(r) && !s.requireGroupPermission(w, r, inv.GroupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		if err := s.invitation.RevokeInvitation(invitationID); err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Invitation revoked"}, http.StatusOK, nil)
+	}
+}
+
+// joinLink is the shareable link for a join code
+func joinLink(code string) string {
+	return viper.GetString("app_url") + "/join?code=" + url.QueryEscape(code)
+}
+
+// handleCreateJoinCode lets owners and admins make a shareable join code
+func (s *Server) handleCreateJoinCode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var code factory.JoinCode
+		if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+			s.respond(w, ResponseMsg{Message: "Invalid request payload"}, http.StatusBadRequest, nil)
+			return
+		}
+		if code.GroupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+		if code.MaxUses != nil && *code.MaxUses <= 0 {
+			s.respond(w, ResponseMsg{Message: "max_uses must be greater than zero"}, http.StatusBadRequest, nil)
+			return
+		}
+		if code.ExpiresAt != nil && !code.ExpiresAt.After(time.Now()) {
+			s.respond(w, ResponseMsg{Message: "expires_at must be in the future"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, code.GroupID, factory.PermissionManageGroup) {
+			return
+		}
+		code.CreatedBy = callerID(r)
+
+		created, err := s.invitation.CreateJoinCode(code)
+		if err != nil {
+			s.logger.Error("failed to create join code", "group_id", code.GroupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to create join code"}, http.StatusInternalServerError, nil)
+			return
+		}
+		created.Link = joinLink(created.Code)
+
+		s.respond(w, ResponseMsg{Message: "Join code created successfully", Data: created}, http.StatusOK, nil)
+	}
+}
+
+// handleGetJoinCodes lists a group's join codes for its owner and admins
+func (s *Server) handleGetJoinCodes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, groupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		codes, err := s.invitation.ListJoinCodes(groupID)
+		if err != nil {
+			s.logger.Error("failed to get join codes", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to get join codes"}, http.StatusInternalServerError, nil)
+			return
+		}
+		for i := range codes {
+			codes[i].Link = joinLink(codes[i].Code)
+		}
+
+		s.respond(w, ResponseMsg{Message: "Join codes fetched successfully", Data: codes}, http.StatusOK, nil)
+	}
+}
+
+// handleRevokeJoinCode stops a join code from being used
+func (s *Server) handleRevokeJoinCode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code, err := s.invitation.GetJoinCode(r.URL.Query().Get("code"))
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, code.GroupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		if err := s.invitation.RevokeJoinCode(code.Code); err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Join code revoked"}, http.StatusOK, nil)
+	}
+}
+
+// handleJoinWithCode joins the caller to a group with a join code, or leaves
+// a request for the owner and admins when the code needs approval
+func (s *Server) handleJoinWithCode() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := strings.TrimSpace(r.URL.Query().Get("code"))
+		if code == "" {
+			s.respond(w, ResponseMsg{Message: "code is required"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		request, err := s.invitation.JoinWithCode(code, callerID(r))
+		if err != nil {
+			status := invitationErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.Error("failed to join with code", "error", err)
+				s.respond(w, ResponseMsg{Message: "Failed to join group"}, status, nil)
+				return
+			}
+			s.respond(w, ResponseMsg{Message: err.Error()}, status, nil)
+			return
+		}
+
+		if request.Status == factory.JoinRequestPending {
+			s.respond(w, ResponseMsg{Message: "Join request sent for approval", Data: request}, http.StatusAccepted, nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "Joined group successfully", Data: request}, http.StatusOK, nil)
+	}
+}
+
+// handleGetJoinRequests lists a group's pending join requests for its owner
+// and admins
+func (s *Server) handleGetJoinRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid group_id"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, groupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		requests, err := s.invitation.ListJoinRequests(groupID)
+		if err != nil {
+			s.logger.Error("failed to get join requests", "group_id", groupID, "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed to get join requests"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Join requests fetched successfully", Data: requests}, http.StatusOK, nil)
+	}
+}
+
+// handleDecideJoinRequest approves or rejects a pending join request
+func (s *Server) handleDecideJoinRequest(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		joinRequestID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || joinRequestID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Invalid join request ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		request, err := s.invitation.GetJoinRequest(joinRequestID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: err.Error()}, invitationErrorStatus(err), nil)
+			return
+		}
+
+		if !s.requireGroupPermission(w, r, request.GroupID, factory.PermissionManageGroup) {
+			return
+		}
+
+		if err := s.invitation.DecideJoinRequest(joinRequestID, approve, callerID(r)); err != nil {
+			status := invitationErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				s.logger.Error("failed to decide join request", "join_request_id", joinRequestID, "error", err)
+				s.respond(w, ResponseMsg{Message: "Failed to decide join request"}, status, nil)
+				return
+			}
+			s.respond(w, ResponseMsg{Message: err.Error()}, status, nil)
+			return
+		}
+
+		if approve {
+			s.respond(w, ResponseMsg{Message: "Join request approved"}, http.StatusOK, nil)
+			return
+		}
+		s.respond(w, ResponseMsg{Message: "Join request rejected"}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Abhinav7903/split/pkg/notification"
+)
+
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// handleGetNotifications lists the caller's notifications, newest first. Pages
+// are selected with limit and offset.
+func (s *Server) handleGetNotifications() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultNotificationLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > maxNotificationLimit {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: "limit must be between 1 and " + strconv.Itoa(maxNotificationLimit)}, http.StatusBadRequest, nil)
+				return
+			}
+			limit = parsed
+		}
+
+		offset := 0
+		if value := r.URL.Query().Get("offset"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid offset"}, http.StatusBadRequest, nil)
+				return
+			}
+			offset = parsed
+		}
+
+		notifications, err := s.notification.GetNotifications(callerID(r), limit, offset)
+		if err != nil {
+			s.logger.Error("Failed to get notifications", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Failed to get notifications"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: notifications}, http.StatusOK, nil)
+	}
+}
+
+// handleMarkNotificationRead marks one of the caller's notifications as read
+func (s *Server) handleMarkNotificationRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notificationID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || notificationID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid notification ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		err = s.notification.MarkNotificationRead(callerID(r), notificationID)
+		if errors.Is(err, notification.ErrNotificationNotFound) {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Notification not found"}, http.StatusNotFound, nil)
+			return
+		}
+		if err != nil {
+			s.logger.Error("Failed to mark notification as read", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Failed to mark notification as read"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success"}, http.StatusOK, nil)
+	}
+}
+
+// handleMarkAllNotificationsRead marks every unread notification of the caller
+// as read and returns how many there were
+func (s *Server) handleMarkAllNotificationsRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		marked, err := s.notification.MarkAllNotificationsRead(callerID(r))
+		if err != nil {
+			s.logger.Error("Failed to mark notifications as read", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Failed to mark notifications as read"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: marked}, http.StatusOK, nil)
+	}
+}
+
+// handleGetUnreadNotificationCount returns how many unread notifications the
+// caller has
+func (s *Server) handleGetUnreadNotificationCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		count, err := s.notification.GetUnreadNotificationCount(callerID(r))
+		if err != nil {
+			s.logger.Error("Failed to count unread notifications", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Failed to count unread notifications"}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: count}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+)
+
+// parsePageRequest reads the paging query parameters shared by list
+// endpoints: limit, cursor, sort, order, created_from and created_to. Dates
+// may be given as 2006-01-02 or RFC 3339; a plain date in created_to includes
+// that whole day.
+func parsePageRequest(r *http.Request) (factory.PageRequest, error) {
+	query := r.URL.Query()
+	page := factory.PageRequest{
+		Cursor: query.Get("cursor"),
+		SortBy: query.Get("sort"),
+		Order:  query.Get("order"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > factory.MaxPageLimit {
+			return page, fmt.Errorf("limit must be between 1 and %d", factory.MaxPageLimit)
+		}
+		page.Limit = limit
+	}
+
+	if value := query.Get("created_from"); value != "" {
+		from, _, err := parsePageTime(value)
+		if err != nil {
+			return page, fmt.Errorf("invalid created_from: %w", err)
+		}
+		page.CreatedFrom = &from
+	}
+	if value := query.Get("created_to"); value != "" {
+		to, dateOnly, err := parsePageTime(value)
+		if err != nil {
+			return page, fmt.Errorf("invalid created_to: %w", err)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		page.CreatedTo = &to
+	}
+
+	return page, nil
+}
+
+// parsePageTime parses a date or an RFC 3339 time into UTC, reporting whether
+// only a date was given
+func parsePageTime(value string) (time.Time, bool, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, errors.New("use YYYY-MM-DD or an RFC 3339 time")
+	}
+	return t.UTC(), false, nil
+}
+
+// pageErrorStatus is the status for an error from a paged list: bad paging
+// input is the client's fault, anything else is ours
+func pageErrorStatus(err error) int {
+	if errors.Is(err, factory.ErrInvalidPage) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -19,6 +19,9 @@ func (s *Server) handleCreatePaymentMethod() http.HandlerFunc {
 			return
 		}
 
+		// Payment methods always belong to the caller
+		paymentMethod.Email = callerEmail(r)
+
 		s.logger.Info("Attempting to create payment method for email: %s", paymentMethod.Email)
 
 		// Create the payment method in the database
@@ -38,11 +41,11 @@ func (s *Server) handleCreatePaymentMethod() http.HandlerFunc {
 // handleGetPaymentMethods handles retrieving payment methods for a user
 func (s *Server) handleGetPaymentMethods() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Extract email from query parameters
-		email := r.URL.Query().Get("email")
+		// Only the caller's own payment methods are listed
+		email := callerEmail(r)
 		if email == "" {
-			s.logger.Error("email parameter is missing")
-			s.respond(w, ResponseMsg{Message: "failed", Data: "email parameter is required"}, http.StatusBadRequest, nil)
+			s.logger.Error("caller has no email")
+			s.respond(w, ResponseMsg{Message: "failed", Data: "email is required"}, http.StatusBadRequest, nil)
 			return
 		}
 
@@ -71,6 +74,7 @@ func (s *Server) handleUpdatePaymentMethod() http.HandlerFunc {
 			s.respond(w, ResponseMsg{Message: "failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
 		}
+		paymentMethod.Email = callerEmail(r)
 
 		// Validate the payment method data (only email and payment_type are required)
 		if paymentMethod.Email == "" {
@@ -104,7 +108,6 @@ func (s *Server) handleDeletePaymentMethod() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Struct to capture incoming request data
 		var request struct {
-			Email       string `json:"email"`
 			PaymentType string `json:"payment_type"`
 		}
 
@@ -114,23 +117,24 @@ func (s *Server) handleDeletePaymentMethod() http.HandlerFunc {
 			s.respond(w, ResponseMsg{Message: "failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
 		}
+		email := callerEmail(r)
 
 		// Validate the inputs
-		if request.Email == "" || request.PaymentType == "" {
+		if email == "" || request.PaymentType == "" {
 			s.logger.Error("validation error: email or payment_type is invalid")
 			s.respond(w, ResponseMsg{Message: "failed", Data: "Invalid email or payment_type"}, http.StatusBadRequest, nil)
 			return
 		}
 
 		// Call the method to delete the payment method
-		if err := s.payment.DeletePaymentMethod(request.PaymentType, request.Email); err != nil {
+		if err := s.payment.DeletePaymentMethod(request.PaymentType, email); err != nil {
 			s.logger.Error("error deleting payment method: %v", err)
 			s.respond(w, ResponseMsg{Message: "failed", Data: err.Error()}, http.StatusInternalServerError, nil)
 			return
 		}
 
 		// Respond with success
-		s.logger.Info("payment method deleted successfully for email:", "email=%s", request.Email)
+		s.logger.Info("payment method deleted successfully for email:", "email=%s", email)
 		s.respond(w, ResponseMsg{Message: "success", Data: "Payment method deleted successfully"}, http.StatusOK, nil)
 	}
 }
@@ -0,0 +1,30 @@
+package server
+
+import "time"
+
+// runBalanceReconciler compares the stored balances with the ledger every
+// interval and logs each discrepancy it finds.
+func (s *Server) runBalanceReconciler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		discrepancies, err := s.balance.ReconcileBalances()
+		if err != nil {
+			s.logger.Error("failed to reconcile balances", "error", err)
+			continue
+		}
+
+		for _, discrepancy := range discrepancies {
+			s.logger.Warn("balance does not match ledger",
+				"user_id", discrepancy.UserID,
+				"group_id", discrepancy.GroupID,
+				"stored_owed_amount", discrepancy.StoredOwedAmount,
+				"stored_lent_amount", discrepancy.StoredLentAmount,
+				"ledger_owed_amount", discrepancy.LedgerOwedAmount,
+				"ledger_lent_amount", discrepancy.LedgerLentAmount,
+			)
+		}
+		s.logger.Info("balance reconciliation finished", "discrepancies", len(discrepancies))
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/recurring"
+)
+
+// handleCreateRecurringExpense stores an expense that the scheduler posts
+// again on every occurrence of its schedule.
+func (s *Server) handleCreateRecurringExpense() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var template factory.RecurringExpense
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// The caller is the one who pays each time
+		template.PayerID = callerID(r)
+		template.CreatedBy = callerID(r)
+
+		// Schedules run to the second, in UTC
+		template.StartAt = template.StartAt.UTC().Truncate(time.Second)
+		if template.EndAt != nil {
+			endAt := template.EndAt.UTC().Truncate(time.Second)
+			template.EndAt = &endAt
+		}
+
+		// The shares are worked out once and reused for every posting
+		if err := splitParticipants(template.Amount, template.SplitMode, template.Participants); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if err := template.Validate(); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		schedule, err := recurring.ScheduleOf(template)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+		// A start_at in the past keeps the schedule's alignment but does not
+		// back-post the occurrences that already went by
+		from := time.Now().UTC()
+		if from.Before(template.StartAt) {
+			from = template.StartAt
+		}
+		template.NextRunAt = recurring.FirstRun(schedule, template, from)
+		if template.NextRunAt == nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "The schedule has no occurrences left before end_at"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Viewers cannot add expenses to a group
+		if !s.requireGroupPermission(w, r, template.GroupID, factory.PermissionAddExpenses) {
+			return
+		}
+
+		if _, err := s.recurring.CreateRecurringExpense(&template); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: template}, http.StatusCreated, nil)
+	}
+}
+
+// handleGetRecurringExpenses lists a group's recurring expenses.
+func (s *Server) handleGetRecurringExpenses() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid group ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		templates, err := s.recurring.ListRecurringExpenses(groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: templates}, http.StatusOK, nil)
+	}
+}
+
+// handleGetRecurringOccurrences lists what a recurring expense has posted.
+func (s *Server) handleGetRecurringOccurrences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		template, ok := s.loadRecurringExpense(w, r)
+		if !ok || !s.requireGroupMember(w, r, template.GroupID) {
+			return
+		}
+
+		occurrences, err := s.recurring.GetOccurrences(template.RecurringExpenseID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: occurrences}, http.StatusOK, nil)
+	}
+}
+
+// handleSetRecurringExpensePaused pauses a recurring expense, or resumes it
+// from its next occurrence after now. Occurrences missed while it was paused
+// are not posted.
+func (s *Server) handleSetRecurringExpensePaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		template, ok := s.loadRecurringExpense(w, r)
+		if !ok || !s.requireRecurringExpenseOwner(w, r, template) {
+			return
+		}
+
+		var nextRunAt *time.Time
+		if !paused {
+			schedule, err := recurring.ScheduleOf(*template)
+			if err != nil {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+				return
+			}
+			from := time.Now().UTC()
+			if from.Before(template.StartAt) {
+				from = template.StartAt
+			}
+			nextRunAt = recurring.FirstRun(schedule, *template, from)
+		}
+
+		err := s.recurring.SetRecurringExpensePaused(template.RecurringExpenseID, paused, nextRunAt)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, recurringErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success"}, http.StatusOK, nil)
+	}
+}
+
+// handleDeleteRecurringExpense stops a recurring expense for good. Expenses it
+// already posted are kept.
+func (s *Server) handleDeleteRecurringExpense() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		template, ok := s.loadRecurringExpense(w, r)
+		if !ok || !s.requireRecurringExpenseOwner(w, r, template) {
+			return
+		}
+
+		if err := s.recurring.DeleteRecurringExpense(template.RecurringExpenseID); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, recurringErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success"}, http.StatusOK, nil)
+	}
+}
+
+// loadRecurringExpense reads the id query parameter and loads the recurring
+// expense, writing the error response when it cannot.
+func (s *Server) loadRecurringExpense(w http.ResponseWriter, r *http.Request) (*factory.RecurringExpense, bool) {
+	recurringExpenseID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || recurringExpenseID <= 0 {
+		s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid recurring expense ID"}, http.StatusBadRequest, nil)
+		return nil, false
+	}
+
+	template, err := s.recurring.GetRecurringExpense(recurringExpenseID)
+	if err != nil {
+		s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, recurringErrorStatus(err), nil)
+		return nil, false
+	}
+	return template, true
+}
+
+// requireRecurringExpenseOwner allows whoever created the recurring expense and
+// members who may edit the group's expenses to change or stop it, unless the
+// group is archived.
+func (s *Server) requireRecurringExpenseOwner(w http.ResponseWriter, r *http.Request, template *factory.RecurringExpense) bool {
+	if template.CreatedBy == callerID(r) {
+		return s.requireGroupWritable(w, r, template.GroupID)
+	}
+	return s.requireGroupPermission(w, r, template.GroupID, factory.PermissionEditExpenses)
+}
+
+// recurringErrorStatus maps recurring expense errors to HTTP status codes
+func recurringErrorStatus(err error) int {
+	if errors.Is(err, recurring.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
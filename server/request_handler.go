@@ -6,11 +6,24 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
-	"sync"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/mail"
 )
 
+// requestParties looks up the sender and receiver of a request
+func (s *Server) requestParties(request factory.Request) (factory.User, factory.User, error) {
+	sender, err := s.user.GetUserByID(request.SenderID)
+	if err != nil {
+		return factory.User{}, factory.User{}, fmt.Errorf("failed to get sender details: %w", err)
+	}
+	receiver, err := s.user.GetUserByID(request.ReceiverID)
+	if err != nil {
+		return factory.User{}, factory.User{}, fmt.Errorf("failed to get receiver details: %w", err)
+	}
+	return sender, receiver, nil
+}
+
 func (s *Server) handleAddRequest() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request factory.Request
@@ -21,43 +34,43 @@ func (s *Server) handleAddRequest() http.HandlerFunc {
 			return
 		}
 
+		// The caller is the one asking for money
+		request.SenderID = callerID(r)
+
 		if request.Amount <= 0 || request.SenderID == 0 || request.ReceiverID == 0 {
 			s.logger.Error("Invalid request", "request", request)
 			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid request"}, http.StatusBadRequest, nil)
 			return
 		}
 
-		err := s.request.AddRequest(request)
-		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+		// Requests within a group can only be made by its members
+		if request.GroupID != nil && !s.requireGroupMember(w, r, *request.GroupID) {
 			return
 		}
-		var wg sync.WaitGroup
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			//get the sender and receiver details
-			sender, err := s.user.GetUserByID(request.SenderID)
-			if err != nil {
-				slog.Error("Failed to get sender details", "error", err)
-				return
-			}
-			receiver, err := s.user.GetUserByID(request.ReceiverID)
-			if err != nil {
-				slog.Error("Failed to get receiver details", "error", err)
-				return
-			}
 
-			//send notification to the receiver
-			mailErr := s.mail.SendMail(receiver.Email, "Request Received", fmt.Sprintf("You have received a request from %s for an amount of %.2f", sender.Name, request.Amount))
-			if mailErr != nil {
-				slog.Error("Failed to send mail", "error", mailErr)
-				return
+		// Queue a notification for the receiver with the request itself
+		var messages []factory.OutboxMessage
+		sender, receiver, err := s.requestParties(request)
+		if err != nil {
+			s.logger.Error("Failed to get request parties", "error", err)
+		} else {
+			message, err := templatedEmail(receiver.Email, mail.TemplatePaymentRequest, mail.PaymentRequestData{
+				SenderName:   sender.Name,
+				ReceiverName: receiver.Name,
+				Amount:       request.Amount,
+			})
+			if err != nil {
+				s.logger.Error("Failed to render request email", "error", err)
+			} else {
+				messages = append(messages, message)
 			}
+		}
 
-			slog.Info("Notification sent successfully", "receiver", receiver.Email)
-		}()
-		wg.Wait()
+		err = s.request.AddRequest(request, messages...)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
 
 		s.respond(w, ResponseMsg{Message: "Success", Data: "Request added successfully"}, http.StatusOK, nil)
 	}
@@ -79,6 +92,10 @@ func (s *Server) handleDeleteRequest() http.HandlerFunc {
 			return
 		}
 
+		if !s.requireRequestParty(w, r, request.RequestID) {
+			return
+		}
+
 		err := s.request.DeleteRequest(request.RequestID)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
@@ -111,36 +128,28 @@ func (s *Server) handleUpdateRequest() http.HandlerFunc {
 			return
 		}
 
-		err := s.request.UpdateRequestStatus(request.RequestID, request.Status)
-		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+		if !s.requireRequestParty(w, r, request.RequestID) {
 			return
 		}
-		var wg sync.WaitGroup
-		wg.Add(1)
 
-		go func() {
-			defer wg.Done()
-			//get the sender and receiver details
-			sender, err := s.user.GetUserByID(request.SenderID)
-			if err != nil {
-				slog.Error("Failed to get sender details", "error", err)
-				return
-			}
-			receiver, err := s.user.GetUserByID(request.ReceiverID)
-			if err != nil {
-				slog.Error("Failed to get receiver details", "error", err)
-				return
-			}
+		// Queue a notification for the sender with the status change
+		var messages []factory.OutboxMessage
+		sender, receiver, err := s.requestParties(request)
+		if err != nil {
+			s.logger.Error("Failed to get request parties", "error", err)
+		} else {
+			messages = append(messages, factory.OutboxMessage{
+				Recipient: sender.Email,
+				Subject:   "Request Updated",
+				Body:      fmt.Sprintf("Your request to %s for an amount of %s has been %s", receiver.Name, request.Amount, request.Status),
+			})
+		}
 
-			//send notification to the sender
-			mailErr := s.mail.SendMail(sender.Email, "Request Updated", fmt.Sprintf("Your request to %s for an amount of %.2f has been %s", receiver.Name, request.Amount, request.Status))
-			if mailErr != nil {
-				slog.Error("Failed to send mail", "error", mailErr)
-				return
-			}
-		}()
-		wg.Wait()
+		err = s.request.UpdateRequestStatus(request.RequestID, request.Status, messages...)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
 
 		s.respond(w, ResponseMsg{Message: "Success", Data: "Request updated successfully"}, http.StatusOK, nil)
 	}
@@ -161,7 +170,17 @@ func (s *Server) handleGetRequestsByReceiverID() http.HandlerFunc {
 			return
 		}
 
-		requests, err := s.request.GetRequestsByReceiverID(receiverIDInt)
+		if !s.requireSelf(w, r, receiverIDInt) {
+			return
+		}
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		requests, err := s.request.GetRequestsByReceiverID(receiverIDInt, page)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
@@ -186,7 +205,17 @@ func (s *Server) handleGetRequestsBySenderID() http.HandlerFunc {
 			return
 		}
 
-		requests, err := s.request.GetRequestsBySenderID(senderIDInt)
+		if !s.requireSelf(w, r, senderIDInt) {
+			return
+		}
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		requests, err := s.request.GetRequestsBySenderID(senderIDInt, page)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
@@ -211,7 +240,17 @@ func (s *Server) handleGetRequestsByGroupID() http.HandlerFunc {
 			return
 		}
 
-		requests, err := s.request.GetRequestsByGroupID(groupIDInt)
+		if !s.requireGroupMember(w, r, groupIDInt) {
+			return
+		}
+
+		page, err := parsePageRequest(r)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		requests, err := s.request.GetRequestsByGroupID(groupIDInt, page)
 		if err != nil {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
@@ -242,6 +281,18 @@ func (s *Server) handleGetRequestByID() http.HandlerFunc {
 			return
 		}
 
+		// The sender, the receiver and members of the request's group can see it
+		caller := callerID(r)
+		if request.SenderID != caller && request.ReceiverID != caller {
+			if request.GroupID == nil {
+				if !s.requireSelf(w, r, request.SenderID) {
+					return
+				}
+			} else if !s.requireGroupMember(w, r, *request.GroupID) {
+				return
+			}
+		}
+
 		s.respond(w, ResponseMsg{Message: "Success", Data: request}, http.StatusOK, nil)
 	}
 }
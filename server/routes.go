@@ -3,6 +3,9 @@ package server
 import "net/http"
 
 func (s *Server) RegisterRoutes() {
+	// Every route other than the public ones needs a valid bearer token
+	s.router.Use(s.authenticate)
+
 	s.router.HandleFunc("/ping", s.HandlePong()).Methods(http.MethodGet)
 
 	s.router.HandleFunc(
@@ -15,6 +18,36 @@ func (s *Server) RegisterRoutes() {
 		(s.handleVerify()),
 	).Methods(http.MethodGet, http.MethodOptions)
 
+	s.router.HandleFunc(
+		"/resend-verification",
+		(s.handleResendVerification()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/login",
+		(s.handleLogin()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/refresh",
+		(s.handleRefresh()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/logout",
+		(s.handleLogout()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/forgot-password",
+		(s.handleForgotPassword()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/reset-password",
+		(s.handleResetPassword()),
+	).Methods(http.MethodPost, http.MethodOptions)
+
 	s.router.HandleFunc(
 		"/getuser",
 		(s.handleGetUser()),
@@ -35,6 +68,11 @@ func (s *Server) RegisterRoutes() {
 		(s.handleGetAllUsers()),
 	).Methods(http.MethodGet, http.MethodOptions)
 
+	s.router.HandleFunc(
+		"/restore-user",
+		s.handleRestoreUser(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
 	s.router.HandleFunc(
 		"/email-exists",
 		(s.EmailExists()),
@@ -52,6 +90,18 @@ func (s *Server) RegisterRoutes() {
 		s.handlerGetGroup(),
 	).Methods(http.MethodGet, http.MethodOptions)
 
+	// Get the suggested transfers that settle a group
+	s.router.HandleFunc(
+		"/get-group-settle-up",
+		s.handlerGetGroupSettleUp(),
+	).Methods(http.MethodGet, http.MethodOptions)
+
+	// Get a group's totals per currency and converted to its default currency
+	s.router.HandleFunc(
+		"/group-totals",
+		s.handlerGetGroupTotals(),
+	).Methods(http.MethodGet, http.MethodOptions)
+
 	// Get all groups
 	s.router.HandleFunc(
 		"/get-all-groups",
@@ -70,6 +120,41 @@ func (s *Server) RegisterRoutes() {
 		s.handlerDeleteGroup(),
 	).Methods(http.MethodDelete, http.MethodOptions)
 
+	// Restore a deleted group
+	s.router.HandleFunc(
+		"/restore-group",
+		s.handlerRestoreGroup(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	// Make a group read-only, or writable again
+	s.router.HandleFunc(
+		"/archive-group",
+		s.handlerArchiveGroup(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	s.router.HandleFunc(
+		"/unarchive-group",
+		s.handlerUnarchiveGroup(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	// Archive a group and record its final settle-up plan
+	s.router.HandleFunc(
+		"/close-out-group",
+		s.handlerCloseOutGroup(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	// Permanently delete a group and everything in it (owner only)
+	s.router.HandleFunc(
+		"/purge-group",
+		s.handlerPurgeGroup(),
+	).Methods(http.MethodDelete, http.MethodOptions)
+
+	// Get a group's lifecycle history
+	s.router.HandleFunc(
+		"/group-history",
+		s.handlerGetGroupHistory(),
+	).Methods(http.MethodGet, http.MethodOptions)
+
 	// Check if a group exists
 	s.router.HandleFunc(
 		"/group-exists",
@@ -94,7 +179,7 @@ func (s *Server) RegisterRoutes() {
 		s.handleGetGroupMembersByGroupID(),
 	).Methods(http.MethodGet, http.MethodOptions)
 
-	//remove group member by creator
+	//remove group member by an owner or admin
 	s.router.HandleFunc(
 		"/remove-group-member",
 		s.handleRemoveUserFromGroupByCreator(),
@@ -106,12 +191,28 @@ func (s *Server) RegisterRoutes() {
 		s.handleRemoveUserSelfFromGroup(),
 	).Methods(http.MethodDelete, http.MethodOptions)
 
+	// Member roles
+	s.router.HandleFunc("/group-role", s.handleGetMyGroupRole()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/group-member-role", s.handleSetGroupMemberRole()).Methods(http.MethodPut, http.MethodOptions)
+	s.router.HandleFunc("/transfer-group-ownership", s.handleTransferGroupOwnership()).Methods(http.MethodPost, http.MethodOptions)
+
+	// Leaving a group and handing the balances to another member
+	s.router.HandleFunc("/leave-requests", s.handleGetLeaveRequests()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/leave-requests/approve", s.handleDecideLeaveRequest(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/leave-requests/reject", s.handleDecideLeaveRequest(false)).Methods(http.MethodPost, http.MethodOptions)
+
 	// Create transaction
 	s.router.HandleFunc(
 		"/create-transaction",
 		s.handleCreateTransaction(),
 	).Methods(http.MethodPost, http.MethodOptions)
 
+	// Add expense (transaction, splits and balances in one step)
+	s.router.HandleFunc(
+		"/add-expense",
+		s.handleAddExpense(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
 	// Get transaction by ID
 	s.router.HandleFunc(
 		"/get-transaction",
@@ -142,6 +243,18 @@ func (s *Server) RegisterRoutes() {
 		s.handleDeleteTransaction(),
 	).Methods(http.MethodDelete, http.MethodOptions)
 
+	// Restore a deleted transaction
+	s.router.HandleFunc(
+		"/restore-transaction",
+		s.handleRestoreTransaction(),
+	).Methods(http.MethodPost, http.MethodOptions)
+
+	// Transaction history
+	s.router.HandleFunc(
+		"/transaction-history",
+		s.handleGetTransactionHistory(),
+	).Methods(http.MethodGet, http.MethodOptions)
+
 	// Search transactions
 	s.router.HandleFunc(
 		"/search-transactions",
@@ -183,6 +296,13 @@ func (s *Server) RegisterRoutes() {
 	s.router.HandleFunc("/balance", s.handlerGetBalanceByID()).Methods(http.MethodGet, http.MethodOptions)
 	s.router.HandleFunc("/balance", s.handlerUpdateBalance()).Methods(http.MethodPut, http.MethodOptions)
 	s.router.HandleFunc("/balance", s.handlerDeleteBalance()).Methods(http.MethodDelete, http.MethodOptions)
+	s.router.HandleFunc("/balance-adjustments", s.handlerGetBalanceAdjustments()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/balance-reconcile", s.handlerReconcileBalances()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Balances computed from the ledger
+	s.router.HandleFunc("/user-net-balances", s.handlerGetUserNetBalances()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/group-net-balances", s.handlerGetGroupNetBalances()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/pairwise-balance", s.handlerGetPairwiseBalance()).Methods(http.MethodGet, http.MethodOptions)
 
 	//Request routes
 	s.router.HandleFunc("/request", s.handleAddRequest()).Methods(http.MethodPost, http.MethodOptions)
@@ -193,6 +313,41 @@ func (s *Server) RegisterRoutes() {
 	s.router.HandleFunc("/requests-by-sender", s.handleGetRequestsBySenderID()).Methods(http.MethodGet, http.MethodOptions)
 	s.router.HandleFunc("/requests-by-group", s.handleGetRequestsByGroupID()).Methods(http.MethodGet, http.MethodOptions)
 
+	//Settlement routes
+	s.router.HandleFunc("/settlement", s.handleRecordSettlement()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/settlements-by-user", s.handleGetSettlementsByUserID()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/settlements-by-group", s.handleGetSettlementsByGroupID()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/settlements-between", s.handleGetSettlementsBetweenUsers()).Methods(http.MethodGet, http.MethodOptions)
+
+	//Notification routes
+	s.router.HandleFunc("/notifications", s.handleGetNotifications()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/notifications/read", s.handleMarkNotificationRead()).Methods(http.MethodPut, http.MethodOptions)
+	s.router.HandleFunc("/notifications/read-all", s.handleMarkAllNotificationsRead()).Methods(http.MethodPut, http.MethodOptions)
+	s.router.HandleFunc("/notifications/unread-count", s.handleGetUnreadNotificationCount()).Methods(http.MethodGet, http.MethodOptions)
+
+	// Invitation and join code routes
+	s.router.HandleFunc("/group-invitations", s.handleCreateInvitation()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/group-invitations", s.handleGetMyInvitations()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/group-invitations", s.handleRevokeInvitation()).Methods(http.MethodDelete, http.MethodOptions)
+	s.router.HandleFunc("/group-invitations/sent", s.handleGetGroupInvitations()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/group-invitations/accept", s.handleRespondToInvitation(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/group-invitations/decline", s.handleRespondToInvitation(false)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/join-codes", s.handleCreateJoinCode()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/join-codes", s.handleGetJoinCodes()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/join-codes", s.handleRevokeJoinCode()).Methods(http.MethodDelete, http.MethodOptions)
+	s.router.HandleFunc("/join", s.handleJoinWithCode()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/join-requests", s.handleGetJoinRequests()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/join-requests/approve", s.handleDecideJoinRequest(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/join-requests/reject", s.handleDecideJoinRequest(false)).Methods(http.MethodPost, http.MethodOptions)
+
+	// Recurring expense routes
+	s.router.HandleFunc("/recurring-expenses", s.handleCreateRecurringExpense()).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/recurring-expenses", s.handleGetRecurringExpenses()).Methods(http.MethodGet, http.MethodOptions)
+	s.router.HandleFunc("/recurring-expenses", s.handleDeleteRecurringExpense()).Methods(http.MethodDelete, http.MethodOptions)
+	s.router.HandleFunc("/recurring-expenses/pause", s.handleSetRecurringExpensePaused(true)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/recurring-expenses/resume", s.handleSetRecurringExpensePaused(false)).Methods(http.MethodPost, http.MethodOptions)
+	s.router.HandleFunc("/recurring-expenses/occurrences", s.handleGetRecurringOccurrences()).Methods(http.MethodGet, http.MethodOptions)
+
 }
 func (s *Server) HandlePong() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1,19 +1,28 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 
 	"github.com/Abhinav7903/split/db/postgres"
 	"github.com/Abhinav7903/split/db/redis"
+	"github.com/Abhinav7903/split/factory"
 	"github.com/Abhinav7903/split/pkg/balance"
+	"github.com/Abhinav7903/split/pkg/exchange"
 	"github.com/Abhinav7903/split/pkg/groupmember"
 	"github.com/Abhinav7903/split/pkg/groups"
+	"github.com/Abhinav7903/split/pkg/invitation"
 	"github.com/Abhinav7903/split/pkg/mail"
+	"github.com/Abhinav7903/split/pkg/notification"
+	"github.com/Abhinav7903/split/pkg/outbox"
 	"github.com/Abhinav7903/split/pkg/payment"
+	"github.com/Abhinav7903/split/pkg/recurring"
 	"github.com/Abhinav7903/split/pkg/request"
 	"github.com/Abhinav7903/split/pkg/sessmanager"
+	"github.com/Abhinav7903/split/pkg/settlement"
 	"github.com/Abhinav7903/split/pkg/transaction"
 	transactionsplit "github.com/Abhinav7903/split/pkg/transaction_split"
 	"github.com/Abhinav7903/split/pkg/users"
@@ -29,13 +38,20 @@ type Server struct {
 	user             users.Repository
 	sessmanager      sessmanager.Repository
 	mail             mail.Repository
+	outbox           outbox.Repository
 	group            groups.Repository
 	group_members    groupmember.Repository
+	invitation       invitation.Repository
 	transaction      transaction.Repository
 	transactionsplit transactionsplit.Repository
 	payment          payment.Repository
 	balance          balance.Repository
 	request          request.Repository
+	settlement       settlement.Repository
+	notification     notification.Repository
+	recurring        recurring.Repository
+	exchange         exchange.Provider
+	firebase         *users.FirebaseVerifier
 }
 
 type ResponseMsg struct {
@@ -71,6 +87,14 @@ func Run(envType *string) {
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
+	// Tokens are signed with jwt_secret, which is never committed; it can come
+	// from the JWT_SECRET environment variable instead of the config file
+	viper.BindEnv("jwt_secret", "JWT_SECRET")
+	if len(viper.GetString("jwt_secret")) < users.MinJWTSecretLength {
+		logger.Error("jwt_secret is missing or too short", "min_length", users.MinJWTSecretLength)
+		return
+	}
+
 	// db
 	postgres := postgres.NewPostgres()
 	redis := redis.NewRedis(envType)
@@ -80,21 +104,103 @@ func Run(envType *string) {
 		logger:      logger,
 		user:        postgres,
 		sessmanager: redis,
-		mail: mail.NewMail(
-			viper.GetString("mail_id"),
-			viper.GetString("mail_pass"),
-			viper.GetString("app_pass"),
-		),
 		group:            postgres,
 		group_members:    postgres,
+		invitation:       postgres,
 		transaction:      postgres,
 		transactionsplit: postgres,
 		payment:          postgres,
 		balance:          postgres,
 		request:          postgres,
+		settlement:       postgres,
+		outbox:           postgres,
+		notification:     postgres,
+		recurring:        postgres,
+	}
+
+	// Session lifetimes and login lockout
+	viper.SetDefault("access_token_ttl", "15m")
+	viper.SetDefault("refresh_token_ttl", "720h")
+	viper.SetDefault("max_login_attempts", 5)
+	viper.SetDefault("lockout_duration", "15m")
+
+	// Email verification links and how often they can be resent
+	viper.SetDefault("verification_token_ttl", "24h")
+	viper.SetDefault("verification_resend_limit", 3)
+	viper.SetDefault("verification_resend_window", "1h")
+
+	// How often a password reset link can be asked for
+	viper.SetDefault("password_reset_limit", 3)
+	viper.SetDefault("password_reset_window", "1h")
+
+	// How email leaves the server
+	viper.SetDefault("mail_transport", "smtp")
+	viper.SetDefault("smtp_host", "smtp.gmail.com")
+	viper.SetDefault("smtp_port", 587)
+	viper.SetDefault("smtp_tls", mail.TLSStartTLS)
+	viper.SetDefault("mail_dir", "mail")
+	transport, err := newMailTransport()
+	if err != nil {
+		slog.Error("Error configuring mail", "error", err)
+		return
+	}
+	server.mail = mail.NewMail(viper.GetString("mail_id"), transport)
+
+	// How many times a failed transaction may be retried
+	viper.SetDefault("max_transaction_retries", 3)
+
+	// Base URL used in links sent by email
+	viper.SetDefault("app_url", "http://localhost:8080")
+
+	// How long a group invitation stays open
+	viper.SetDefault("invitation_ttl", "168h")
+
+	// Exchange rates for showing group totals in the group's currency
+	if path := viper.GetString("exchange_rates_file"); path != "" {
+		rates, err := exchange.LoadFile(path)
+		if err != nil {
+			slog.Error("Error loading exchange rates", "error", err)
+			return
+		}
+		server.exchange = rates
+	} else {
+		server.exchange, _ = exchange.NewStatic(factory.DefaultCurrency, nil)
+	}
+
+	// Firebase ID tokens are only accepted once a project is configured
+	if projectID := viper.GetString("firebase_project_id"); projectID != "" {
+		server.firebase = users.NewFirebaseVerifier(projectID)
 	}
 
 	server.RegisterRoutes()
+
+	// Periodically check the stored balances against the ledger
+	viper.SetDefault("reconcile_interval", "1h")
+	if interval := viper.GetDuration("reconcile_interval"); interval > 0 {
+		go server.runBalanceReconciler(interval)
+	}
+
+	// Send queued emails in the background, retrying failures with backoff
+	viper.SetDefault("outbox_interval", "10s")
+	viper.SetDefault("outbox_max_attempts", 8)
+	viper.SetDefault("outbox_backoff", "30s")
+	worker := outbox.NewWorker(
+		server.outbox,
+		server.mail,
+		logger,
+		viper.GetDuration("outbox_interval"),
+		viper.GetInt("outbox_max_attempts"),
+		viper.GetDuration("outbox_backoff"),
+	)
+	go worker.Run(context.Background())
+
+	// Post recurring expenses as they fall due
+	viper.SetDefault("recurring_interval", "1m")
+	if interval := viper.GetDuration("recurring_interval"); interval > 0 {
+		scheduler := recurring.NewScheduler(server.recurring, logger, interval)
+		go scheduler.Run(context.Background())
+	}
+
 	port := ":8080"
 	if *envType != "dev" {
 		port = ":8194"
@@ -107,6 +213,31 @@ func Run(envType *string) {
 
 }
 
+// newMailTransport builds the transport named by mail_transport. The SMTP
+// password is the app password when one is set.
+func newMailTransport() (mail.Transport, error) {
+	switch viper.GetString("mail_transport") {
+	case "smtp":
+		password := viper.GetString("app_pass")
+		if password == "" {
+			password = viper.GetString("mail_pass")
+		}
+		return mail.NewSMTPTransport(
+			viper.GetString("smtp_host"),
+			viper.GetInt("smtp_port"),
+			viper.GetString("mail_id"),
+			password,
+			viper.GetString("smtp_tls"),
+		), nil
+	case "file":
+		return mail.NewFileTransport(viper.GetString("mail_dir")), nil
+	case "memory":
+		return mail.NewMemoryTransport(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail_transport %q", viper.GetString("mail_transport"))
+	}
+}
+
 func (s *Server) respond(
 	w http.ResponseWriter,
 	data interface{},
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/sessmanager"
+	"github.com/Abhinav7903/split/pkg/users"
+	"github.com/spf13/viper"
+)
+
+// minPasswordLength is the shortest password accepted on sign up
+const minPasswordLength = 8
+
+// issueTokens creates a short-lived access token and pairs it with the given
+// refresh token.
+func (s *Server) issueTokens(userID int, email, refreshToken string) (factory.AuthTokens, error) {
+	expiresAt := time.Now().Add(viper.GetDuration("access_token_ttl"))
+	accessToken, err := users.CreateToken(userID, email, expiresAt)
+	if err != nil {
+		return factory.AuthTokens{}, err
+	}
+
+	return factory.AuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (s *Server) handleLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("login request")
+		var credentials struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil || credentials.Email == "" || credentials.Password == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("email and password are required"))
+			return
+		}
+
+		// Refuse locked accounts before looking at the password
+		attempt, err := s.sessmanager.GetLoginAttempt(credentials.Email)
+		if err != nil {
+			s.logger.Error("failed to get login attempts", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("login failed"))
+			return
+		}
+		if attempt.Locked(time.Now()) {
+			retryAfter := int(time.Until(attempt.LockoutTime).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			s.respond(w, nil, http.StatusTooManyRequests, fmt.Errorf("too many failed logins, try again later"))
+			return
+		}
+
+		// Unknown emails and wrong passwords look the same to the client
+		userID, passwordHash, verified, err := s.user.GetCredentials(credentials.Email)
+		if err != nil || passwordHash == "" || !users.VerifyPassword(passwordHash, credentials.Password) {
+			attempt, recordErr := s.sessmanager.RecordFailedLogin(
+				credentials.Email,
+				viper.GetInt("max_login_attempts"),
+				viper.GetDuration("lockout_duration"),
+			)
+			if recordErr != nil {
+				s.logger.Error("failed to record login attempt", "error", recordErr)
+			} else if attempt.Locked(time.Now()) {
+				s.logger.Info("account locked after failed logins", "email", credentials.Email)
+			}
+			s.respond(w, nil, http.StatusUnauthorized, fmt.Errorf("invalid email or password"))
+			return
+		}
+
+		if !verified {
+			s.respond(w, nil, http.StatusForbidden, fmt.Errorf("email is not verified"))
+			return
+		}
+
+		if err := s.sessmanager.ResetLoginAttempts(credentials.Email); err != nil {
+			s.logger.Error("failed to reset login attempts", "error", err)
+		}
+
+		refreshToken, err := s.sessmanager.CreateSession(userID, viper.GetDuration("refresh_token_ttl"))
+		if err != nil {
+			s.logger.Error("failed to create session", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("login failed"))
+			return
+		}
+
+		tokens, err := s.issueTokens(userID, credentials.Email, refreshToken)
+		if err != nil {
+			s.logger.Error("failed to create access token", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("login failed"))
+			return
+		}
+
+		s.respond(w, tokens, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleRefresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("refresh request")
+		var request struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("refresh_token is required"))
+			return
+		}
+
+		// Each refresh token is single use; a new one comes back with the access token
+		userID, refreshToken, err := s.sessmanager.RotateSession(request.RefreshToken, viper.GetDuration("refresh_token_ttl"))
+		if errors.Is(err, sessmanager.ErrSessionNotFound) {
+			s.respond(w, nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired refresh token"))
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to rotate session", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("refresh failed"))
+			return
+		}
+
+		user, err := s.user.GetUserByID(userID)
+		if err != nil {
+			s.logger.Error("failed to get user for session", "error", err)
+			s.respond(w, nil, http.StatusUnauthorized, fmt.Errorf("invalid or expired refresh token"))
+			return
+		}
+
+		tokens, err := s.issueTokens(userID, user.Email, refreshToken)
+		if err != nil {
+			s.logger.Error("failed to create access token", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("refresh failed"))
+			return
+		}
+
+		s.respond(w, tokens, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("logout request")
+		var request struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("refresh_token is required"))
+			return
+		}
+
+		// Logging out twice is not an error
+		err := s.sessmanager.RevokeSession(request.RefreshToken)
+		if err != nil && !errors.Is(err, sessmanager.ErrSessionNotFound) {
+			s.logger.Error("failed to revoke session", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("logout failed"))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Logged out"}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleForgotPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("forgot password request")
+		var request struct {
+			Email string `json:"email"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("email is required"))
+			return
+		}
+
+		// The limit applies whether or not the email is registered, so it
+		// does not give away which addresses are
+		allowed, err := s.sessmanager.AllowResetRequest(
+			request.Email,
+			viper.GetInt("password_reset_limit"),
+			viper.GetDuration("password_reset_window"),
+		)
+		if err != nil {
+			s.logger.Error("failed to check password reset limit", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to send reset link"))
+			return
+		}
+		if !allowed {
+			s.respond(w, nil, http.StatusTooManyRequests, fmt.Errorf("too many password reset requests, try again later"))
+			return
+		}
+
+		// Queue the link in the background so the response looks the same
+		// whether or not the email is registered
+		go func(email string) {
+			exists, err := s.user.EmailExists(email)
+			if err != nil || !exists {
+				return
+			}
+
+			token, err := s.sessmanager.GenerateToken(email)
+			if err != nil {
+				s.logger.Error("failed to generate reset token", "error", err)
+				return
+			}
+
+			err = s.outbox.Enqueue(factory.OutboxMessage{
+				Recipient: email,
+				Subject:   "Reset your password",
+				Body: "Click the link to reset your password: " + viper.GetString("app_url") + "/reset-password?token=" + token +
+					"\n\nThe link expires in an hour. If you did not ask to reset your password you can ignore this email.",
+			})
+			if err != nil {
+				s.logger.Error("failed to queue reset email", "error", err)
+			}
+		}(request.Email)
+
+		s.respond(w, ResponseMsg{Message: "If the email is registered, a reset link has been sent"}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleResetPassword() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("reset password request")
+		var request struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Token == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("token and password are required"))
+			return
+		}
+		if len(request.Password) < minPasswordLength {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("password must be at least %d characters", minPasswordLength))
+			return
+		}
+
+		// The link works once: the token is used up before the password changes,
+		// so a second request with it fails even if this one does
+		email, err := s.sessmanager.ConsumeResetToken(request.Token)
+		if errors.Is(err, sessmanager.ErrTokenNotFound) {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("invalid or expired reset link"))
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to read reset token", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("password reset failed"))
+			return
+		}
+
+		hash, err := users.HashPassword(request.Password)
+		if err != nil {
+			s.logger.Error("failed to hash password", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("password reset failed"))
+			return
+		}
+
+		if err := s.user.UpdatePassword(email, hash); err != nil {
+			s.logger.Error("failed to update password", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("password reset failed"))
+			return
+		}
+
+		// Anyone signed in with the old password is signed out
+		if userID, err := s.user.GetUserIDByEmail(email); err != nil {
+			s.logger.Error("failed to get user for session revocation", "error", err)
+		} else if err := s.sessmanager.RevokeAllSessions(userID); err != nil {
+			s.logger.Error("failed to revoke sessions", "error", err)
+		}
+		if err := s.sessmanager.ResetLoginAttempts(email); err != nil {
+			s.logger.Error("failed to reset login attempts", "error", err)
+		}
+
+		s.respond(w, ResponseMsg{Message: "Password reset successfully"}, http.StatusOK, nil)
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/mail"
+)
+
+func (s *Server) handleRecordSettlement() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var settlement factory.Settlement
+
+		if err := json.NewDecoder(r.Body).Decode(&settlement); err != nil {
+			slog.Error("Failed to decode settlement", "error", err)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// The caller is the one who paid, unless they settle for another member
+		onBehalf := settlement.UserID != 0 && settlement.UserID != callerID(r)
+		if !onBehalf {
+			settlement.UserID = callerID(r)
+		}
+
+		if settlement.Amount <= 0 || settlement.UserID == 0 || settlement.CounterpartyID == 0 {
+			s.logger.Error("Invalid settlement", "settlement", settlement)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid settlement"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if onBehalf {
+			// Settling for someone else needs a group whose roles allow it
+			if settlement.GroupID == nil {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: "Settling for another user needs a group_id"}, http.StatusBadRequest, nil)
+				return
+			}
+			if !s.requireGroupPermission(w, r, *settlement.GroupID, factory.PermissionSettleForOthers) {
+				return
+			}
+		} else if settlement.GroupID != nil && !s.requireGroupMember(w, r, *settlement.GroupID) {
+			// Settlements within a group can only be recorded by its members
+			return
+		}
+
+		settlementID, err := s.settlement.RecordSettlement(&settlement)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		s.queueSettlementReceipts(settlement)
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: settlementID}, http.StatusCreated, nil)
+	}
+}
+
+// queueSettlementReceipts emails a receipt to both sides of a recorded
+// settlement. The settlement is already stored, so failures are only logged.
+func (s *Server) queueSettlementReceipts(settlement factory.Settlement) {
+	payer, err := s.user.GetUserByID(settlement.UserID)
+	if err != nil {
+		s.logger.Error("Failed to get payer details", "error", err)
+		return
+	}
+	counterparty, err := s.user.GetUserByID(settlement.CounterpartyID)
+	if err != nil {
+		s.logger.Error("Failed to get counterparty details", "error", err)
+		return
+	}
+
+	var messages []factory.OutboxMessage
+	for _, recipient := range []factory.User{payer, counterparty} {
+		message, err := templatedEmail(recipient.Email, mail.TemplateSettlementReceipt, mail.SettlementReceiptData{
+			Name:             recipient.Name,
+			PayerName:        payer.Name,
+			CounterpartyName: counterparty.Name,
+			Amount:           settlement.Amount,
+			Currency:         settlement.Currency,
+			Date:             settlement.SettlementDate,
+			SettlementID:     settlement.SettlementID,
+		})
+		if err != nil {
+			s.logger.Error("Failed to render settlement receipt", "error", err)
+			return
+		}
+		messages = append(messages, message)
+	}
+
+	if err := s.outbox.Enqueue(messages...); err != nil {
+		s.logger.Error("Failed to queue settlement receipts", "error", err)
+	}
+}
+
+func (s *Server) handleGetSettlementsByUserID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil || userID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid user ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireSelf(w, r, userID) {
+			return
+		}
+
+		settlements, err := s.settlement.GetSettlementsByUserID(userID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: settlements}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleGetSettlementsByGroupID() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+		if err != nil || groupID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid group ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.requireGroupMember(w, r, groupID) {
+			return
+		}
+
+		settlements, err := s.settlement.GetSettlementsByGroupID(groupID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: settlements}, http.StatusOK, nil)
+	}
+}
+
+func (s *Server) handleGetSettlementsBetweenUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil || userID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid user ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		counterpartyID, err := strconv.Atoi(r.URL.Query().Get("counterparty_id"))
+		if err != nil || counterpartyID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid counterparty ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Only one of the pair can see what they have paid each other
+		if counterpartyID != callerID(r) && !s.requireSelf(w, r, userID) {
+			return
+		}
+
+		settlements, err := s.settlement.GetSettlementsBetweenUsers(userID, counterpartyID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "Success", Data: settlements}, http.StatusOK, nil)
+	}
+}
@@ -2,12 +2,30 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/Abhinav7903/split/pkg/splitting"
+	"github.com/Abhinav7903/split/pkg/transaction"
+	"github.com/spf13/viper"
 )
 
+// initialTransactionStatus returns the status a new transaction starts in.
+// Only pending, the default, and successful are allowed.
+func initialTransactionStatus(status string) (string, bool) {
+	switch status {
+	case "":
+		return transaction.StatusPending, true
+	case transaction.StatusPending, transaction.StatusSuccessful:
+		return status, true
+	default:
+		return "", false
+	}
+}
+
 // handleCreateTransaction handles the creation of a new transaction.
 func (s *Server) handleCreateTransaction() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -17,15 +35,72 @@ func (s *Server) handleCreateTransaction() http.HandlerFunc {
 			return
 		}
 
+		// The caller records money they lent
+		transaction.LenderID = callerID(r)
+
 		// Validate transaction data
 		if transaction.LenderID == 0 || transaction.BorrowerID == 0 || transaction.Amount <= 0 {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: "Missing or invalid transaction details"}, http.StatusBadRequest, nil)
 			return
 		}
 
+		// Failures and retries only happen through /update-transaction-status
+		status, ok := initialTransactionStatus(transaction.Status)
+		if !ok {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "New transactions must be pending or successful"}, http.StatusBadRequest, nil)
+			return
+		}
+		transaction.Status = status
+		transaction.RetryCount = 0
+		transaction.FailureReason = nil
+
+		// Viewers cannot add transactions to a group
+		if !s.requireGroupPermission(w, r, transaction.GroupID, factory.PermissionAddExpenses) {
+			return
+		}
+
 		transactionID, err := s.transaction.CreateTransaction(&transaction)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: transactionID}, http.StatusCreated, nil)
+	}
+}
+
+// handleAddExpense records an expense together with its splits and balance updates.
+func (s *Server) handleAddExpense() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var expense factory.Expense
+		if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// The caller is the one who paid
+		expense.PayerID = callerID(r)
+
+		// Work out each participant's amount when a split mode is given
+		if err := splitParticipants(expense.Amount, expense.SplitMode, expense.Participants); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Validate expense data
+		if err := expense.Validate(); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Viewers cannot add expenses to a group
+		if !s.requireGroupPermission(w, r, expense.GroupID, factory.PermissionAddExpenses) {
+			return
+		}
+
+		transactionID, err := s.transaction.CreateExpense(&expense)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
 			return
 		}
 
@@ -33,6 +108,40 @@ func (s *Server) handleCreateTransaction() http.HandlerFunc {
 	}
 }
 
+// transactionErrorStatus maps errors from recording money and looking up
+// transactions to HTTP status codes
+func transactionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, groupmember.ErrNotMember):
+		return http.StatusBadRequest
+	case errors.Is(err, transaction.ErrNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// splitParticipants fills in each participant's amount from their value when a
+// split mode is given. Without one the amounts are left as sent.
+func splitParticipants(amount factory.Money, mode string, participants []factory.ExpenseParticipant) error {
+	if mode == "" {
+		return nil
+	}
+
+	values := make([]splitting.Participant, len(participants))
+	for i, participant := range participants {
+		values[i] = splitting.Participant{UserID: participant.UserID, Value: participant.Value}
+	}
+
+	splits, err := splitting.Compute(amount, splitting.Mode(mode), values)
+	if err != nil {
+		return err
+	}
+	for i := range participants {
+		participants[i].Amount = splits[i].Amount
+	}
+	return nil
+}
+
 // handleGetTransactionByID retrieves a transaction by its ID.
 func (s *Server) handleGetTransactionByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -42,13 +151,12 @@ func (s *Server) handleGetTransactionByID() http.HandlerFunc {
 			return
 		}
 
-		transaction, err := s.transaction.GetTransactionByID(transactionID)
+		transaction, err := s.transaction.GetTransactionByID(transactionID, s.includeDeleted(r))
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
 			return
 		}
-		if transaction == nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: "Transaction not found"}, http.StatusNotFound, nil)
+		if !s.requireTransactionAccess(w, r, transaction) {
 			return
 		}
 
@@ -56,7 +164,7 @@ func (s *Server) handleGetTransactionByID() http.HandlerFunc {
 	}
 }
 
-// handleGetTransactionsByLenderID retrieves transactions by lender ID.
+// handleGetTransactionsByLenderID retrieves a page of transactions by lender ID.
 func (s *Server) handleGetTransactionsByLenderID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		lenderID, err := strconv.Atoi(r.URL.Query().Get("lender_id"))
@@ -64,10 +172,19 @@ func (s *Server) handleGetTransactionsByLenderID() http.HandlerFunc {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid lender ID"}, http.StatusBadRequest, nil)
 			return
 		}
+		if !s.requireSelf(w, r, lenderID) {
+			return
+		}
 
-		transactions, err := s.transaction.GetTransactionsByLenderID(lenderID)
+		page, err := parsePageRequest(r)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		transactions, err := s.transaction.GetTransactionsByLenderID(lenderID, s.includeDeleted(r), page)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, pageErrorStatus(err), nil)
 			return
 		}
 
@@ -75,7 +192,7 @@ func (s *Server) handleGetTransactionsByLenderID() http.HandlerFunc {
 	}
 }
 
-// handleGetTransactionsByBorrowerID retrieves transactions by borrower ID.
+// handleGetTransactionsByBorrowerID retrieves a page of transactions by borrower ID.
 func (s *Server) handleGetTransactionsByBorrowerID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		borrowerID, err := strconv.Atoi(r.URL.Query().Get("borrower_id"))
@@ -83,10 +200,19 @@ func (s *Server) handleGetTransactionsByBorrowerID() http.HandlerFunc {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid borrower ID"}, http.StatusBadRequest, nil)
 			return
 		}
+		if !s.requireSelf(w, r, borrowerID) {
+			return
+		}
 
-		transactions, err := s.transaction.GetTransactionsByBorrowerID(borrowerID)
+		page, err := parsePageRequest(r)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		transactions, err := s.transaction.GetTransactionsByBorrowerID(borrowerID, s.includeDeleted(r), page)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, pageErrorStatus(err), nil)
 			return
 		}
 
@@ -103,22 +229,61 @@ func (s *Server) handleUpdateTransactionStatus() http.HandlerFunc {
 			return
 		}
 
-		var payload struct {
-			Status string `json:"status"`
+		var update factory.StatusUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+
+		if !transaction.ValidStatus(update.Status) {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Status must be one of pending, successful, failed or retrying"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.loadOwnedTransaction(w, r, transactionID) {
+			return
+		}
+
+		machine := transaction.StateMachine{MaxRetries: viper.GetInt("max_transaction_retries")}
+		updated, err := s.transaction.UpdateTransactionStatus(transactionID, update, machine, callerID(r))
+		var transitionErr *transaction.TransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			s.respond(w, ResponseMsg{Message: "Failed", Data: map[string]interface{}{
+				"error":               transitionErr.Error(),
+				"current_status":      transitionErr.From,
+				"retry_count":         transitionErr.RetryCount,
+				"allowed_transitions": transaction.AllowedTransitions(transitionErr.From),
+			}}, http.StatusConflict, nil)
+			return
+		case errors.Is(err, transaction.ErrFailureReasonRequired):
 			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
 			return
+		case err != nil:
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
+			return
 		}
 
-		if payload.Status == "" {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: "Status cannot be empty"}, http.StatusBadRequest, nil)
+		s.respond(w, ResponseMsg{Message: "success", Data: updated}, http.StatusOK, nil)
+	}
+}
+
+// handleDeleteTransaction deletes a transaction by its ID.
+func (s *Server) handleDeleteTransaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || transactionID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid transaction ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.loadOwnedTransaction(w, r, transactionID) {
 			return
 		}
 
-		err = s.transaction.UpdateTransactionStatus(transactionID, payload.Status)
+		err = s.transaction.DeleteTransaction(transactionID, callerID(r))
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
 			return
 		}
 
@@ -126,18 +291,23 @@ func (s *Server) handleUpdateTransactionStatus() http.HandlerFunc {
 	}
 }
 
-// handleDeleteTransaction deletes a transaction by its ID.
-func (s *Server) handleDeleteTransaction() http.HandlerFunc {
+// handleRestoreTransaction brings back a deleted transaction. Admins only.
+func (s *Server) handleRestoreTransaction() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Only admins can restore transactions"}, http.StatusForbidden, nil)
+			return
+		}
+
 		transactionID, err := strconv.Atoi(r.URL.Query().Get("id"))
 		if err != nil || transactionID <= 0 {
 			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid transaction ID"}, http.StatusBadRequest, nil)
 			return
 		}
 
-		err = s.transaction.DeleteTransaction(transactionID)
+		err = s.transaction.RestoreTransaction(transactionID, callerID(r))
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusNotFound, nil)
 			return
 		}
 
@@ -145,7 +315,39 @@ func (s *Server) handleDeleteTransaction() http.HandlerFunc {
 	}
 }
 
-// handleSearchTransactions searches for transactions based on filters.
+// handleGetTransactionHistory returns the log of everything done to a
+// transaction. Only admins can see the history of a deleted transaction.
+func (s *Server) handleGetTransactionHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil || transactionID <= 0 {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Invalid transaction ID"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		if !s.isAdmin(r) {
+			transaction, err := s.transaction.GetTransactionByID(transactionID, false)
+			if err != nil {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
+				return
+			}
+			if !s.requireTransactionAccess(w, r, transaction) {
+				return
+			}
+		}
+
+		logs, err := s.transaction.GetTransactionLogs(transactionID)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "success", Data: logs}, http.StatusOK, nil)
+	}
+}
+
+// handleSearchTransactions searches for transactions based on filters, one
+// page at a time.
 func (s *Server) handleSearchTransactions() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var filters factory.TransactionFilters
@@ -154,12 +356,71 @@ func (s *Server) handleSearchTransactions() http.HandlerFunc {
 			return
 		}
 
-		transactions, err := s.transaction.SearchTransactions(filters)
+		page, err := parsePageRequest(r)
 		if err != nil {
-			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusInternalServerError, nil)
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Stored times have no zone and are in UTC
+		if filters.CreatedFrom != nil {
+			from := filters.CreatedFrom.UTC()
+			filters.CreatedFrom = &from
+		}
+		if filters.CreatedTo != nil {
+			to := filters.CreatedTo.UTC()
+			filters.CreatedTo = &to
+		}
+
+		for _, status := range filters.Statuses {
+			if !transaction.ValidStatus(status) {
+				s.respond(w, ResponseMsg{Message: "Failed", Data: "Unknown status " + status}, http.StatusBadRequest, nil)
+				return
+			}
+		}
+		switch filters.GroupBy {
+		case "", factory.GroupByStatus, factory.GroupByMonth, factory.GroupByCategory:
+		default:
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "group_by must be status, month or category"}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Searches must stay within a group the caller belongs to or their own transactions
+		caller := callerID(r)
+		switch {
+		case filters.GroupID != nil:
+			if !s.requireGroupMember(w, r, *filters.GroupID) {
+				return
+			}
+		case (filters.LenderID != nil && *filters.LenderID == caller) ||
+			(filters.BorrowerID != nil && *filters.BorrowerID == caller) ||
+			(filters.InvolvingUserID != nil && *filters.InvolvingUserID == caller):
+		case s.isAdmin(r):
+		default:
+			s.respond(w, ResponseMsg{Message: "Failed", Data: "Filter by a group you belong to or by your own user ID"}, http.StatusForbidden, nil)
+			return
+		}
+
+		// Deleted transactions are only searched for admins who ask
+		filters.IncludeDeleted = s.includeDeleted(r)
+
+		transactions, err := s.transaction.SearchTransactions(filters, page)
+		if err != nil {
+			s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, pageErrorStatus(err), nil)
 			return
 		}
 
 		s.respond(w, ResponseMsg{Message: "success", Data: transactions}, http.StatusOK, nil)
 	}
 }
+
+// loadOwnedTransaction checks that the transaction exists and that the caller
+// may change it, writing the error response when not.
+func (s *Server) loadOwnedTransaction(w http.ResponseWriter, r *http.Request, transactionID int) bool {
+	transaction, err := s.transaction.GetTransactionByID(transactionID, false)
+	if err != nil {
+		s.respond(w, ResponseMsg{Message: "Failed", Data: err.Error()}, transactionErrorStatus(err), nil)
+		return false
+	}
+	return s.requireTransactionOwner(w, r, transaction)
+}
@@ -2,17 +2,26 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/groupmember"
+	"github.com/Abhinav7903/split/pkg/splitting"
+	transactionsplit "github.com/Abhinav7903/split/pkg/transaction_split"
 	"github.com/gorilla/mux"
 )
 
 func (s *Server) CreateTransactionSplitHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Parse request body into a TransactionSplit object
-		var request factory.TransactionSplit
+		// Parse request body into the transaction to split, the split mode and
+		// the participants to divide the transaction between
+		var request struct {
+			factory.TransactionSplit
+			Mode         splitting.Mode          `json:"mode"`
+			Participants []splitting.Participant `json:"participants"`
+		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			s.respond(w, ResponseMsg{
 				Message: "failed",
@@ -21,23 +30,67 @@ func (s *Server) CreateTransactionSplitHandler() http.HandlerFunc {
 			return
 		}
 
-		// Call the repository to create the transaction split
-		if err := s.transactionsplit.CreateTransactionSplit(&request); err != nil {
+		// Only the lender or members who may edit expenses can split a transaction
+		transaction, err := s.transaction.GetTransactionByID(request.TransactionID, false)
+		if err != nil {
+			s.respond(w, ResponseMsg{
+				Message: "failed",
+				Data:    err.Error(),
+			}, transactionErrorStatus(err), nil)
+			return
+		}
+		if !s.requireTransactionOwner(w, r, transaction) {
+			return
+		}
+
+		// Splits are only stored through SplitTransaction, which checks the
+		// participants and moves the balances with them
+		if request.Mode == "" {
+			s.respond(w, ResponseMsg{
+				Message: "failed",
+				Data:    "mode and participants are required",
+			}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// Split the transaction amount between the participants
+		splits, err := splitting.Compute(transaction.Amount, request.Mode, request.Participants)
+		if err != nil {
+			s.respond(w, ResponseMsg{
+				Message: "failed",
+				Data:    err.Error(),
+			}, http.StatusBadRequest, nil)
+			return
+		}
+
+		// The splits and the balance changes they cause are stored together
+		if err := s.transactionsplit.SplitTransaction(transaction.TransactionID, splits); err != nil {
 			s.respond(w, ResponseMsg{
 				Message: "failed",
 				Data:    "Error creating transaction split: " + err.Error(),
-			}, http.StatusInternalServerError, nil)
+			}, transactionSplitErrorStatus(err), nil)
 			return
 		}
 
-		// Return the created object and a 201 Created status
+		// Return the created splits and a 201 Created status
 		s.respond(w, ResponseMsg{
 			Message: "success",
-			Data:    request,
+			Data:    splits,
 		}, http.StatusCreated, nil)
 	}
 }
 
+// transactionSplitErrorStatus maps transaction split errors to HTTP status codes
+func transactionSplitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, transactionsplit.ErrAlreadySplit):
+		return http.StatusConflict
+	case errors.Is(err, groupmember.ErrNotMember):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *Server) GetTransactionSplitsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract transaction ID from the URL
@@ -51,6 +104,19 @@ func (s *Server) GetTransactionSplitsHandler() http.HandlerFunc {
 			return
 		}
 
+		// Only those who can see the transaction can see its splits
+		transaction, err := s.transaction.GetTransactionByID(transactionID, false)
+		if err != nil {
+			s.respond(w, ResponseMsg{
+				Message: "failed",
+				Data:    err.Error(),
+			}, transactionErrorStatus(err), nil)
+			return
+		}
+		if !s.requireTransactionAccess(w, r, transaction) {
+			return
+		}
+
 		// Call the repository to get transaction splits
 		transactionSplits, err := s.transactionsplit.GetTransactionSplits(transactionID)
 		if err != nil {
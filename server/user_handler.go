@@ -2,12 +2,49 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/Abhinav7903/split/factory"
+	"github.com/Abhinav7903/split/pkg/mail"
+	"github.com/Abhinav7903/split/pkg/sessmanager"
+	"github.com/Abhinav7903/split/pkg/users"
+	"github.com/spf13/viper"
 )
 
+// templatedEmail renders one of the mail templates into an outbox message
+func templatedEmail(to, template string, data any) (factory.OutboxMessage, error) {
+	message, err := mail.Render(template, data)
+	if err != nil {
+		return factory.OutboxMessage{}, err
+	}
+
+	return factory.OutboxMessage{
+		Recipient: to,
+		Subject:   message.Subject,
+		Body:      message.Text,
+		HTMLBody:  message.HTML,
+	}, nil
+}
+
+// verificationEmail issues a fresh verification token and builds the email
+// carrying the link
+func (s *Server) verificationEmail(name, email string) (factory.OutboxMessage, error) {
+	ttl := viper.GetDuration("verification_token_ttl")
+	token, err := s.sessmanager.CreateVerificationToken(email, ttl)
+	if err != nil {
+		return factory.OutboxMessage{}, err
+	}
+
+	return templatedEmail(email, mail.TemplateVerification, mail.VerificationData{
+		Name:      name,
+		Link:      viper.GetString("app_url") + "/verify?token=" + url.QueryEscape(token),
+		ExpiresIn: ttl.String(),
+	})
+}
+
 func (s *Server) handleSignUp() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("sign up request")
@@ -21,43 +58,39 @@ func (s *Server) handleSignUp() http.HandlerFunc {
 			return
 		}
 
-		// Add user to the database
-		err = s.user.AddUser(user)
-		if err != nil {
-			s.logger.Error("failed to add user", "error", err)
-			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to create user"))
-			return
-		}
-
-		// Generate an email hash
-		hash, err := s.sessmanager.StoreEmailHash(user.Email)
-		if err != nil {
-			s.logger.Error("failed to store email hash", "error", err)
-			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to process email verification"))
-			return
+		// Password logins are optional; only the hash is stored
+		if user.Password != "" {
+			if len(user.Password) < minPasswordLength {
+				s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("password must be at least %d characters", minPasswordLength))
+				return
+			}
+			hash, err := users.HashPassword(user.Password)
+			if err != nil {
+				s.logger.Error("failed to hash password", "error", err)
+				s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to create user"))
+				return
+			}
+			user.PasswordHash = hash
+			user.Password = ""
 		}
 
-		// Send verification email to the user
-		err = s.mail.SendMail(
-			user.Email,
-			"Verify your email",
-			"Click the link to verify your email: http://localhost:8080/verify?ehash="+hash,
-		)
+		verification, err := s.verificationEmail(user.Name, user.Email)
 		if err != nil {
-			s.logger.Error("failed to send verification email", "error", err)
-			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("verification email failed"))
+			s.logger.Error("failed to create verification token", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to create user"))
 			return
 		}
 
-		// Notify admin about the new user
-		err = s.mail.SendMail(
-			"abhinavashish4@gmail.com",
-			"New user signed up",
-			"New user signed up with email: "+user.Email+" and name: "+user.Name,
-		)
+		// Add user to the database; the verification email and the admin
+		// notification are queued with it and sent by the outbox worker
+		err = s.user.AddUser(user, verification, factory.OutboxMessage{
+			Recipient: "abhinavashish4@gmail.com",
+			Subject:   "New user signed up",
+			Body:      "New user signed up with email: " + user.Email + " and name: " + user.Name,
+		})
 		if err != nil {
-			s.logger.Error("failed to notify admin about the new user", "error", err)
-			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("admin notification failed"))
+			s.logger.Error("failed to add user", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to create user"))
 			return
 		}
 
@@ -70,18 +103,28 @@ func (s *Server) handleVerify() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("verify request")
 
-		// Extract the email hash from the query parameters
-		hash := r.URL.Query().Get("ehash")
-		if hash == "" {
-			s.logger.Error("missing email hash in request")
+		// Extract the verification token from the query parameters
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			s.logger.Error("missing verification token in request")
 			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("invalid verification link"))
 			return
 		}
 
-		// Retrieve email associated with the hash
-		email, err := s.sessmanager.GetEmailFromHash(hash)
-		if err != nil {
-			s.logger.Error("failed to retrieve email from hash", "error", err)
+		// Retrieve the email the token was issued for, using the token up
+		email, err := s.sessmanager.ConsumeVerificationToken(token)
+		switch {
+		case errors.Is(err, sessmanager.ErrTokenNotFound):
+			s.respond(w, nil, http.StatusNotFound, fmt.Errorf("unknown verification link"))
+			return
+		case errors.Is(err, sessmanager.ErrTokenUsed):
+			s.respond(w, nil, http.StatusConflict, fmt.Errorf("verification link has already been used"))
+			return
+		case errors.Is(err, sessmanager.ErrTokenExpired):
+			s.respond(w, nil, http.StatusGone, fmt.Errorf("verification link has expired, request a new one"))
+			return
+		case err != nil:
+			s.logger.Error("failed to consume verification token", "error", err)
 			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("email verification failed"))
 			return
 		}
@@ -98,6 +141,51 @@ func (s *Server) handleVerify() http.HandlerFunc {
 	}
 }
 
+func (s *Server) handleResendVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("resend verification request")
+		var request struct {
+			Email string `json:"email"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Email == "" {
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("email is required"))
+			return
+		}
+
+		allowed, err := s.sessmanager.AllowVerificationResend(
+			request.Email,
+			viper.GetInt("verification_resend_limit"),
+			viper.GetDuration("verification_resend_window"),
+		)
+		if err != nil {
+			s.logger.Error("failed to check verification resend limit", "error", err)
+			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to resend verification email"))
+			return
+		}
+		if !allowed {
+			s.respond(w, nil, http.StatusTooManyRequests, fmt.Errorf("too many verification emails, try again later"))
+			return
+		}
+
+		// Only unverified users get an email, but the response is the same either way
+		user, err := s.user.GetUser(request.Email)
+		if err == nil && !user.Verified {
+			verification, err := s.verificationEmail(user.Name, user.Email)
+			if err == nil {
+				err = s.outbox.Enqueue(verification)
+			}
+			if err != nil {
+				s.logger.Error("failed to queue verification email", "error", err)
+				s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("verification email failed"))
+				return
+			}
+		}
+
+		s.respond(w, ResponseMsg{Message: "If the email is registered and not yet verified, a verification link has been sent"}, http.StatusOK, nil)
+	}
+}
+
 func (s *Server) handleGetUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("get user request")
@@ -131,6 +219,9 @@ func (s *Server) handleUpdateUser() http.HandlerFunc {
 			return
 		}
 
+		// Users can only update themselves
+		user.Email = callerEmail(r)
+
 		err = s.user.UpdateUserDetails(user)
 		if err != nil {
 			s.logger.Error("failed to update user", "error", err)
@@ -145,20 +236,28 @@ func (s *Server) handleUpdateUser() http.HandlerFunc {
 func (s *Server) handleDeleteUser() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("delete user request")
-		email := r.URL.Query().Get("email")
+
+		// Users can only delete themselves
+		email := callerEmail(r)
 		if email == "" {
 			s.logger.Error("missing email in request")
 			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("invalid request"))
 			return
 		}
 
-		err := s.user.DeleteUser(email)
+		caller := callerID(r)
+		err := s.user.DeleteUser(email, caller)
 		if err != nil {
 			s.logger.Error("failed to delete user", "error", err)
 			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to delete user"))
 			return
 		}
 
+		// A deleted user is signed out everywhere
+		if err := s.sessmanager.RevokeAllSessions(caller); err != nil {
+			s.logger.Error("failed to revoke sessions", "error", err)
+		}
+
 		s.respond(w, ResponseMsg{Message: "User Deleted"}, http.StatusOK, nil)
 	}
 }
@@ -167,7 +266,17 @@ func (s *Server) handleGetAllUsers() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("get all users request")
 
-		users, err := s.user.GetAllUsers()
+		page, err := parsePageRequest(r)
+		if err != nil {
+			s.respond(w, nil, http.StatusBadRequest, err)
+			return
+		}
+
+		users, err := s.user.GetAllUsers(s.includeDeleted(r), page)
+		if errors.Is(err, factory.ErrInvalidPage) {
+			s.respond(w, nil, http.StatusBadRequest, err)
+			return
+		}
 		if err != nil {
 			s.logger.Error("failed to get all users", "error", err)
 			s.respond(w, nil, http.StatusInternalServerError, fmt.Errorf("failed to get all users"))
@@ -178,6 +287,32 @@ func (s *Server) handleGetAllUsers() http.HandlerFunc {
 	}
 }
 
+// handleRestoreUser brings back a deleted user. Admins only.
+func (s *Server) handleRestoreUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("restore user request")
+		if !s.isAdmin(r) {
+			s.respond(w, nil, http.StatusForbidden, fmt.Errorf("forbidden"))
+			return
+		}
+
+		email := r.URL.Query().Get("email")
+		if email == "" {
+			s.logger.Error("missing email in request")
+			s.respond(w, nil, http.StatusBadRequest, fmt.Errorf("invalid request"))
+			return
+		}
+
+		if err := s.user.RestoreUser(email); err != nil {
+			s.logger.Error("failed to restore user", "error", err)
+			s.respond(w, nil, http.StatusNotFound, fmt.Errorf("failed to restore user: %w", err))
+			return
+		}
+
+		s.respond(w, ResponseMsg{Message: "User Restored"}, http.StatusOK, nil)
+	}
+}
+
 func (s *Server) EmailExists() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("email exists request")